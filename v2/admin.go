@@ -0,0 +1,38 @@
+package rebar
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerAdminEndpoints registers the operational routes on the admin router:
+// health and version endpoints, and behind the admin token the log level, runtime
+// metrics and pprof.
+func (r *Rebar) registerAdminEndpoints(router *gin.Engine, opts Options) {
+	r.registerHealthEndpoints(router, opts.Health)
+	if !opts.Health.Disabled {
+		router.GET(opts.Health.VersionPath, r.VersionHandler())
+	}
+	r.registerLogLevelEndpoint(router, opts.AdminToken)
+	if opts.AdminToken == "" {
+		return
+	}
+	debug := router.Group("/debug", requireAdminToken(opts.AdminToken))
+	debug.GET("/vars", varsHandler)
+	debug.GET("/pprof/*profile", pprofHandler)
+	debug.POST("/pprof/*profile", pprofHandler)
+}
+
+// newAdminServer creates the admin server, which can write for long enough to send
+// the longest CPU profile or trace
+func newAdminServer(opts Options, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:           "0.0.0.0:" + opts.AdminPort,
+		ReadTimeout:    opts.ReadTimeout,
+		WriteTimeout:   maxProfileDuration + opts.WriteTimeout,
+		IdleTimeout:    opts.IdleTimeout,
+		Handler:        handler,
+		MaxHeaderBytes: 1 << 20,
+	}
+}
@@ -0,0 +1,163 @@
+package rebar_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/masonhubco/rebar/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Rebar_AdminRoutes(t *testing.T) {
+	t.Parallel()
+
+	var publicMiddlewareCalls int
+	r := rebar.New(rebar.Options{AdminPort: "9090", AdminToken: "secret"})
+	r.Router.Use(func(c *gin.Context) {
+		publicMiddlewareCalls++
+		c.Next()
+	})
+	require.NotNil(t, r.Admin)
+	assert.Equal(t, "0.0.0.0:9090", r.AdminServer.Addr)
+
+	tests := []struct {
+		name           string
+		givenPath      string
+		wantAdminCode  int
+		wantPublicCode int
+	}{
+		{name: "liveness", givenPath: "/healthz", wantAdminCode: http.StatusOK, wantPublicCode: http.StatusNotFound},
+		{name: "readiness", givenPath: "/readyz", wantAdminCode: http.StatusServiceUnavailable, wantPublicCode: http.StatusNotFound},
+		{name: "startup", givenPath: "/startupz", wantAdminCode: http.StatusServiceUnavailable, wantPublicCode: http.StatusNotFound},
+		{name: "version", givenPath: "/version", wantAdminCode: http.StatusOK, wantPublicCode: http.StatusNotFound},
+		{name: "metrics", givenPath: "/debug/vars", wantAdminCode: http.StatusOK, wantPublicCode: http.StatusNotFound},
+		{name: "pprof index", givenPath: "/debug/pprof/", wantAdminCode: http.StatusOK, wantPublicCode: http.StatusNotFound},
+		{name: "pprof profile", givenPath: "/debug/pprof/goroutine?debug=1", wantAdminCode: http.StatusOK, wantPublicCode: http.StatusNotFound},
+		{name: "pprof cmdline", givenPath: "/debug/pprof/cmdline", wantAdminCode: http.StatusOK, wantPublicCode: http.StatusNotFound},
+		{name: "pprof symbol", givenPath: "/debug/pprof/symbol", wantAdminCode: http.StatusOK, wantPublicCode: http.StatusNotFound},
+		{name: "pprof trace", givenPath: "/debug/pprof/trace?seconds=1", wantAdminCode: http.StatusOK, wantPublicCode: http.StatusNotFound},
+		{name: "pprof unknown profile", givenPath: "/debug/pprof/unknown", wantAdminCode: http.StatusNotFound, wantPublicCode: http.StatusNotFound},
+		{name: "pprof profile too long", givenPath: "/debug/pprof/profile?seconds=3600", wantAdminCode: http.StatusBadRequest, wantPublicCode: http.StatusNotFound},
+		{name: "pprof trace overflowing", givenPath: "/debug/pprof/trace?seconds=9223372036854775807", wantAdminCode: http.StatusBadRequest, wantPublicCode: http.StatusNotFound},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tc.givenPath, nil)
+			req.Header.Set("Authorization", "Bearer secret")
+			r.Admin.ServeHTTP(rr, req)
+			assert.Equal(t, tc.wantAdminCode, rr.Code)
+
+			rr = httptest.NewRecorder()
+			r.Router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.givenPath, nil))
+			assert.Equal(t, tc.wantPublicCode, rr.Code)
+		})
+	}
+	// admin requests never went through the public middleware
+	assert.Equal(t, len(tests), publicMiddlewareCalls)
+}
+
+func Test_Rebar_AdminDebugRoutes_Token(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		givenToken string
+		givenAuth  string
+		wantCode   int
+	}{
+		{name: "no admin token", givenAuth: "Bearer secret", wantCode: http.StatusNotFound},
+		{name: "no credentials", givenToken: "secret", wantCode: http.StatusUnauthorized},
+		{name: "wrong token", givenToken: "secret", givenAuth: "Bearer other", wantCode: http.StatusUnauthorized},
+		{name: "admin token", givenToken: "secret", givenAuth: "Bearer secret", wantCode: http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := rebar.New(rebar.Options{AdminPort: "9090", AdminToken: tc.givenToken})
+			for _, path := range []string{"/debug/vars", "/debug/pprof/", "/debug/pprof/heap"} {
+				rr := httptest.NewRecorder()
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				if tc.givenAuth != "" {
+					req.Header.Set("Authorization", tc.givenAuth)
+				}
+				r.Admin.ServeHTTP(rr, req)
+				assert.Equal(t, tc.wantCode, rr.Code, path)
+			}
+		})
+	}
+}
+
+func Test_Rebar_AdminRoutes_DefaultServeMux(t *testing.T) {
+	t.Parallel()
+
+	rebar.New(rebar.Options{AdminPort: "9090", AdminToken: "secret"})
+	// nothing is served on the default mux of the app
+	for _, path := range []string{"/debug/", "/debug/vars", "/debug/pprof/", "/debug/pprof/heap"} {
+		_, pattern := http.DefaultServeMux.Handler(httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Empty(t, pattern, path)
+	}
+}
+
+func Test_Rebar_NoAdminListener(t *testing.T) {
+	t.Parallel()
+
+	r := rebar.New(rebar.Options{})
+	assert.Nil(t, r.Admin)
+	assert.Nil(t, r.AdminServer)
+}
+
+func Test_Rebar_RunWithAdminListener(t *testing.T) {
+	t.Parallel()
+
+	port := freePort(t)
+	r := rebar.New(rebar.Options{AdminPort: port, ShutDownWait: time.Second})
+	r.Server.Addr = "127.0.0.1:0"
+	r.AdminServer.Addr = "127.0.0.1:" + port
+
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- r.RunWithContext(ctx, stop)
+	}()
+
+	url := fmt.Sprintf("http://127.0.0.1:%s/readyz", port)
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	require.Eventually(t, func() bool {
+		resp, err := client.Get(url)
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode == http.StatusOK
+	}, 2*time.Second, 10*time.Millisecond)
+
+	stop()
+	require.NoError(t, <-done)
+	// the admin server shared the graceful shutdown
+	_, err := client.Get(url)
+	assert.Error(t, err)
+}
+
+func freePort(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	require.NoError(t, err)
+	return port
+}
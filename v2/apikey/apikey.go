@@ -0,0 +1,139 @@
+// Package apikey authenticates partners with scoped API keys. Keys are made of a
+// public ID and a secret, and stores only keep a hash of the secret. Each key
+// belongs to a principal, granted scopes that routes can require.
+//
+//	store := apikey.NewSQLStore(db, apikey.SQLOptions{})
+//	token, _, err := apikey.Create(ctx, store, "acme", "orders:read", "orders:write")
+//
+//	partners := app.Router.Group("/partners", apikey.Authenticate(store, apikey.Options{}))
+//	partners.GET("/orders", middleware.RequireScopes("orders:read"), listOrders)
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/masonhubco/rebar/v2"
+)
+
+var (
+	// ErrNotFound is returned by stores when no key has the ID
+	ErrNotFound = errors.New("apikey: key not found")
+	// ErrInvalidKey is returned for a malformed key, or a key that doesn't match its
+	// hash
+	ErrInvalidKey = errors.New("apikey: invalid key")
+	// ErrExpired is returned for a key past its expiry
+	ErrExpired = errors.New("apikey: key expired")
+	// ErrRevoked is returned for a revoked key
+	ErrRevoked = errors.New("apikey: key revoked")
+)
+
+// Key is an API key as held by a store, without its secret
+type Key struct {
+	ID string
+	// Hash is the hex encoded SHA-256 of the secret
+	Hash string
+	// Principal is who the key belongs to
+	Principal string
+	Scopes    []string
+	CreatedAt time.Time
+	// ExpiresAt is optional
+	ExpiresAt *time.Time
+	RevokedAt *time.Time
+}
+
+// Store holds API keys
+type Store interface {
+	// Create adds a key
+	Create(ctx context.Context, key Key) error
+	// Get returns the key with the ID, or ErrNotFound
+	Get(ctx context.Context, id string) (*Key, error)
+	// Revoke marks the key as revoked, or returns ErrNotFound
+	Revoke(ctx context.Context, id string) error
+}
+
+// Generate creates a key for principal, granted scopes. The returned token is the
+// only time its secret is known: it's given to the principal, and the key is added
+// to a store.
+func Generate(principal string, scopes ...string) (token string, key Key, err error) {
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", Key{}, fmt.Errorf("apikey: %w", err)
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", Key{}, fmt.Errorf("apikey: %w", err)
+	}
+	key = Key{
+		ID:        hex.EncodeToString(id),
+		Principal: principal,
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(secret)
+	key.Hash = hash(encoded)
+	return key.ID + "." + encoded, key, nil
+}
+
+// Create generates a key and adds it to store
+func Create(ctx context.Context, store Store, principal string, scopes ...string) (string, Key, error) {
+	token, key, err := Generate(principal, scopes...)
+	if err != nil {
+		return "", Key{}, err
+	}
+	if err := store.Create(ctx, key); err != nil {
+		return "", Key{}, err
+	}
+	return token, key, nil
+}
+
+// Verify looks the token up in store, and returns the principal of its key when the
+// secret matches and the key is neither expired nor revoked. The ID of the key is
+// the api_key_id attribute of the principal.
+func Verify(ctx context.Context, store Store, token string) (*rebar.Principal, error) {
+	id, secret, ok := ParseID(token)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+	key, err := store.Get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hash(secret)), []byte(key.Hash)) != 1 {
+		return nil, ErrInvalidKey
+	}
+	if key.RevokedAt != nil {
+		return nil, ErrRevoked
+	}
+	if key.ExpiresAt != nil && !time.Now().Before(*key.ExpiresAt) {
+		return nil, ErrExpired
+	}
+	return &rebar.Principal{
+		Subject:    key.Principal,
+		Type:       rebar.PrincipalAPIKey,
+		Scopes:     key.Scopes,
+		Attributes: map[string]interface{}{"api_key_id": key.ID},
+	}, nil
+}
+
+// ParseID splits a token into the ID and the secret of its key
+func ParseID(token string) (id, secret string, ok bool) {
+	id, secret, ok = strings.Cut(token, ".")
+	return id, secret, ok && id != "" && secret != ""
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
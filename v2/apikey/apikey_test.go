@@ -0,0 +1,94 @@
+package apikey_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/masonhubco/rebar/v2"
+	"github.com/masonhubco/rebar/v2/apikey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Generate(t *testing.T) {
+	t.Parallel()
+
+	token, key, err := apikey.Generate("acme", "orders:read")
+	require.NoError(t, err)
+	id, secret, ok := apikey.ParseID(token)
+	require.True(t, ok)
+	assert.Equal(t, key.ID, id)
+	assert.Len(t, key.ID, 16)
+	assert.Len(t, key.Hash, 64)
+	assert.NotContains(t, key.Hash, secret)
+	assert.Equal(t, "acme", key.Principal)
+	assert.Equal(t, []string{"orders:read"}, key.Scopes)
+	assert.False(t, key.CreatedAt.IsZero())
+
+	other, _, err := apikey.Generate("acme")
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+}
+
+func Test_Verify(t *testing.T) {
+	t.Parallel()
+
+	store := apikey.NewMemoryStore()
+	token, key, err := apikey.Create(context.Background(), store, "acme", "orders:read")
+	require.NoError(t, err)
+
+	expiredToken, expired, err := apikey.Generate("acme")
+	require.NoError(t, err)
+	past := time.Now().Add(-time.Minute)
+	expired.ExpiresAt = &past
+	require.NoError(t, store.Create(context.Background(), expired))
+
+	revokedToken, revoked, err := apikey.Create(context.Background(), store, "acme")
+	require.NoError(t, err)
+	require.NoError(t, store.Revoke(context.Background(), revoked.ID))
+
+	tests := []struct {
+		name          string
+		givenToken    string
+		wantPrincipal *rebar.Principal
+		wantErr       error
+	}{
+		{name: "valid key", givenToken: token,
+			wantPrincipal: &rebar.Principal{Subject: "acme", Type: rebar.PrincipalAPIKey, Scopes: []string{"orders:read"},
+				Attributes: map[string]interface{}{"api_key_id": key.ID}}},
+		{name: "wrong secret", givenToken: key.ID + ".wrong", wantErr: apikey.ErrInvalidKey},
+		{name: "unknown key", givenToken: "unknown." + strings.SplitN(token, ".", 2)[1], wantErr: apikey.ErrInvalidKey},
+		{name: "malformed", givenToken: "no-separator", wantErr: apikey.ErrInvalidKey},
+		{name: "expired", givenToken: expiredToken, wantErr: apikey.ErrExpired},
+		{name: "revoked", givenToken: revokedToken, wantErr: apikey.ErrRevoked},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			principal, err := apikey.Verify(context.Background(), store, tc.givenToken)
+			assert.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantPrincipal, principal)
+		})
+	}
+}
+
+type failingStore struct {
+	apikey.Store
+}
+
+func (failingStore) Get(context.Context, string) (*apikey.Key, error) {
+	return nil, errors.New("connection refused")
+}
+
+func Test_Verify_StoreError(t *testing.T) {
+	t.Parallel()
+
+	_, err := apikey.Verify(context.Background(), failingStore{}, "id.secret")
+	assert.EqualError(t, err, "connection refused")
+}
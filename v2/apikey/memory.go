@@ -0,0 +1,57 @@
+package apikey
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MemoryStore holds keys in memory, for tests and development
+type MemoryStore struct {
+	mu   sync.RWMutex
+	keys map[string]Key
+}
+
+// NewMemoryStore creates an empty store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{keys: map[string]Key{}}
+}
+
+// Create implements Store
+func (s *MemoryStore) Create(_ context.Context, key Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.keys[key.ID]; exists {
+		return fmt.Errorf("apikey: key %s already exists", key.ID)
+	}
+	s.keys[key.ID] = key
+	return nil
+}
+
+// Get implements Store
+func (s *MemoryStore) Get(_ context.Context, id string) (*Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &key, nil
+}
+
+// Revoke implements Store
+func (s *MemoryStore) Revoke(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if key.RevokedAt == nil {
+		now := time.Now()
+		key.RevokedAt = &now
+		s.keys[id] = key
+	}
+	return nil
+}
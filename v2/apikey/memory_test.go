@@ -0,0 +1,40 @@
+package apikey_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/masonhubco/rebar/v2/apikey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_MemoryStore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := apikey.NewMemoryStore()
+	_, key, err := apikey.Generate("acme", "orders:read")
+	require.NoError(t, err)
+
+	require.NoError(t, store.Create(ctx, key))
+	assert.EqualError(t, store.Create(ctx, key), "apikey: key "+key.ID+" already exists")
+
+	got, err := store.Get(ctx, key.ID)
+	require.NoError(t, err)
+	assert.Equal(t, key, *got)
+	_, err = store.Get(ctx, "unknown")
+	assert.ErrorIs(t, err, apikey.ErrNotFound)
+
+	require.NoError(t, store.Revoke(ctx, key.ID))
+	got, err = store.Get(ctx, key.ID)
+	require.NoError(t, err)
+	require.NotNil(t, got.RevokedAt)
+	revokedAt := *got.RevokedAt
+	// revoking again keeps the first revocation time
+	require.NoError(t, store.Revoke(ctx, key.ID))
+	got, err = store.Get(ctx, key.ID)
+	require.NoError(t, err)
+	assert.Equal(t, revokedAt, *got.RevokedAt)
+	assert.ErrorIs(t, store.Revoke(ctx, "unknown"), apikey.ErrNotFound)
+}
@@ -0,0 +1,67 @@
+package apikey
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/masonhubco/rebar/v2"
+	"github.com/masonhubco/rebar/v2/middleware"
+	"go.uber.org/zap"
+)
+
+// Options configures Authenticate
+type Options struct {
+	// Header defaults to X-API-Key. It's the request header holding the key.
+	Header string
+}
+
+func (o Options) valuesOrDefaults() Options {
+	if o.Header == "" {
+		o.Header = "X-API-Key"
+	}
+	return o
+}
+
+// Authenticate returns a middleware that verifies the API key of requests against
+// store, see Authenticator.
+func Authenticate(store Store, opts Options) gin.HandlerFunc {
+	return middleware.Authenticate(Authenticator(store, opts))
+}
+
+// Authenticator authenticates requests by their API key, verified against store.
+// The principal of the key is the subject of the principal, and the ID of the key
+// is added to the request logs as the api_key_id field.
+func Authenticator(store Store, opts Options) middleware.Authenticator {
+	return authenticator{store: store, opts: opts.valuesOrDefaults()}
+}
+
+type authenticator struct {
+	store Store
+	opts  Options
+}
+
+func (a authenticator) Authenticate(c *gin.Context) (*rebar.Principal, error) {
+	token := c.GetHeader(a.opts.Header)
+	if token == "" {
+		return nil, middleware.ErrNoCredentials
+	}
+	id, _, wellFormed := ParseID(token)
+	principal, err := Verify(c.Request.Context(), a.store, token)
+	if errors.Is(err, ErrInvalidKey) || errors.Is(err, ErrExpired) || errors.Is(err, ErrRevoked) {
+		if !wellFormed {
+			// the header could hold nothing but a secret, which must not be logged
+			return nil, fmt.Errorf("%w: malformed api key", middleware.ErrInvalidCredentials)
+		}
+		return nil, fmt.Errorf("%w: api key %q: %s", middleware.ErrInvalidCredentials, id, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rebar.AddLogFields(c, zap.String("api_key_id", id))
+	return principal, nil
+}
+
+func (a authenticator) Challenge() string {
+	return fmt.Sprintf("APIKey header=%q", a.opts.Header)
+}
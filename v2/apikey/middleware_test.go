@@ -0,0 +1,134 @@
+package apikey_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/masonhubco/rebar/v2"
+	"github.com/masonhubco/rebar/v2/apikey"
+	"github.com/masonhubco/rebar/v2/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func Test_Authenticate(t *testing.T) {
+	t.Parallel()
+
+	store := apikey.NewMemoryStore()
+	readToken, readKey, err := apikey.Create(context.Background(), store, "acme", "orders:read")
+	require.NoError(t, err)
+	writeToken, writeKey, err := apikey.Create(context.Background(), store, "globex", "orders:read", "orders:write")
+	require.NoError(t, err)
+	revokedToken, revokedKey, err := apikey.Create(context.Background(), store, "initech", "orders:read")
+	require.NoError(t, err)
+	require.NoError(t, store.Revoke(context.Background(), revokedKey.ID))
+
+	tests := []struct {
+		name          string
+		givenPath     string
+		givenToken    string
+		wantCode      int
+		wantBody      string
+		wantKeyID     string
+		wantPrincipal string
+		wantWarning   string
+		wantError     string
+	}{
+		{name: "granted scope", givenPath: "/orders", givenToken: readToken, wantCode: http.StatusOK,
+			wantBody: "acme", wantKeyID: readKey.ID, wantPrincipal: "acme"},
+		{name: "granted scopes", givenPath: "/orders/write", givenToken: writeToken, wantCode: http.StatusOK,
+			wantBody: "globex", wantKeyID: writeKey.ID, wantPrincipal: "globex"},
+		{name: "missing scope", givenPath: "/orders/write", givenToken: readToken, wantCode: http.StatusForbidden,
+			wantBody:  `{"request_id":"req-1","error":"missing scopes: orders:write"}`,
+			wantKeyID: readKey.ID, wantPrincipal: "acme", wantWarning: "principal missing scopes"},
+		{name: "revoked key", givenPath: "/orders", givenToken: revokedToken, wantCode: http.StatusUnauthorized,
+			wantBody: `{"status":"unauthorized"}`, wantWarning: "credentials not valid"},
+		{name: "wrong secret", givenPath: "/orders", givenToken: readKey.ID + ".wrong", wantCode: http.StatusUnauthorized,
+			wantBody: `{"status":"unauthorized"}`, wantWarning: "credentials not valid",
+			wantError: `invalid credentials: api key "` + readKey.ID + `": apikey: invalid key`},
+		{name: "malformed key", givenPath: "/orders", givenToken: "raw-secret", wantCode: http.StatusUnauthorized,
+			wantBody: `{"status":"unauthorized"}`, wantWarning: "credentials not valid",
+			wantError: "invalid credentials: malformed api key"},
+		{name: "no key", givenPath: "/orders", wantCode: http.StatusUnauthorized,
+			wantBody: `{"status":"unauthorized"}`, wantWarning: "no credentials in request"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			core, logs := observer.New(zapcore.DebugLevel)
+			router := gin.New()
+			router.Use(middleware.Logger(zap.New(core)))
+			router.Use(apikey.Authenticate(store, apikey.Options{}))
+			handler := func(c *gin.Context) {
+				principal, _ := rebar.PrincipalFrom(c)
+				c.String(http.StatusOK, principal.Subject)
+			}
+			router.GET("/orders", middleware.RequireScopes("orders:read"), handler)
+			router.GET("/orders/write", middleware.RequireScopes("orders:read", "orders:write"), handler)
+
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tc.givenPath, nil)
+			req.Header.Set(middleware.RequestIDField, "req-1")
+			if tc.givenToken != "" {
+				req.Header.Set("X-API-Key", tc.givenToken)
+			}
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.wantCode, rr.Code)
+			if tc.wantCode == http.StatusOK {
+				assert.Equal(t, tc.wantBody, rr.Body.String())
+			} else {
+				assert.JSONEq(t, tc.wantBody, rr.Body.String())
+			}
+			if tc.wantCode == http.StatusUnauthorized {
+				assert.Equal(t, `APIKey header="X-API-Key"`, rr.Header().Get("WWW-Authenticate"))
+			}
+			if tc.wantWarning != "" {
+				warnings := logs.FilterMessage(tc.wantWarning).All()
+				require.Len(t, warnings, 1)
+				if tc.wantError != "" {
+					assert.Equal(t, []interface{}{map[string]interface{}{"error": tc.wantError}},
+						warnings[0].ContextMap()["errors"])
+				}
+			}
+
+			// the request log tells which key was used
+			requests := logs.FilterMessage("[rebar] " + tc.givenPath).All()
+			require.Len(t, requests, 1)
+			fields := requests[0].ContextMap()
+			if tc.wantKeyID == "" {
+				assert.NotContains(t, fields, "api_key_id")
+				return
+			}
+			assert.Equal(t, tc.wantKeyID, fields["api_key_id"])
+			assert.Equal(t, tc.wantPrincipal, fields["principal"])
+			assert.Equal(t, rebar.PrincipalAPIKey, fields["principal_type"])
+		})
+	}
+}
+
+func Test_Authenticate_StoreError(t *testing.T) {
+	t.Parallel()
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set(rebar.RequestIDKey, "req-1") })
+	router.Use(apikey.Authenticate(failingStore{}, apikey.Options{Header: "X-Partner-Key"}))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Partner-Key", "id.secret")
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.JSONEq(t, `{"request_id":"req-1","error":"unable to authenticate the request"}`, rr.Body.String())
+}
@@ -0,0 +1,119 @@
+package apikey
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SQLOptions configures a SQLStore
+type SQLOptions struct {
+	// Table defaults to rebar_api_keys. The name isn't quoted for the dialect of the
+	// driver, so it's a plain, trusted identifier like partner_keys.
+	Table string
+}
+
+// SQLStore holds keys in a database table. Queries are rebound to the bind type of
+// the driver, so that any database supported by sqlx works. Scopes are stored space
+// separated.
+type SQLStore struct {
+	db      *sqlx.DB
+	table   string
+	queries sqlQueries
+}
+
+type sqlQueries struct {
+	create, insert, get, revoke, exists string
+}
+
+// NewSQLStore creates a store keeping keys through db. The table is created by
+// Migrate.
+func NewSQLStore(db *sqlx.DB, opts SQLOptions) *SQLStore {
+	table := opts.Table
+	if table == "" {
+		table = "rebar_api_keys"
+	}
+	return &SQLStore{
+		db:    db,
+		table: table,
+		queries: sqlQueries{
+			create: fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id varchar(64) PRIMARY KEY,
+	hash varchar(64) NOT NULL,
+	principal varchar(255) NOT NULL,
+	scopes text NOT NULL,
+	created_at timestamp NOT NULL,
+	expires_at timestamp NULL,
+	revoked_at timestamp NULL
+)`, table),
+			insert: db.Rebind(fmt.Sprintf(`INSERT INTO %s (id, hash, principal, scopes, created_at, expires_at)
+VALUES (?, ?, ?, ?, ?, ?)`, table)),
+			get: db.Rebind(fmt.Sprintf(`SELECT id, hash, principal, scopes, created_at, expires_at, revoked_at
+FROM %s WHERE id = ?`, table)),
+			revoke: db.Rebind(fmt.Sprintf(`UPDATE %s SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ?`, table)),
+			exists: db.Rebind(fmt.Sprintf(`SELECT id FROM %s WHERE id = ?`, table)),
+		},
+	}
+}
+
+// Migrate creates the keys table when it doesn't exist
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, s.queries.create); err != nil {
+		return fmt.Errorf("create %s: %w", s.table, err)
+	}
+	return nil
+}
+
+// Create implements Store
+func (s *SQLStore) Create(ctx context.Context, key Key) error {
+	_, err := s.db.ExecContext(ctx, s.queries.insert,
+		key.ID, key.Hash, key.Principal, strings.Join(key.Scopes, " "), key.CreatedAt, key.ExpiresAt)
+	return err
+}
+
+// Get implements Store
+func (s *SQLStore) Get(ctx context.Context, id string) (*Key, error) {
+	var key Key
+	var scopes string
+	var expiresAt, revokedAt sql.NullTime
+	err := s.db.QueryRowxContext(ctx, s.queries.get, id).
+		Scan(&key.ID, &key.Hash, &key.Principal, &scopes, &key.CreatedAt, &expiresAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	key.Scopes = strings.Fields(scopes)
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return &key, nil
+}
+
+// Revoke implements Store
+func (s *SQLStore) Revoke(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, s.queries.revoke, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected > 0 {
+		return nil
+	}
+	// MySQL reports the rows changed rather than matched, so revoking a key again
+	// affects none
+	var found string
+	err = s.db.QueryRowxContext(ctx, s.queries.exists, id).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
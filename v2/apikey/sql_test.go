@@ -0,0 +1,133 @@
+package apikey_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/masonhubco/rebar/v2/apikey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSQLStore(t *testing.T, driver string) (*apikey.SQLStore, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, mock.ExpectationsWereMet())
+		db.Close()
+	})
+	return apikey.NewSQLStore(sqlx.NewDb(db, driver), apikey.SQLOptions{Table: "partner_keys"}), mock
+}
+
+func Test_SQLStore_Migrate(t *testing.T) {
+	t.Parallel()
+
+	store, mock := newSQLStore(t, "postgres")
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS partner_keys")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	require.NoError(t, store.Migrate(context.Background()))
+
+	mock.ExpectExec("CREATE TABLE").WillReturnError(errors.New("permission denied"))
+	assert.EqualError(t, store.Migrate(context.Background()), "create partner_keys: permission denied")
+}
+
+func Test_SQLStore_Create(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		driver    string
+		wantQuery string
+	}{
+		{name: "postgres", driver: "postgres",
+			wantQuery: "INSERT INTO partner_keys (id, hash, principal, scopes, created_at, expires_at)\nVALUES ($1, $2, $3, $4, $5, $6)"},
+		{name: "mysql", driver: "mysql",
+			wantQuery: "INSERT INTO partner_keys (id, hash, principal, scopes, created_at, expires_at)\nVALUES (?, ?, ?, ?, ?, ?)"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store, mock := newSQLStore(t, tc.driver)
+			createdAt := time.Now()
+			key := apikey.Key{ID: "k1", Hash: "h1", Principal: "acme", Scopes: []string{"orders:read", "orders:write"}, CreatedAt: createdAt}
+			mock.ExpectExec(regexp.QuoteMeta(tc.wantQuery)).
+				WithArgs("k1", "h1", "acme", "orders:read orders:write", createdAt, nil).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			require.NoError(t, store.Create(context.Background(), key))
+		})
+	}
+}
+
+func Test_SQLStore_Get(t *testing.T) {
+	t.Parallel()
+
+	store, mock := newSQLStore(t, "postgres")
+	createdAt := time.Now().UTC()
+	expiresAt := createdAt.Add(time.Hour)
+	query := regexp.QuoteMeta("SELECT id, hash, principal, scopes, created_at, expires_at, revoked_at\nFROM partner_keys WHERE id = $1")
+	columns := []string{"id", "hash", "principal", "scopes", "created_at", "expires_at", "revoked_at"}
+
+	mock.ExpectQuery(query).WithArgs("k1").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("k1", "h1", "acme", "orders:read orders:write", createdAt, expiresAt, nil))
+	key, err := store.Get(context.Background(), "k1")
+	require.NoError(t, err)
+	assert.Equal(t, &apikey.Key{
+		ID: "k1", Hash: "h1", Principal: "acme", Scopes: []string{"orders:read", "orders:write"},
+		CreatedAt: createdAt, ExpiresAt: &expiresAt,
+	}, key)
+
+	mock.ExpectQuery(query).WithArgs("k2").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("k2", "h2", "acme", "", createdAt, nil, createdAt))
+	key, err = store.Get(context.Background(), "k2")
+	require.NoError(t, err)
+	assert.Empty(t, key.Scopes)
+	assert.Nil(t, key.ExpiresAt)
+	assert.Equal(t, &createdAt, key.RevokedAt)
+
+	mock.ExpectQuery(query).WithArgs("unknown").WillReturnRows(sqlmock.NewRows(columns))
+	_, err = store.Get(context.Background(), "unknown")
+	assert.ErrorIs(t, err, apikey.ErrNotFound)
+
+	mock.ExpectQuery(query).WithArgs("k1").WillReturnError(errors.New("connection refused"))
+	_, err = store.Get(context.Background(), "k1")
+	assert.EqualError(t, err, "connection refused")
+}
+
+func Test_SQLStore_Revoke(t *testing.T) {
+	t.Parallel()
+
+	store, mock := newSQLStore(t, "postgres")
+	query := regexp.QuoteMeta("UPDATE partner_keys SET revoked_at = COALESCE(revoked_at, $1) WHERE id = $2")
+
+	mock.ExpectExec(query).WithArgs(sqlmock.AnyArg(), "k1").WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, store.Revoke(context.Background(), "k1"))
+
+	mock.ExpectExec(query).WithArgs(sqlmock.AnyArg(), "unknown").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM partner_keys WHERE id = $1")).WithArgs("unknown").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	assert.ErrorIs(t, store.Revoke(context.Background(), "unknown"), apikey.ErrNotFound)
+}
+
+func Test_SQLStore_RevokeTwice(t *testing.T) {
+	t.Parallel()
+
+	// MySQL affects no row when the key is already revoked
+	store, mock := newSQLStore(t, "mysql")
+	query := regexp.QuoteMeta("UPDATE partner_keys SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ?")
+	mock.ExpectExec(query).WithArgs(sqlmock.AnyArg(), "k1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(query).WithArgs(sqlmock.AnyArg(), "k1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM partner_keys WHERE id = ?")).WithArgs("k1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("k1"))
+
+	require.NoError(t, store.Revoke(context.Background(), "k1"))
+	require.NoError(t, store.Revoke(context.Background(), "k1"))
+}
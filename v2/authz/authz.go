@@ -0,0 +1,375 @@
+// Package authz authorizes requests with policies mapping roles to permissions. A
+// permission allows an action on a type of resource, and may only apply when
+// conditions on the attributes of the principal, the route params and the resource
+// hold. Policies are declared in Go, or loaded from YAML.
+//
+//	policy, err := authz.LoadPolicy("/etc/app/policy.yaml")
+//	authorizer, err := authz.New(policy, authz.Options{})
+//
+//	orders := app.Router.Group("/orders", middleware.JWT(jwtOpts))
+//	orders.GET("", authorizer.Require("orders:list", "order"), listOrders)
+//	orders.PUT("/:id", updateOrder) // calls authorizer.Authorize with the order
+package authz
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/masonhubco/rebar/v2"
+	"gopkg.in/yaml.v2"
+)
+
+// ErrForbidden is returned by Authorize when the request is denied
+var ErrForbidden = errors.New("forbidden")
+
+// Policy maps roles to the permissions they grant
+type Policy struct {
+	Roles map[string][]Permission `yaml:"roles"`
+}
+
+// Permission allows an action on a type of resource
+type Permission struct {
+	// Action is like orders:read. * allows every action, and orders:* every action
+	// starting with orders:.
+	Action string `yaml:"action"`
+	// Resource is the type of resource. Every type is allowed when it's empty or *.
+	Resource string `yaml:"resource"`
+	// When lists conditions that must all hold for the permission to apply
+	When []Condition `yaml:"when"`
+	// Check is optional, for conditions that can only be written in Go. The
+	// permission only applies when it returns nil, and the error is the reason it
+	// doesn't. Unlike When, it also runs in the checks of Require, with a resource
+	// that only has a type.
+	Check func(Request) error `yaml:"-"`
+}
+
+// Condition compares an attribute of the request, see Request.Attribute, with
+// either a value, a list of values or another attribute. Values are compared as
+// strings, numbers being formatted without exponent, so that the numeric claims of
+// a JWT match route params. An attribute holding a list matches when any of its
+// values does.
+type Condition struct {
+	Attribute       string   `yaml:"attribute"`
+	Equals          string   `yaml:"equals"`
+	In              []string `yaml:"in"`
+	EqualsAttribute string   `yaml:"equals_attribute"`
+}
+
+// Resource is what an action is made on
+type Resource struct {
+	Type string
+	ID   string
+	// Attributes are what conditions check, like the owner of the resource
+	Attributes map[string]interface{}
+}
+
+// Request is an action a principal asks to make on a resource
+type Request struct {
+	Principal *rebar.Principal
+	Action    string
+	Resource  Resource
+	// Params are the params of the route
+	Params gin.Params
+}
+
+// Attribute returns an attribute of the request by name:
+//   - principal.subject, principal.type and principal.scopes, or any other
+//     principal.name for the attributes of the principal, like its JWT claims
+//   - param.name for the route params
+//   - resource.type and resource.id, or any other resource.name for the attributes
+//     of the resource
+//
+// An attribute holding nil is not set.
+func (r Request) Attribute(name string) (interface{}, bool) {
+	scope, key, _ := strings.Cut(name, ".")
+	switch scope {
+	case "principal":
+		if r.Principal == nil {
+			return nil, false
+		}
+		switch key {
+		case "subject":
+			return r.Principal.Subject, true
+		case "type":
+			return r.Principal.Type, true
+		case "scopes":
+			return r.Principal.Scopes, true
+		}
+		value := r.Principal.Attributes[key]
+		return value, value != nil
+	case "param":
+		return r.Params.Get(key)
+	case "resource":
+		switch key {
+		case "type":
+			return r.Resource.Type, r.Resource.Type != ""
+		case "id":
+			return r.Resource.ID, r.Resource.ID != ""
+		}
+		value := r.Resource.Attributes[key]
+		return value, value != nil
+	}
+	return nil, false
+}
+
+// Decision is the outcome of authorizing a request
+type Decision struct {
+	Allowed bool
+	// Role is the role granting the permission, when allowed
+	Role string
+	// Reason is why the request is denied
+	Reason string
+}
+
+// Options configures an Authorizer
+type Options struct {
+	// Roles returns the roles of a principal. It defaults to the roles attribute of
+	// the principal, like the roles claim of a JWT, as a list or a space separated
+	// string.
+	Roles func(*rebar.Principal) []string
+}
+
+func (o Options) valuesOrDefaults() Options {
+	if o.Roles == nil {
+		o.Roles = rolesAttribute
+	}
+	return o
+}
+
+// Authorizer decides whether requests are allowed by a policy, which can be
+// replaced at runtime
+type Authorizer struct {
+	opts   Options
+	mu     sync.RWMutex
+	policy Policy
+}
+
+// New creates an authorizer for a policy, or returns an error when the policy is
+// not valid
+func New(policy Policy, opts Options) (*Authorizer, error) {
+	a := &Authorizer{opts: opts.valuesOrDefaults()}
+	if err := a.SetPolicy(policy); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// SetPolicy replaces the policy of the authorizer. The policy is kept when the new
+// one is not valid.
+func (a *Authorizer) SetPolicy(policy Policy) error {
+	if err := policy.validate(); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.policy = policy
+	return nil
+}
+
+// LoadPolicy reads a policy from a YAML or JSON file
+func LoadPolicy(path string) (Policy, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return Policy{}, fmt.Errorf("authz: %w", err)
+	}
+	var policy Policy
+	if err := yaml.UnmarshalStrict(raw, &policy); err != nil {
+		return Policy{}, fmt.Errorf("authz: invalid policy %s: %w", path, err)
+	}
+	return policy, policy.validate()
+}
+
+// Decide returns whether the principal of the request is allowed the action on the
+// resource, by any permission of its roles. Requests are denied unless a
+// permission allows them.
+func (a *Authorizer) Decide(req Request) Decision {
+	return a.decide(req, false)
+}
+
+// decide is Decide, skipping the conditions on the resource when coarse, as they are
+// checked once the resource is loaded
+func (a *Authorizer) decide(req Request, coarse bool) Decision {
+	if req.Principal == nil {
+		return Decision{Reason: "not authenticated"}
+	}
+	roles := a.opts.Roles(req.Principal)
+	if len(roles) == 0 {
+		return Decision{Reason: fmt.Sprintf("%s has no role", req.Principal.Subject)}
+	}
+	a.mu.RLock()
+	policy := a.policy
+	a.mu.RUnlock()
+
+	var unmet []string
+	for _, role := range roles {
+		for _, permission := range policy.Roles[role] {
+			if !permission.allows(req.Action, req.Resource.Type) {
+				continue
+			}
+			if err := permission.check(req, coarse); err != nil {
+				unmet = append(unmet, fmt.Sprintf("role %s: %s", role, err))
+				continue
+			}
+			return Decision{Allowed: true, Role: role}
+		}
+	}
+	if len(unmet) > 0 {
+		return Decision{Reason: strings.Join(unmet, "; ")}
+	}
+	resource := req.Resource.Type
+	if resource == "" {
+		resource = "any resource"
+	}
+	return Decision{Reason: fmt.Sprintf("no permission of roles %s allows %s on %s",
+		strings.Join(roles, ", "), req.Action, resource)}
+}
+
+func (p Permission) allows(action, resource string) bool {
+	actionOK := p.Action == "*" || p.Action == action ||
+		strings.HasSuffix(p.Action, "*") && strings.HasPrefix(action, strings.TrimSuffix(p.Action, "*"))
+	resourceOK := p.Resource == "" || p.Resource == "*" || p.Resource == resource
+	return actionOK && resourceOK
+}
+
+func (p Permission) check(req Request, coarse bool) error {
+	for _, condition := range p.When {
+		if coarse && condition.onResource() {
+			continue
+		}
+		if err := condition.check(req); err != nil {
+			return err
+		}
+	}
+	if p.Check != nil {
+		return p.Check(req)
+	}
+	return nil
+}
+
+func (c Condition) check(req Request) error {
+	value, ok := req.Attribute(c.Attribute)
+	if !ok {
+		return fmt.Errorf("%s is not set", c.Attribute)
+	}
+	values := stringValues(value)
+	switch {
+	case c.Equals != "":
+		if !anyIn(values, c.Equals) {
+			return fmt.Errorf("%s is not %s", c.Attribute, c.Equals)
+		}
+	case len(c.In) > 0:
+		if !anyIn(values, c.In...) {
+			return fmt.Errorf("%s is not one of %s", c.Attribute, strings.Join(c.In, ", "))
+		}
+	default:
+		other, ok := req.Attribute(c.EqualsAttribute)
+		if !ok {
+			return fmt.Errorf("%s is not set", c.EqualsAttribute)
+		}
+		if !anyIn(values, stringValues(other)...) {
+			return fmt.Errorf("%s does not equal %s", c.Attribute, c.EqualsAttribute)
+		}
+	}
+	return nil
+}
+
+// onResource returns whether the condition compares an attribute of the resource
+// other than its type, which only handlers can check
+func (c Condition) onResource() bool {
+	for _, name := range []string{c.Attribute, c.EqualsAttribute} {
+		if strings.HasPrefix(name, "resource.") && name != "resource.type" {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Policy) validate() error {
+	for role, permissions := range p.Roles {
+		for i, permission := range permissions {
+			if permission.Action == "" {
+				return fmt.Errorf("authz: permission %d of role %s needs an action", i, role)
+			}
+			for j, condition := range permission.When {
+				if err := condition.validate(); err != nil {
+					return fmt.Errorf("authz: condition %d of permission %d of role %s: %w", j, i, role, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (c Condition) validate() error {
+	if !validAttribute(c.Attribute) {
+		return fmt.Errorf("unknown attribute %q", c.Attribute)
+	}
+	operators := 0
+	for _, set := range []bool{c.Equals != "", len(c.In) > 0, c.EqualsAttribute != ""} {
+		if set {
+			operators++
+		}
+	}
+	if operators != 1 {
+		return errors.New("needs one of equals, in or equals_attribute")
+	}
+	if c.EqualsAttribute != "" && !validAttribute(c.EqualsAttribute) {
+		return fmt.Errorf("unknown attribute %q", c.EqualsAttribute)
+	}
+	return nil
+}
+
+func validAttribute(name string) bool {
+	scope, key, _ := strings.Cut(name, ".")
+	return key != "" && (scope == "principal" || scope == "param" || scope == "resource")
+}
+
+func rolesAttribute(principal *rebar.Principal) []string {
+	switch roles := principal.Attributes["roles"].(type) {
+	case string:
+		return strings.Fields(roles)
+	case nil:
+		return nil
+	default:
+		return stringValues(roles)
+	}
+}
+
+// stringValues returns the values of an attribute as strings, skipping nil values
+func stringValues(value interface{}) []string {
+	switch value := value.(type) {
+	case []string:
+		return value
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			values = append(values, stringValues(v)...)
+		}
+		return values
+	case nil:
+		return nil
+	case float64:
+		// numeric claims of a JWT are decoded as float64, formatted like integers
+		// when they are
+		return []string{strconv.FormatFloat(value, 'f', -1, 64)}
+	case float32:
+		return []string{strconv.FormatFloat(float64(value), 'f', -1, 32)}
+	}
+	return []string{fmt.Sprint(value)}
+}
+
+func anyIn(values []string, accepted ...string) bool {
+	for _, value := range values {
+		for _, a := range accepted {
+			if value == a {
+				return true
+			}
+		}
+	}
+	return false
+}
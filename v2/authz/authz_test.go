@@ -0,0 +1,311 @@
+package authz_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/masonhubco/rebar/v2"
+	"github.com/masonhubco/rebar/v2/authz"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testPolicy = authz.Policy{Roles: map[string][]authz.Permission{
+	"admin": {{Action: "*"}},
+	"clerk": {
+		{Action: "orders:read", Resource: "order"},
+		{Action: "orders:update", Resource: "order", When: []authz.Condition{
+			{Attribute: "resource.owner", EqualsAttribute: "principal.subject"},
+		}},
+	},
+	"regional": {{Action: "orders:*", When: []authz.Condition{
+		{Attribute: "param.region", In: []string{"us", "eu"}},
+		{Attribute: "principal.tenant", Equals: "acme"},
+	}}},
+	"user": {{Action: "users:read", When: []authz.Condition{
+		{Attribute: "param.id", EqualsAttribute: "principal.user_id"},
+	}}},
+	"manager": {{Action: "reports:read", When: []authz.Condition{
+		{Attribute: "resource.manager", EqualsAttribute: "principal.manager"},
+	}}},
+	"auditor": {{Action: "orders:read", Check: func(req authz.Request) error {
+		if req.Resource.Attributes["archived"] == true {
+			return errors.New("archived orders are not audited")
+		}
+		return nil
+	}}},
+}}
+
+func Test_Authorizer_Decide(t *testing.T) {
+	t.Parallel()
+
+	authorizer, err := authz.New(testPolicy, authz.Options{})
+	require.NoError(t, err)
+
+	principal := func(roles interface{}, attributes ...string) *rebar.Principal {
+		p := &rebar.Principal{Subject: "jane", Type: rebar.PrincipalJWT, Attributes: map[string]interface{}{"roles": roles}}
+		for i := 0; i+1 < len(attributes); i += 2 {
+			p.Attributes[attributes[i]] = attributes[i+1]
+		}
+		return p
+	}
+	order := func(owner string) authz.Resource {
+		return authz.Resource{Type: "order", ID: "o-1", Attributes: map[string]interface{}{"owner": owner}}
+	}
+
+	tests := []struct {
+		name  string
+		given authz.Request
+		want  authz.Decision
+	}{
+		{
+			name:  "not authenticated",
+			given: authz.Request{Action: "orders:read"},
+			want:  authz.Decision{Reason: "not authenticated"},
+		},
+		{
+			name:  "no role",
+			given: authz.Request{Principal: &rebar.Principal{Subject: "jane"}, Action: "orders:read"},
+			want:  authz.Decision{Reason: "jane has no role"},
+		},
+		{
+			name:  "wildcard action",
+			given: authz.Request{Principal: principal("admin"), Action: "users:delete"},
+			want:  authz.Decision{Allowed: true, Role: "admin"},
+		},
+		{
+			name:  "roles as a list of claims",
+			given: authz.Request{Principal: principal([]interface{}{"auditor", "clerk"}), Action: "orders:read", Resource: order("bob")},
+			want:  authz.Decision{Allowed: true, Role: "auditor"},
+		},
+		{
+			name:  "action not allowed",
+			given: authz.Request{Principal: principal("clerk auditor"), Action: "orders:delete", Resource: order("jane")},
+			want:  authz.Decision{Reason: "no permission of roles clerk, auditor allows orders:delete on order"},
+		},
+		{
+			name:  "resource type not allowed",
+			given: authz.Request{Principal: principal("clerk"), Action: "orders:read", Resource: authz.Resource{Type: "invoice"}},
+			want:  authz.Decision{Reason: "no permission of roles clerk allows orders:read on invoice"},
+		},
+		{
+			name:  "owner of the resource",
+			given: authz.Request{Principal: principal("clerk"), Action: "orders:update", Resource: order("jane")},
+			want:  authz.Decision{Allowed: true, Role: "clerk"},
+		},
+		{
+			name:  "not the owner of the resource",
+			given: authz.Request{Principal: principal("clerk"), Action: "orders:update", Resource: order("bob")},
+			want:  authz.Decision{Reason: "role clerk: resource.owner does not equal principal.subject"},
+		},
+		{
+			name:  "resource not loaded",
+			given: authz.Request{Principal: principal("clerk"), Action: "orders:update", Resource: authz.Resource{Type: "order"}},
+			want:  authz.Decision{Reason: "role clerk: resource.owner is not set"},
+		},
+		{
+			name: "route param and principal attribute",
+			given: authz.Request{Principal: principal("regional", "tenant", "acme"), Action: "orders:update",
+				Params: gin.Params{{Key: "region", Value: "eu"}}},
+			want: authz.Decision{Allowed: true, Role: "regional"},
+		},
+		{
+			name: "route param not allowed",
+			given: authz.Request{Principal: principal("regional", "tenant", "acme"), Action: "orders:update",
+				Params: gin.Params{{Key: "region", Value: "apac"}}},
+			want: authz.Decision{Reason: "role regional: param.region is not one of us, eu"},
+		},
+		{
+			name: "principal attribute not allowed",
+			given: authz.Request{Principal: principal("regional", "tenant", "globex"), Action: "orders:update",
+				Params: gin.Params{{Key: "region", Value: "us"}}},
+			want: authz.Decision{Reason: "role regional: principal.tenant is not acme"},
+		},
+		{
+			name: "numeric claim matching a route param",
+			given: authz.Request{
+				Principal: &rebar.Principal{Subject: "jane", Attributes: map[string]interface{}{
+					"roles": "user", "user_id": float64(1234567),
+				}},
+				Action: "users:read",
+				Params: gin.Params{{Key: "id", Value: "1234567"}},
+			},
+			want: authz.Decision{Allowed: true, Role: "user"},
+		},
+		{
+			name: "numeric claim not matching a route param",
+			given: authz.Request{
+				Principal: &rebar.Principal{Subject: "jane", Attributes: map[string]interface{}{
+					"roles": "user", "user_id": float64(1234567),
+				}},
+				Action: "users:read",
+				Params: gin.Params{{Key: "id", Value: "1234568"}},
+			},
+			want: authz.Decision{Reason: "role user: param.id does not equal principal.user_id"},
+		},
+		{
+			name: "null attributes are not set",
+			given: authz.Request{
+				Principal: &rebar.Principal{Subject: "jane", Attributes: map[string]interface{}{
+					"roles": "manager", "manager": nil,
+				}},
+				Action:   "reports:read",
+				Resource: authz.Resource{Type: "report", Attributes: map[string]interface{}{"manager": nil}},
+			},
+			want: authz.Decision{Reason: "role manager: resource.manager is not set"},
+		},
+		{
+			name: "null values in a list are skipped",
+			given: authz.Request{
+				Principal: &rebar.Principal{Subject: "jane", Attributes: map[string]interface{}{
+					"roles": "manager", "manager": []interface{}{nil},
+				}},
+				Action:   "reports:read",
+				Resource: authz.Resource{Type: "report", Attributes: map[string]interface{}{"manager": []interface{}{nil}}},
+			},
+			want: authz.Decision{Reason: "role manager: resource.manager does not equal principal.manager"},
+		},
+		{
+			name: "check written in go",
+			given: authz.Request{Principal: principal("auditor"), Action: "orders:read",
+				Resource: authz.Resource{Type: "order", Attributes: map[string]interface{}{"archived": true}}},
+			want: authz.Decision{Reason: "role auditor: archived orders are not audited"},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.want, authorizer.Decide(tc.given))
+		})
+	}
+}
+
+func Test_Authorizer_Roles(t *testing.T) {
+	t.Parallel()
+
+	authorizer, err := authz.New(testPolicy, authz.Options{
+		Roles: func(principal *rebar.Principal) []string {
+			if principal.Type == rebar.PrincipalSystemToken {
+				return []string{"admin"}
+			}
+			return nil
+		},
+	})
+	require.NoError(t, err)
+
+	decision := authorizer.Decide(authz.Request{
+		Principal: &rebar.Principal{Subject: "billing", Type: rebar.PrincipalSystemToken},
+		Action:    "orders:delete",
+	})
+	assert.Equal(t, authz.Decision{Allowed: true, Role: "admin"}, decision)
+}
+
+func Test_Authorizer_SetPolicy(t *testing.T) {
+	t.Parallel()
+
+	authorizer, err := authz.New(testPolicy, authz.Options{})
+	require.NoError(t, err)
+	request := authz.Request{
+		Principal: &rebar.Principal{Subject: "jane", Attributes: map[string]interface{}{"roles": "clerk"}},
+		Action:    "orders:read",
+		Resource:  authz.Resource{Type: "order"},
+	}
+	require.True(t, authorizer.Decide(request).Allowed)
+
+	invalid := authz.Policy{Roles: map[string][]authz.Permission{"clerk": {{Resource: "order"}}}}
+	assert.EqualError(t, authorizer.SetPolicy(invalid), "authz: permission 0 of role clerk needs an action")
+	assert.True(t, authorizer.Decide(request).Allowed)
+
+	require.NoError(t, authorizer.SetPolicy(authz.Policy{}))
+	assert.False(t, authorizer.Decide(request).Allowed)
+}
+
+func Test_LoadPolicy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		givenFile  string
+		wantPolicy authz.Policy
+		wantErr    string
+	}{
+		{
+			name: "valid policy",
+			givenFile: `
+roles:
+  admin:
+    - action: "*"
+  clerk:
+    - action: orders:update
+      resource: order
+      when:
+        - attribute: resource.owner
+          equals_attribute: principal.subject
+        - attribute: param.region
+          in: [us, eu]
+`,
+			wantPolicy: authz.Policy{Roles: map[string][]authz.Permission{
+				"admin": {{Action: "*"}},
+				"clerk": {{Action: "orders:update", Resource: "order", When: []authz.Condition{
+					{Attribute: "resource.owner", EqualsAttribute: "principal.subject"},
+					{Attribute: "param.region", In: []string{"us", "eu"}},
+				}}},
+			}},
+		},
+		{
+			name:      "json policy",
+			givenFile: `{"roles": {"admin": [{"action": "*"}]}}`,
+			wantPolicy: authz.Policy{Roles: map[string][]authz.Permission{
+				"admin": {{Action: "*"}},
+			}},
+		},
+		{
+			name:      "unknown attribute",
+			givenFile: "roles:\n  clerk:\n    - action: orders:read\n      when:\n        - attribute: owner\n          equals: jane\n",
+			wantErr:   `authz: condition 0 of permission 0 of role clerk: unknown attribute "owner"`,
+		},
+		{
+			name:      "condition without operator",
+			givenFile: "roles:\n  clerk:\n    - action: orders:read\n      when:\n        - attribute: resource.owner\n",
+			wantErr:   "authz: condition 0 of permission 0 of role clerk: needs one of equals, in or equals_attribute",
+		},
+		{
+			name:      "condition with several operators",
+			givenFile: "roles:\n  clerk:\n    - action: orders:read\n      when:\n        - attribute: resource.owner\n          equals: jane\n          in: [bob]\n",
+			wantErr:   "authz: condition 0 of permission 0 of role clerk: needs one of equals, in or equals_attribute",
+		},
+		{
+			name:      "unknown field",
+			givenFile: "roles:\n  clerk:\n    - actions: orders:read\n",
+			wantErr:   "authz: invalid policy",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "policy.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(tc.givenFile), 0o600))
+
+			policy, err := authz.LoadPolicy(path)
+			if tc.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantPolicy, policy)
+		})
+	}
+
+	_, err := authz.LoadPolicy(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
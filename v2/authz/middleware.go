@@ -0,0 +1,57 @@
+package authz
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/masonhubco/rebar/v2"
+	"go.uber.org/zap"
+)
+
+// Require returns a middleware for coarse checks, that lets requests through when
+// their principal is allowed action on resources of resourceType. Conditions on the
+// resource are skipped, as it isn't loaded yet, and handlers enforce them by calling
+// Authorize with the resource. Other requests are aborted with a 403.
+func (a *Authorizer) Require(action, resourceType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := a.authorize(c, action, Resource{Type: resourceType}, true); err != nil {
+			rebar.AbortWithError(c, http.StatusForbidden, err)
+			return
+		}
+		c.Next()
+	}
+}
+
+// Authorize is for fine-grained checks in handlers, once the resource is loaded. It
+// returns ErrForbidden unless the principal of the request is allowed action on
+// resource, and logs the reason of the denial with the request logger and the
+// request ID.
+func (a *Authorizer) Authorize(c *gin.Context, action string, resource Resource) error {
+	return a.authorize(c, action, resource, false)
+}
+
+func (a *Authorizer) authorize(c *gin.Context, action string, resource Resource, coarse bool) error {
+	principal, _ := rebar.PrincipalFrom(c)
+	decision := a.decide(Request{
+		Principal: principal,
+		Action:    action,
+		Resource:  resource,
+		Params:    c.Params,
+	}, coarse)
+	if decision.Allowed {
+		return nil
+	}
+	fields := []zap.Field{
+		zap.String("request_id", rebar.RequestIDFrom(c)),
+		zap.String("action", action),
+		zap.String("reason", decision.Reason),
+	}
+	if resource.Type != "" {
+		fields = append(fields, zap.String("resource", resource.Type))
+	}
+	if resource.ID != "" {
+		fields = append(fields, zap.String("resource_id", resource.ID))
+	}
+	rebar.LoggerFrom(c).Warn("authorization denied", fields...)
+	return ErrForbidden
+}
@@ -0,0 +1,138 @@
+package authz_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/masonhubco/rebar/v2"
+	"github.com/masonhubco/rebar/v2/authz"
+	"github.com/masonhubco/rebar/v2/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func Test_Authorizer_Middleware(t *testing.T) {
+	t.Parallel()
+
+	authorizer, err := authz.New(testPolicy, authz.Options{})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		givenRoles  string
+		givenPath   string
+		wantCode    int
+		wantBody    string
+		wantWarning map[string]interface{}
+	}{
+		{name: "allowed by the route", givenRoles: "regional", givenPath: "/regions/us/orders", wantCode: http.StatusOK},
+		{
+			name: "denied by the route", givenRoles: "regional", givenPath: "/regions/apac/orders",
+			wantCode: http.StatusForbidden,
+			wantBody: `{"request_id":"req-1","error":"forbidden"}`,
+			wantWarning: map[string]interface{}{
+				"request_id": "req-1",
+				"action":     "orders:list",
+				"resource":   "order",
+				"reason":     "role regional: param.region is not one of us, eu",
+			},
+		},
+		{name: "allowed by the handler", givenRoles: "clerk", givenPath: "/orders/jane", wantCode: http.StatusOK},
+		{
+			name: "denied by the handler", givenRoles: "clerk", givenPath: "/orders/bob",
+			wantCode: http.StatusForbidden,
+			wantBody: `{"request_id":"req-1","error":"forbidden"}`,
+			wantWarning: map[string]interface{}{
+				"request_id":  "req-1",
+				"action":      "orders:update",
+				"resource":    "order",
+				"resource_id": "order-of-bob",
+				"reason":      "role clerk: resource.owner does not equal principal.subject",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			core, logs := observer.New(zapcore.WarnLevel)
+			router := gin.New()
+			router.Use(middleware.Logger(zap.New(core)))
+			router.Use(func(c *gin.Context) {
+				rebar.SetPrincipal(c, &rebar.Principal{
+					Subject:    "jane",
+					Attributes: map[string]interface{}{"roles": tc.givenRoles, "tenant": "acme"},
+				})
+			})
+			router.GET("/regions/:region/orders", authorizer.Require("orders:list", "order"), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			// the condition of clerk on the owner is skipped by Require, and enforced by
+			// the handler
+			router.GET("/orders/:owner", authorizer.Require("orders:update", "order"), func(c *gin.Context) {
+				order := authz.Resource{
+					Type:       "order",
+					ID:         "order-of-" + c.Param("owner"),
+					Attributes: map[string]interface{}{"owner": c.Param("owner")},
+				}
+				if err := authorizer.Authorize(c, "orders:update", order); err != nil {
+					rebar.AbortWithError(c, http.StatusForbidden, err)
+					return
+				}
+				c.Status(http.StatusOK)
+			})
+
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tc.givenPath, nil)
+			req.Header.Set(middleware.RequestIDField, "req-1")
+			router.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.wantCode, rr.Code)
+			warnings := logs.FilterMessage("authorization denied").All()
+			if tc.wantWarning == nil {
+				assert.Empty(t, warnings)
+				return
+			}
+			assert.JSONEq(t, tc.wantBody, rr.Body.String())
+			require.Len(t, warnings, 1)
+			assert.Equal(t, tc.wantWarning, warnings[0].ContextMap())
+		})
+	}
+}
+
+func Test_Authorizer_DenialWithoutLoggerMiddleware(t *testing.T) {
+	t.Parallel()
+
+	authorizer, err := authz.New(testPolicy, authz.Options{})
+	require.NoError(t, err)
+
+	core, logs := observer.New(zapcore.WarnLevel)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		// a request logger without the request ID, and the ID set on its own
+		c.Set(rebar.LoggerKey, zap.New(core))
+		c.Set(rebar.RequestIDKey, "req-2")
+		rebar.SetPrincipal(c, &rebar.Principal{
+			Subject:    "jane",
+			Attributes: map[string]interface{}{"roles": "regional", "tenant": "acme"},
+		})
+	})
+	router.GET("/regions/:region/orders", authorizer.Require("orders:list", "order"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/regions/apac/orders", nil))
+
+	require.Equal(t, http.StatusForbidden, rr.Code)
+	warnings := logs.FilterMessage("authorization denied").All()
+	require.Len(t, warnings, 1)
+	assert.Equal(t, "req-2", warnings[0].ContextMap()["request_id"])
+}
@@ -0,0 +1,133 @@
+package rebar
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Build metadata set at link time, which takes precedence over what the Go
+// toolchain stamps in the binary. For example:
+//
+//	go build -ldflags "-X github.com/masonhubco/rebar/v2.Version=v1.2.3 \
+//		-X github.com/masonhubco/rebar/v2.Revision=$(git rev-parse HEAD) \
+//		-X github.com/masonhubco/rebar/v2.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	// Version defaults to the version of the main module, which is (devel) unless
+	// the binary was installed with go install pkg@version
+	Version string
+	// Revision defaults to the VCS revision stamped by the Go toolchain
+	Revision string
+	// BuildTime is only known when it's set at link time
+	BuildTime string
+)
+
+// processStart is when the process started, as far as uptime is concerned
+var processStart = time.Now()
+
+// BuildInfo describes the running binary
+type BuildInfo struct {
+	// Path is the import path of the main package
+	Path    string `json:"path,omitempty"`
+	Version string `json:"version,omitempty"`
+	// Revision is the VCS commit the binary was built from, and Modified whether the
+	// working tree had uncommitted changes
+	Revision   string `json:"revision,omitempty"`
+	Modified   bool   `json:"modified"`
+	CommitTime string `json:"commit_time,omitempty"`
+	BuildTime  string `json:"build_time,omitempty"`
+	GoVersion  string `json:"go_version"`
+	// Deps are the modules the binary was built with
+	Deps      []Module  `json:"deps,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	Uptime    string    `json:"uptime"`
+}
+
+// Module is a module dependency of the binary
+type Module struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	// Replace is the module replacing this one, if any
+	Replace *Module `json:"replace,omitempty"`
+}
+
+// ReadBuildInfo returns the build metadata of the running binary, read with
+// runtime/debug.ReadBuildInfo and overridden by Version, Revision and BuildTime
+// when they're set.
+func ReadBuildInfo() BuildInfo {
+	info := BuildInfo{
+		GoVersion: runtime.Version(),
+		StartedAt: processStart,
+		Uptime:    time.Since(processStart).Truncate(time.Second).String(),
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		info.Path = build.Path
+		info.Version = build.Main.Version
+		if build.GoVersion != "" {
+			info.GoVersion = build.GoVersion
+		}
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.Revision = setting.Value
+			case "vcs.modified":
+				info.Modified, _ = strconv.ParseBool(setting.Value)
+			case "vcs.time":
+				info.CommitTime = setting.Value
+			}
+		}
+		for _, dep := range build.Deps {
+			info.Deps = append(info.Deps, newModule(dep))
+		}
+	}
+	if Version != "" {
+		info.Version = Version
+	}
+	if Revision != "" {
+		info.Revision = Revision
+	}
+	if BuildTime != "" {
+		info.BuildTime = BuildTime
+	}
+	return info
+}
+
+func newModule(m *debug.Module) Module {
+	module := Module{Path: m.Path, Version: m.Version}
+	if m.Replace != nil {
+		replace := newModule(m.Replace)
+		module.Replace = &replace
+	}
+	return module
+}
+
+// fields returns the zap fields of the build info, leaving out the dependencies
+// and the empty ones
+func (b BuildInfo) fields() []zap.Field {
+	fields := []zap.Field{zap.String("go_version", b.GoVersion)}
+	if b.Version != "" {
+		fields = append(fields, zap.String("version", b.Version))
+	}
+	if b.Revision != "" {
+		fields = append(fields, zap.String("revision", b.Revision), zap.Bool("modified", b.Modified))
+	}
+	if b.CommitTime != "" {
+		fields = append(fields, zap.String("commit_time", b.CommitTime))
+	}
+	if b.BuildTime != "" {
+		fields = append(fields, zap.String("build_time", b.BuildTime))
+	}
+	return fields
+}
+
+// VersionHandler serves the build info of the running binary, with its uptime
+func (r *Rebar) VersionHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, ReadBuildInfo())
+	}
+}
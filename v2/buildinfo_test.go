@@ -0,0 +1,87 @@
+package rebar_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/masonhubco/rebar/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// Test_ReadBuildInfo is not parallel, because it sets the link time variables
+func Test_ReadBuildInfo(t *testing.T) {
+	tests := []struct {
+		name          string
+		givenVersion  string
+		givenRevision string
+		givenBuilt    string
+	}{
+		{name: "stamped by the toolchain"},
+		{name: "set at link time", givenVersion: "v1.2.3", givenRevision: "4f1c9e2", givenBuilt: "2021-09-01T10:00:00Z"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rebar.Version, rebar.Revision, rebar.BuildTime = tc.givenVersion, tc.givenRevision, tc.givenBuilt
+			defer func() { rebar.Version, rebar.Revision, rebar.BuildTime = "", "", "" }()
+
+			info := rebar.ReadBuildInfo()
+			assert.Equal(t, runtime.Version(), info.GoVersion)
+			assert.False(t, info.StartedAt.IsZero())
+			assert.NotEmpty(t, info.Uptime)
+			var gin bool
+			for _, dep := range info.Deps {
+				gin = gin || dep.Path == "github.com/gin-gonic/gin"
+			}
+			assert.True(t, gin, "dependencies should include gin")
+			if tc.givenVersion != "" {
+				assert.Equal(t, tc.givenVersion, info.Version)
+				assert.Equal(t, tc.givenRevision, info.Revision)
+				assert.Equal(t, tc.givenBuilt, info.BuildTime)
+			} else {
+				assert.Empty(t, info.BuildTime)
+			}
+		})
+	}
+}
+
+func Test_Rebar_VersionEndpoint(t *testing.T) {
+	t.Parallel()
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	r := rebar.New(rebar.Options{Environment: rebar.Test, Port: freePort(t), AdminPort: freePort(t),
+		Logger: zap.New(core)})
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- r.RunWithContext(ctx, stop)
+	}()
+	require.Eventually(t, func() bool { return r.Phase() == rebar.PhaseRunning },
+		2*time.Second, 10*time.Millisecond)
+
+	rr := httptest.NewRecorder()
+	r.Admin.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/version", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var info rebar.BuildInfo
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &info))
+	assert.Equal(t, runtime.Version(), info.GoVersion)
+	assert.NotEmpty(t, info.Deps)
+	assert.NotEmpty(t, info.Uptime)
+
+	stop()
+	require.NoError(t, <-done)
+
+	// the build info is logged once, when the app is starting
+	logged := logs.FilterField(zap.String("go_version", runtime.Version())).All()
+	require.Len(t, logged, 1)
+	assert.Equal(t, "rebar is starting", logged[0].Message)
+}
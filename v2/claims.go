@@ -0,0 +1,44 @@
+package rebar
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Claims are the claims of a verified JWT, set in the gin context by the JWT
+// middleware
+type Claims struct {
+	Issuer    string
+	Subject   string
+	Audience  []string
+	ID        string
+	ExpiresAt *time.Time
+	NotBefore *time.Time
+	IssuedAt  *time.Time
+	// Raw holds every claim of the token as decoded from JSON, the registered
+	// ones included
+	Raw map[string]interface{}
+}
+
+// String returns the named claim when it's a string
+func (c Claims) String(name string) (string, bool) {
+	s, ok := c.Raw[name].(string)
+	return s, ok
+}
+
+// ClaimsFrom returns the claims of the request token, verified by the JWT middleware
+func ClaimsFrom(c *gin.Context) (claims *Claims, ok bool) {
+	if maybeClaims, exists := c.Get(ClaimsKey); exists {
+		claims, ok = maybeClaims.(*Claims)
+	}
+	return
+}
+
+// ClaimsMustFrom is like ClaimsFrom, but panics when the request has no claims
+func ClaimsMustFrom(c *gin.Context) *Claims {
+	if claims, exists := ClaimsFrom(c); exists {
+		return claims
+	}
+	panic(`"` + ClaimsKey + `" does not exist in context`)
+}
@@ -0,0 +1,82 @@
+package rebar_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/masonhubco/rebar/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ClaimsFrom(t *testing.T) {
+	t.Parallel()
+
+	claims := &rebar.Claims{Subject: "user-1", Raw: map[string]interface{}{"sub": "user-1", "admin": true}}
+
+	tests := []struct {
+		name       string
+		mock       func(*gin.Context)
+		wantClaims *rebar.Claims
+		isItOk     bool
+	}{
+		{
+			name:       "context does not have claims",
+			mock:       func(ctx *gin.Context) {},
+			wantClaims: nil,
+			isItOk:     false,
+		},
+		{
+			name: "context has claims but they are not rebar claims",
+			mock: func(ctx *gin.Context) {
+				ctx.Set(rebar.ClaimsKey, map[string]interface{}{"sub": "user-1"})
+			},
+			wantClaims: nil,
+			isItOk:     false,
+		},
+		{
+			name: "happy path and context has claims",
+			mock: func(ctx *gin.Context) {
+				ctx.Set(rebar.ClaimsKey, claims)
+			},
+			wantClaims: claims,
+			isItOk:     true,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			resp := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(resp)
+			tc.mock(ctx)
+
+			gotClaims, ok := rebar.ClaimsFrom(ctx)
+
+			require.Equal(t, tc.isItOk, ok)
+			assert.Equal(t, tc.wantClaims, gotClaims)
+			if ok {
+				assert.Same(t, gotClaims, rebar.ClaimsMustFrom(ctx))
+			} else {
+				assert.Panics(t, func() { rebar.ClaimsMustFrom(ctx) })
+			}
+		})
+	}
+}
+
+func Test_Claims_String(t *testing.T) {
+	t.Parallel()
+
+	claims := rebar.Claims{Raw: map[string]interface{}{"email": "jane@example.com", "admin": true}}
+
+	email, ok := claims.String("email")
+	assert.True(t, ok)
+	assert.Equal(t, "jane@example.com", email)
+	_, ok = claims.String("admin")
+	assert.False(t, ok)
+	_, ok = claims.String("missing")
+	assert.False(t, ok)
+}
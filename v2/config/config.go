@@ -0,0 +1,517 @@
+// Package config loads a configuration struct, rebar.Options included, from layered
+// sources. Each source overrides the previous ones:
+//
+//  1. defaults, from the default tag
+//  2. YAML or JSON files, in the order they're given
+//  3. environment variables, optionally prefixed
+//  4. command-line flags
+//
+// Fields are named after the snake case of the Go field name, or the config tag:
+// ShutDownWait is shut_down_wait in files, APP_SHUT_DOWN_WAIT with the APP prefix in
+// the environment, and -shut-down-wait on the command line. Nested structs add their
+// own name to their fields' names: tls.cert_file in files, APP_TLS_CERT_FILE and
+// -tls.cert-file. Embedded structs are flattened.
+//
+// Supported tags:
+//
+//	config:"name"     overrides the name of the field, config:"-" ignores it
+//	default:"30s"     the value used when no source sets the field
+//	required:"true"   fails loading when no source sets the field
+//	oneof:"a,b"       fails loading when the value is not one of the listed values
+//	secret:"true"     redacts the value in Dump
+//	usage:"..."       the usage of the command-line flag
+//
+// Strings, booleans, numbers, time.Duration, encoding.TextUnmarshaler implementations
+// and slices of those are supported, slices being comma separated in the environment
+// and on the command line. Fields of other types, like functions and interfaces, are
+// ignored. Once loaded, structs implementing Validator are validated.
+package config
+
+import (
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Validator is implemented by configuration structs that validate themselves once
+// loaded
+type Validator interface {
+	Validate() error
+}
+
+// Option configures Load
+type Option func(*loader)
+
+// EnvPrefix sets the prefix of environment variables. With APP, the port field is
+// read from APP_PORT.
+func EnvPrefix(prefix string) Option {
+	return func(l *loader) {
+		l.envPrefix = prefix
+	}
+}
+
+// LookupEnv replaces os.LookupEnv to read environment variables
+func LookupEnv(lookup func(string) (string, bool)) Option {
+	return func(l *loader) {
+		l.lookupEnv = lookup
+	}
+}
+
+// Files reads YAML (.yaml, .yml) or JSON (.json) files. Files that don't exist are
+// errors.
+func Files(paths ...string) Option {
+	return func(l *loader) {
+		l.files = append(l.files, paths...)
+	}
+}
+
+// Flags defines a flag for every field on fs, and parses args with it. fs must not be
+// parsed yet.
+func Flags(fs *flag.FlagSet, args []string) Option {
+	return func(l *loader) {
+		l.flags = fs
+		l.args = args
+	}
+}
+
+// Errors is every error found while loading a configuration
+type Errors []error
+
+func (e Errors) Error() string {
+	if len(e) == 1 {
+		return "config: " + e[0].Error()
+	}
+	var buffer strings.Builder
+	fmt.Fprintf(&buffer, "config: %d errors", len(e))
+	for _, err := range e {
+		fmt.Fprintf(&buffer, "\n  - %s", err)
+	}
+	return buffer.String()
+}
+
+// Is reports whether any of the errors is target
+func (e Errors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrRequired is wrapped by the errors of required fields no source set
+var ErrRequired = errors.New("required")
+
+// FieldError is an invalid value given to a field
+type FieldError struct {
+	Field  string
+	Source string
+	Err    error
+}
+
+func (e *FieldError) Error() string {
+	if e.Source == "" {
+		return fmt.Sprintf("%s: %s", e.Field, e.Err)
+	}
+	return fmt.Sprintf("%s (from %s): %s", e.Field, e.Source, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+type loader struct {
+	envPrefix string
+	lookupEnv func(string) (string, bool)
+	files     []string
+	flags     *flag.FlagSet
+	args      []string
+}
+
+// Load fills dst, a pointer to a struct, from the sources. All the errors found are
+// returned at once, as Errors.
+func Load(dst interface{}, opts ...Option) error {
+	l := loader{lookupEnv: os.LookupEnv}
+	for _, opt := range opts {
+		opt(&l)
+	}
+
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return Errors{fmt.Errorf("a pointer to a struct is required, not %T", dst)}
+	}
+	fields := walk(v.Elem(), nil, nil)
+
+	var errs Errors
+	for _, f := range fields {
+		if f.hasDefault {
+			if err := f.parse(f.def, "default"); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	for _, path := range l.files {
+		errs = append(errs, loadFile(path, fields)...)
+	}
+	for _, f := range fields {
+		name := f.envName(l.envPrefix)
+		if value, ok := l.lookupEnv(name); ok {
+			if err := f.set(value, "env "+name); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if l.flags != nil {
+		errs = append(errs, parseFlags(l.flags, l.args, fields)...)
+	}
+
+	for _, f := range fields {
+		if !f.optional.isSet() {
+			// the struct is left nil, so its fields don't need to be valid
+			continue
+		}
+		if f.required && !f.fromSource && !f.hasDefault {
+			errs = append(errs, &FieldError{Field: f.name(), Err: ErrRequired})
+		}
+		if err := f.checkOneOf(); err != nil && (f.fromSource || f.hasDefault) {
+			errs = append(errs, err)
+		}
+	}
+	resetUnset(fields)
+	errs = append(errs, validate(v)...)
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+type field struct {
+	path       []string
+	value      reflect.Value
+	hasDefault bool
+	def        string
+	required   bool
+	secret     bool
+	oneOf      []string
+	usage      string
+	// fromSource is true once a file, the environment or a flag set the field
+	fromSource bool
+	// optional is the nil pointer to a struct the field belongs to, if any, reset
+	// to nil when none of its fields was set
+	optional *optionalStruct
+}
+
+type optionalStruct struct {
+	ptr    reflect.Value
+	parent *optionalStruct
+	set    bool
+}
+
+// isSet reports whether the struct is kept, which is always the case when the
+// field doesn't belong to an optional struct
+func (o *optionalStruct) isSet() bool {
+	return o == nil || o.set
+}
+
+var (
+	durationType      = reflect.TypeOf(time.Duration(0))
+	textUnmarshalType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// walk lists the supported fields of the struct v
+func walk(v reflect.Value, path []string, optional *optionalStruct) []*field {
+	var fields []*field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fv := v.Field(i)
+		tag := sf.Tag.Get("config")
+		if tag == "-" || !fv.CanSet() {
+			continue
+		}
+		fieldPath := append(path[:len(path):len(path)], fieldName(sf))
+
+		if sf.Anonymous && tag == "" && fv.Kind() == reflect.Struct {
+			fields = append(fields, walk(fv, path, optional)...)
+			continue
+		}
+		if !isValue(fv.Type()) {
+			switch {
+			case fv.Kind() == reflect.Struct:
+				fields = append(fields, walk(fv, fieldPath, optional)...)
+			case fv.Kind() == reflect.Ptr && fv.Type().Elem().Kind() == reflect.Struct:
+				inner := optional
+				if fv.IsNil() {
+					fv.Set(reflect.New(fv.Type().Elem()))
+					inner = &optionalStruct{ptr: fv, parent: optional}
+				}
+				nested := walk(fv.Elem(), fieldPath, inner)
+				if len(nested) == 0 && inner != optional {
+					// no source can set the struct, so it's put back to nil right away
+					fv.Set(reflect.Zero(fv.Type()))
+				}
+				fields = append(fields, nested...)
+			}
+			continue
+		}
+
+		f := &field{
+			path:     fieldPath,
+			value:    fv,
+			required: sf.Tag.Get("required") == "true",
+			secret:   sf.Tag.Get("secret") == "true" || isSecretName(sf.Name),
+			usage:    sf.Tag.Get("usage"),
+			optional: optional,
+		}
+		f.def, f.hasDefault = sf.Tag.Lookup("default")
+		if oneOf := sf.Tag.Get("oneof"); oneOf != "" {
+			f.oneOf = strings.Split(oneOf, ",")
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// isValue reports whether t is set from a single value, or a list of values
+func isValue(t reflect.Type) bool {
+	if reflect.PtrTo(t).Implements(textUnmarshalType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() != reflect.Slice && isValue(t.Elem())
+	}
+	return false
+}
+
+func (f *field) name() string {
+	return strings.Join(f.path, ".")
+}
+
+func (f *field) envName(prefix string) string {
+	name := strings.ToUpper(strings.Join(f.path, "_"))
+	if prefix != "" {
+		name = strings.ToUpper(prefix) + "_" + name
+	}
+	return name
+}
+
+func (f *field) flagName() string {
+	return strings.ReplaceAll(f.name(), "_", "-")
+}
+
+// set sets the field from a source
+func (f *field) set(value, source string) error {
+	if err := f.parse(value, source); err != nil {
+		return err
+	}
+	f.markSet()
+	return nil
+}
+
+// setList sets a slice field from a source giving a list of values
+func (f *field) setList(values []string, source string) error {
+	if err := f.parseList(values, source); err != nil {
+		return err
+	}
+	f.markSet()
+	return nil
+}
+
+// parse parses a value given as a string, lists being comma separated
+func (f *field) parse(value, source string) error {
+	if f.isList() {
+		var values []string
+		if value != "" {
+			values = strings.Split(value, ",")
+		}
+		for i := range values {
+			values[i] = strings.TrimSpace(values[i])
+		}
+		return f.parseList(values, source)
+	}
+	if err := setValue(f.value, value); err != nil {
+		return &FieldError{Field: f.name(), Source: source, Err: err}
+	}
+	return nil
+}
+
+func (f *field) parseList(values []string, source string) error {
+	slice := reflect.MakeSlice(f.value.Type(), len(values), len(values))
+	for i, value := range values {
+		if err := setValue(slice.Index(i), value); err != nil {
+			return &FieldError{Field: f.name(), Source: source, Err: err}
+		}
+	}
+	f.value.Set(slice)
+	return nil
+}
+
+func (f *field) isList() bool {
+	return f.value.Kind() == reflect.Slice && !reflect.PtrTo(f.value.Type()).Implements(textUnmarshalType)
+}
+
+func (f *field) markSet() {
+	f.fromSource = true
+	for o := f.optional; o != nil; o = o.parent {
+		o.set = true
+	}
+}
+
+func (f *field) checkOneOf() error {
+	if len(f.oneOf) == 0 || f.isList() {
+		return nil
+	}
+	value := fmt.Sprint(f.value.Interface())
+	for _, allowed := range f.oneOf {
+		if value == allowed {
+			return nil
+		}
+	}
+	return &FieldError{
+		Field: f.name(),
+		Err:   fmt.Errorf("%q is not one of %s", value, strings.Join(f.oneOf, ", ")),
+	}
+}
+
+func setValue(v reflect.Value, value string) error {
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 0, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 0, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid unsigned integer %q", value)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// resetUnset puts back nil pointers to structs none of the sources filled
+func resetUnset(fields []*field) {
+	for _, f := range fields {
+		if !f.optional.isSet() {
+			f.optional.ptr.Set(reflect.Zero(f.optional.ptr.Type()))
+		}
+	}
+}
+
+// validate calls Validate on v and the structs it contains, outermost last
+func validate(v reflect.Value) Errors {
+	var errs Errors
+	elem := v
+	if elem.Kind() == reflect.Ptr {
+		if elem.IsNil() {
+			return nil
+		}
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct {
+		return nil
+	}
+	for i := 0; i < elem.NumField(); i++ {
+		fv := elem.Field(i)
+		if !fv.CanSet() || elem.Type().Field(i).Tag.Get("config") == "-" {
+			continue
+		}
+		switch {
+		case fv.Kind() == reflect.Struct:
+			errs = append(errs, validate(fv.Addr())...)
+		case fv.Kind() == reflect.Ptr && fv.Type().Elem().Kind() == reflect.Struct:
+			errs = append(errs, validate(fv)...)
+		}
+	}
+	if validator, ok := v.Interface().(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			var nested Errors
+			if errors.As(err, &nested) {
+				return append(errs, nested...)
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// fieldName is the name of a field in the sources
+func fieldName(sf reflect.StructField) string {
+	if tag := sf.Tag.Get("config"); tag != "" {
+		return tag
+	}
+	return snakeCase(sf.Name)
+}
+
+// snakeCase turns a Go field name into its configuration name, keeping acronyms
+// together: ClientCAFile is client_ca_file.
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// isSecretName reports whether a field is redacted even without the secret tag
+func isSecretName(name string) bool {
+	name = strings.ToLower(name)
+	for _, secret := range []string{"token", "password", "secret"} {
+		if strings.Contains(name, secret) {
+			return true
+		}
+	}
+	return false
+}
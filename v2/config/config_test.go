@@ -0,0 +1,167 @@
+package config_test
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/masonhubco/rebar/v2"
+	"github.com/masonhubco/rebar/v2/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type database struct {
+	URL      string `required:"true" secret:"true"`
+	MaxConns int    `default:"10"`
+}
+
+type appConfig struct {
+	rebar.Options
+	SystemToken string
+	LogLevel    string        `default:"info" oneof:"debug,info,warn,error"`
+	Timeout     time.Duration `default:"5s"`
+	Queues      []string      `default:"default"`
+	Database    database
+	Cache       *cache
+}
+
+type cache struct {
+	Addr string `required:"true"`
+	TTL  time.Duration
+}
+
+func (c appConfig) Validate() error {
+	if c.Timeout > time.Minute {
+		return errors.New("timeout must be at most 1m")
+	}
+	return nil
+}
+
+func env(vars map[string]string) config.Option {
+	return config.LookupEnv(func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	})
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func Test_Load(t *testing.T) {
+	t.Parallel()
+
+	file := writeFile(t, "app.yaml", `
+port: "8080"
+environment: staging
+log_level: debug
+shut_down_wait: 45s
+database:
+  url: postgres://file
+  max_conns: 20
+tls:
+  cert_dir: /etc/tls
+`)
+	fs := flag.NewFlagSet("app", flag.ContinueOnError)
+	var cfg appConfig
+	err := config.Load(&cfg,
+		config.Files(file),
+		config.EnvPrefix("app"),
+		env(map[string]string{
+			"APP_PORT":             "9090",
+			"APP_DATABASE_URL":     "postgres://env",
+			"APP_QUEUES":           "emails, reports",
+			"APP_SYSTEM_TOKEN":     "token",
+			"APP_HEALTH_DISABLED":  "true",
+			"UNPREFIXED_LOG_LEVEL": "error",
+		}),
+		config.Flags(fs, []string{"-log-level", "warn", "-graceful-upgrade"}),
+	)
+	require.NoError(t, err)
+
+	// defaults < files < environment < flags
+	assert.Equal(t, "9090", cfg.Port)
+	assert.Equal(t, "staging", cfg.Environment)
+	assert.Equal(t, "warn", cfg.LogLevel)
+	assert.Equal(t, 45*time.Second, cfg.ShutDownWait)
+	assert.Equal(t, 5*time.Second, cfg.Timeout)
+	assert.Equal(t, []string{"emails", "reports"}, cfg.Queues)
+	assert.Equal(t, "postgres://env", cfg.Database.URL)
+	assert.Equal(t, 20, cfg.Database.MaxConns)
+	assert.Equal(t, "token", cfg.SystemToken)
+	assert.True(t, cfg.Health.Disabled)
+	assert.True(t, cfg.GracefulUpgrade)
+	require.NotNil(t, cfg.TLS)
+	assert.Equal(t, "/etc/tls", cfg.TLS.CertDir)
+	// pointers to structs no source set are left nil
+	assert.Nil(t, cfg.Cache)
+}
+
+func Test_Load_Errors(t *testing.T) {
+	t.Parallel()
+
+	var cfg appConfig
+	err := config.Load(&cfg, env(map[string]string{
+		"LOG_LEVEL":          "verbose",
+		"TIMEOUT":            "2h",
+		"DATABASE_MAX_CONNS": "many",
+		"SHUT_DOWN_WAIT":     "30",
+		"CACHE_TTL":          "1m",
+	}))
+	require.Error(t, err)
+
+	var errs config.Errors
+	require.True(t, errors.As(err, &errs))
+	assert.Len(t, errs, 6)
+	assert.ErrorIs(t, err, config.ErrRequired)
+	assert.Equal(t, `config: 6 errors
+  - shut_down_wait (from env SHUT_DOWN_WAIT): invalid duration "30"
+  - database.max_conns (from env DATABASE_MAX_CONNS): invalid integer "many"
+  - log_level: "verbose" is not one of debug, info, warn, error
+  - database.url: required
+  - cache.addr: required
+  - timeout must be at most 1m`, err.Error())
+}
+
+func Test_Load_NotAStruct(t *testing.T) {
+	t.Parallel()
+
+	var port string
+	err := config.Load(&port)
+	assert.EqualError(t, err, "config: a pointer to a struct is required, not *string")
+}
+
+type unsettable struct {
+	handler func()
+}
+
+func Test_Load_PointerWithoutFields(t *testing.T) {
+	t.Parallel()
+
+	var cfg struct {
+		Name  string
+		Inner *unsettable
+	}
+	require.NoError(t, config.Load(&cfg, env(nil)))
+	assert.Nil(t, cfg.Inner)
+}
+
+func Test_Load_RebarOptions(t *testing.T) {
+	t.Parallel()
+
+	var opts rebar.Options
+	require.NoError(t, config.Load(&opts, env(nil)))
+	assert.Nil(t, opts.LogLevel)
+	assert.Nil(t, opts.TLS)
+
+	app := rebar.New(opts)
+	require.NotNil(t, app)
+	require.NotNil(t, app.LogLevel())
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// Dump formats the configuration loaded in v, a struct or a pointer to a struct, one
+// field per line. Secret fields are redacted: the ones with the secret tag, and the
+// ones whose name contains token, password or secret.
+func Dump(v interface{}) string {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return ""
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Sprint(v)
+	}
+	var b strings.Builder
+	dump(&b, rv, nil)
+	return b.String()
+}
+
+// dump writes the fields of the struct v the way walk lists them, without
+// allocating nil pointers to structs
+func dump(b *strings.Builder, v reflect.Value, path []string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fv := v.Field(i)
+		tag := sf.Tag.Get("config")
+		if tag == "-" || !fv.CanInterface() {
+			continue
+		}
+		fieldPath := append(path[:len(path):len(path)], fieldName(sf))
+
+		if sf.Anonymous && tag == "" && fv.Kind() == reflect.Struct {
+			dump(b, fv, path)
+			continue
+		}
+		if !isValue(fv.Type()) {
+			switch {
+			case fv.Kind() == reflect.Struct:
+				dump(b, fv, fieldPath)
+			case fv.Kind() == reflect.Ptr && fv.Type().Elem().Kind() == reflect.Struct && !fv.IsNil():
+				dump(b, fv.Elem(), fieldPath)
+			}
+			continue
+		}
+		f := field{
+			path:   fieldPath,
+			value:  fv,
+			secret: sf.Tag.Get("secret") == "true" || isSecretName(sf.Name),
+		}
+		fmt.Fprintf(b, "%s = %s\n", f.name(), f.format())
+	}
+}
+
+func (f *field) format() string {
+	if f.secret {
+		if f.value.IsZero() {
+			return ""
+		}
+		return redacted
+	}
+	if f.isList() {
+		values := make([]string, f.value.Len())
+		for i := range values {
+			values[i] = fmt.Sprint(f.value.Index(i).Interface())
+		}
+		return strings.Join(values, ",")
+	}
+	return fmt.Sprint(f.value.Interface())
+}
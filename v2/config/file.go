@@ -0,0 +1,101 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// loadFile sets the fields found in a YAML or JSON file
+func loadFile(path string, fields []*field) Errors {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Errors{err}
+	}
+	var doc interface{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &doc)
+	case ".json":
+		// numbers are kept as written, not as floats
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.UseNumber()
+		err = decoder.Decode(&doc)
+	default:
+		err = fmt.Errorf("unsupported file extension %q, use .yaml, .yml or .json", ext)
+	}
+	if err != nil {
+		return Errors{fmt.Errorf("%s: %w", path, err)}
+	}
+
+	var errs Errors
+	source := "file " + path
+	for _, f := range fields {
+		value, ok := lookup(doc, f.path)
+		if !ok {
+			continue
+		}
+		switch value := value.(type) {
+		case []interface{}:
+			if !f.isList() {
+				errs = append(errs, &FieldError{Field: f.name(), Source: source, Err: errors.New("a list is not allowed")})
+				continue
+			}
+			values := make([]string, len(value))
+			for i, v := range value {
+				values[i] = fmt.Sprint(v)
+			}
+			err = f.setList(values, source)
+		case map[string]interface{}, map[interface{}]interface{}:
+			err = &FieldError{Field: f.name(), Source: source, Err: errors.New("a value is required, not an object")}
+		case nil:
+			continue
+		default:
+			err = f.set(fmt.Sprint(value), source)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// lookup finds the value at path in a decoded document. Keys are matched ignoring
+// case, dashes and underscores, so that shut_down_wait, shut-down-wait and
+// ShutDownWait are the same key.
+func lookup(doc interface{}, path []string) (interface{}, bool) {
+	for _, key := range path {
+		var found bool
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			for k, v := range node {
+				if sameKey(k, key) {
+					doc, found = v, true
+					break
+				}
+			}
+		case map[interface{}]interface{}:
+			for k, v := range node {
+				if sameKey(fmt.Sprint(k), key) {
+					doc, found = v, true
+					break
+				}
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+func sameKey(key, name string) bool {
+	normalize := strings.NewReplacer("_", "", "-", "")
+	return strings.EqualFold(normalize.Replace(key), normalize.Replace(name))
+}
@@ -0,0 +1,86 @@
+package config_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/masonhubco/rebar/v2/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fileConfig struct {
+	Port    int
+	Timeout time.Duration
+	Hosts   []string
+	Retry   struct {
+		Attempts int
+	}
+}
+
+func Test_Load_Files(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    fileConfig
+		wantErr string
+	}{
+		{
+			name:    "yaml",
+			file:    "app.yml",
+			content: "port: 3000\ntimeout: 2s\nhosts: [a, b]\nretry:\n  attempts: 3\n",
+			want: fileConfig{Port: 3000, Timeout: 2 * time.Second, Hosts: []string{"a", "b"},
+				Retry: struct{ Attempts int }{Attempts: 3}},
+		},
+		{
+			name:    "json with any key style",
+			file:    "app.json",
+			content: `{"Port": 3000000, "timeout": "1m", "hosts": ["a"], "retry": {"attempts": 1}}`,
+			want: fileConfig{Port: 3000000, Timeout: time.Minute, Hosts: []string{"a"},
+				Retry: struct{ Attempts int }{Attempts: 1}},
+		},
+		{
+			name:    "invalid shapes",
+			file:    "app.yaml",
+			content: "port: [1, 2]\ntimeout: {seconds: 3}\n",
+			wantErr: "config: 2 errors\n" +
+				"  - port (from file {file}): a list is not allowed\n" +
+				`  - timeout (from file {file}): a value is required, not an object`,
+		},
+		{
+			name:    "unsupported extension",
+			file:    "app.toml",
+			content: "port = 3000",
+			wantErr: `config: {file}: unsupported file extension ".toml", use .yaml, .yml or .json`,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := writeFile(t, tc.file, tc.content)
+			var cfg fileConfig
+			err := config.Load(&cfg, config.Files(path), env(nil))
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, strings.ReplaceAll(tc.wantErr, "{file}", path))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, cfg)
+		})
+	}
+}
+
+func Test_Load_MissingFile(t *testing.T) {
+	t.Parallel()
+
+	var cfg fileConfig
+	err := config.Load(&cfg, config.Files("does-not-exist.yaml"), env(nil))
+	assert.EqualError(t, err, "config: open does-not-exist.yaml: no such file or directory")
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"flag"
+	"reflect"
+)
+
+// flagValue records the value of a flag, to set the field once all the other
+// sources are loaded
+type flagValue struct {
+	field *field
+	value *string
+}
+
+func (v flagValue) String() string {
+	if v.value == nil {
+		return ""
+	}
+	return *v.value
+}
+
+func (v flagValue) Set(value string) error {
+	*v.value = value
+	return nil
+}
+
+// IsBoolFlag allows boolean fields to be set with -name only
+func (v flagValue) IsBoolFlag() bool {
+	return v.field != nil && v.field.value.Kind() == reflect.Bool
+}
+
+// parseFlags defines a flag for every field and sets the fields given in args
+func parseFlags(fs *flag.FlagSet, args []string, fields []*field) Errors {
+	values := make([]flagValue, len(fields))
+	for i, f := range fields {
+		values[i] = flagValue{field: f, value: new(string)}
+		fs.Var(values[i], f.flagName(), f.usage)
+		if f.hasDefault {
+			// the default shown in the usage message
+			fs.Lookup(f.flagName()).DefValue = f.def
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return Errors{err}
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+	var errs Errors
+	for _, v := range values {
+		name := v.field.flagName()
+		if !set[name] {
+			continue
+		}
+		if err := v.field.set(*v.value, "flag -"+name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,59 @@
+package config_test
+
+import (
+	"bytes"
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/masonhubco/rebar/v2/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type flagConfig struct {
+	Port    string        `default:"3000" usage:"port to listen on"`
+	Debug   bool          `usage:"enable debug logs"`
+	Timeout time.Duration `default:"5s"`
+	Admin   struct {
+		Port string
+	}
+}
+
+func Test_Load_Flags(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("app", flag.ContinueOnError)
+	var cfg flagConfig
+	err := config.Load(&cfg, env(nil), config.Flags(fs, []string{"-debug", "-admin.port=3001", "-timeout", "1s", "extra"}))
+	require.NoError(t, err)
+	assert.Equal(t, flagConfig{
+		Port:    "3000",
+		Debug:   true,
+		Timeout: time.Second,
+		Admin:   struct{ Port string }{Port: "3001"},
+	}, cfg)
+	assert.Equal(t, []string{"extra"}, fs.Args())
+}
+
+func Test_Load_FlagsUsage(t *testing.T) {
+	t.Parallel()
+
+	var usage bytes.Buffer
+	fs := flag.NewFlagSet("app", flag.ContinueOnError)
+	fs.SetOutput(&usage)
+	var cfg flagConfig
+	err := config.Load(&cfg, env(nil), config.Flags(fs, []string{"-help"}))
+	assert.ErrorIs(t, err, flag.ErrHelp)
+	assert.Contains(t, usage.String(), "-port value\n    \tport to listen on (default 3000)")
+	assert.Contains(t, usage.String(), "-debug\n    \tenable debug logs")
+}
+
+func Test_Load_InvalidFlag(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("app", flag.ContinueOnError)
+	var cfg flagConfig
+	err := config.Load(&cfg, env(nil), config.Flags(fs, []string{"-timeout", "soon"}))
+	assert.EqualError(t, err, `config: timeout (from flag -timeout): invalid duration "soon"`)
+}
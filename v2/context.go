@@ -1,13 +1,19 @@
 package rebar
 
 import (
+	"strings"
+
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
 )
 
 const (
+	ClaimsKey    = "rebarClaims"
 	I18nKey      = "i18n"
+	LogFieldsKey = "rebarLogFields"
 	LoggerKey    = "rebarLogger"
+	PrincipalKey = "rebarPrincipal"
 	RequestIDKey = "requestID"
 	TxKey        = "tx"
 )
@@ -41,10 +47,39 @@ func LoggerFrom(c *gin.Context) Logger {
 	return defaultLogger
 }
 
+// AddLogFields adds fields to the request logger, and to the request log written by
+// the logger middleware, like the caller authenticated by a middleware
+func AddLogFields(c *gin.Context, fields ...zap.Field) {
+	c.Set(LoggerKey, LoggerFrom(c).With(fields...))
+	// copied, as the fields of a copy of the context share their array
+	c.Set(LogFieldsKey, append(append([]zap.Field(nil), LogFieldsFrom(c)...), fields...))
+}
+
+// LogFieldsFrom returns the fields added with AddLogFields
+func LogFieldsFrom(c *gin.Context) []zap.Field {
+	if maybeFields, exists := c.Get(LogFieldsKey); exists {
+		if fields, ok := maybeFields.([]zap.Field); ok {
+			return fields
+		}
+	}
+	return nil
+}
+
 func RequestIDFrom(c *gin.Context) string {
 	return c.GetString(RequestIDKey)
 }
 
+// BearerToken returns the token of the Authorization header. The scheme is case
+// insensitive.
+func BearerToken(c *gin.Context) (string, bool) {
+	scheme, token, ok := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
 func I18nFrom(c *gin.Context) (lang LanguageScoped, ok bool) {
 	if maybeI18n, exists := c.Get(I18nKey); exists {
 		lang, ok = maybeI18n.(LanguageScoped)
@@ -13,6 +13,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 type testBuffaloValidateError struct {
@@ -375,3 +377,39 @@ func Test_TxMustFrom(t *testing.T) {
 		})
 	}
 }
+
+func Test_AddLogFields(t *testing.T) {
+	t.Parallel()
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	resp := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(resp)
+	ctx.Set(rebar.LoggerKey, zap.New(core))
+	assert.Empty(t, rebar.LogFieldsFrom(ctx))
+
+	rebar.AddLogFields(ctx, zap.String("caller", "orders"))
+	rebar.AddLogFields(ctx, zap.String("api_key_id", "k1"))
+	rebar.LoggerFrom(ctx).Info("handled")
+
+	assert.Equal(t, []zap.Field{zap.String("caller", "orders"), zap.String("api_key_id", "k1")},
+		rebar.LogFieldsFrom(ctx))
+	require.Equal(t, 1, logs.Len())
+	assert.Equal(t, map[string]interface{}{"caller": "orders", "api_key_id": "k1"}, logs.All()[0].ContextMap())
+}
+
+func Test_AddLogFields_Copy(t *testing.T) {
+	t.Parallel()
+
+	resp := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(resp)
+	rebar.AddLogFields(ctx, zap.String("caller", "orders"))
+	rebar.AddLogFields(ctx, zap.String("api_key_id", "k1"))
+	rebar.AddLogFields(ctx, zap.String("principal", "orders"))
+
+	copied := ctx.Copy()
+	rebar.AddLogFields(ctx, zap.String("user", "jane"))
+	rebar.AddLogFields(copied, zap.String("job", "export"))
+
+	assert.Equal(t, zap.String("user", "jane"), rebar.LogFieldsFrom(ctx)[3])
+	assert.Equal(t, zap.String("job", "export"), rebar.LogFieldsFrom(copied)[3])
+}
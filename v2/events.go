@@ -0,0 +1,121 @@
+package rebar
+
+import (
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// EventType identifies a lifecycle event
+type EventType string
+
+// Lifecycle events, logged through Options.Logger and given to Options.OnEvent
+const (
+	// EventPhaseChanged is emitted when the app enters a new Phase
+	EventPhaseChanged EventType = "phase_changed"
+	// EventSignalReceived is emitted when a system signal is received
+	EventSignalReceived EventType = "signal_received"
+	// EventServerError is emitted when a listener can't be opened or a server stops
+	// serving unexpectedly
+	EventServerError EventType = "server_error"
+	// EventProcessorStarted is emitted when a processor started, with how long it took
+	EventProcessorStarted EventType = "processor_started"
+	// EventProcessorStartFailed is emitted when a processor failed to start, or was
+	// not started because of its dependencies
+	EventProcessorStartFailed EventType = "processor_start_failed"
+	// EventProcessorStopped is emitted when a processor stopped, with how long it took
+	EventProcessorStopped EventType = "processor_stopped"
+	// EventProcessorStopFailed is emitted when a processor failed to stop, or missed
+	// its deadline
+	EventProcessorStopFailed EventType = "processor_stop_failed"
+	// EventProcessorExited is emitted when a processor reports its work exited
+	EventProcessorExited EventType = "processor_exited"
+	// EventProcessorRestarting is emitted before a supervised processor is restarted,
+	// with the backoff delay, or when it exceeded its restarts
+	EventProcessorRestarting EventType = "processor_restarting"
+	// EventDrainCompleted is emitted at the end of the drain phase
+	EventDrainCompleted EventType = "drain_completed"
+	// EventTLSReloaded is emitted when the TLS certificate can't be reloaded, or is
+	// reloaded on SIGHUP
+	EventTLSReloaded EventType = "tls_reloaded"
+	// EventUpgrade is emitted while handing the listeners over to a new process
+	EventUpgrade EventType = "upgrade"
+	// EventLogLevelChanged is emitted when the log level is changed, with how long the
+	// change lasts when it's temporary, or when a temporary change expires
+	EventLogLevelChanged EventType = "log_level_changed"
+)
+
+// Event is a lifecycle event of a Rebar app. Fields that don't apply to the event
+// are left empty.
+type Event struct {
+	Type    EventType
+	Message string
+	Time    time.Time
+	// Phase is the phase the app is in when the event is emitted
+	Phase     Phase
+	Processor string
+	Err       error
+	Duration  time.Duration
+	Signal    os.Signal
+	// Requests is the number of requests served while draining
+	Requests uint64
+	// Build is the build info of the binary, given when the app is starting
+	Build *BuildInfo
+}
+
+// EventHook observes lifecycle events. It's called synchronously, so it should
+// return quickly.
+type EventHook func(Event)
+
+// fields returns the zap fields of the event, leaving the empty ones out
+func (e Event) fields() []zap.Field {
+	fields := []zap.Field{zap.String("event", string(e.Type))}
+	if e.Phase != "" {
+		fields = append(fields, zap.String("phase", string(e.Phase)))
+	}
+	if e.Processor != "" {
+		fields = append(fields, zap.String("processor", e.Processor))
+	}
+	if e.Err != nil {
+		fields = append(fields, zap.Error(e.Err))
+	}
+	if e.Duration != 0 {
+		fields = append(fields, zap.Duration("duration", e.Duration))
+	}
+	if e.Signal != nil {
+		fields = append(fields, zap.String("signal", e.Signal.String()))
+	}
+	if e.Type == EventDrainCompleted {
+		fields = append(fields, zap.Uint64("requests", e.Requests))
+	}
+	if e.Build != nil {
+		fields = append(fields, e.Build.fields()...)
+	}
+	return fields
+}
+
+// logEvent writes the event as an error when it carries one, and as info otherwise
+func logEvent(logger Logger, e Event) {
+	if e.Err != nil {
+		logger.Error(e.Message, e.fields()...)
+		return
+	}
+	logger.Info(e.Message, e.fields()...)
+}
+
+// emit logs the event through the app logger and passes it to the event hook. The
+// logger is nil when the default one couldn't be built, and the event is only
+// passed to the hook.
+func (r *Rebar) emit(e Event) {
+	e.Time = time.Now()
+	if e.Phase == "" {
+		e.Phase = r.Phase()
+	}
+	if r.Logger != nil {
+		logEvent(r.Logger, e)
+	}
+	if r.OnEvent != nil {
+		r.OnEvent(e)
+	}
+}
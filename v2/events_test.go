@@ -0,0 +1,113 @@
+package rebar_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/masonhubco/rebar/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func Test_Rebar_Events(t *testing.T) {
+	t.Parallel()
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	var mu sync.Mutex
+	var events []rebar.Event
+	r := rebar.New(rebar.Options{
+		Environment: rebar.Test,
+		Port:        freePort(t),
+		Logger:      zap.New(core),
+		OnEvent: func(e rebar.Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, e)
+		},
+	})
+	r.AddLifecycleProcessor(&lifecycleProcessor{stopFn: func(context.Context) error { return nil }},
+		rebar.WithName("worker"))
+	r.AddLifecycleProcessor(&lifecycleProcessor{stopFn: func(context.Context) error { return errors.New("stuck") }},
+		rebar.WithName("stuck"))
+
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- r.RunWithContext(ctx, stop)
+	}()
+	require.Eventually(t, func() bool { return r.Phase() == rebar.PhaseRunning },
+		2*time.Second, 10*time.Millisecond)
+	stop()
+	require.NoError(t, <-done)
+
+	mu.Lock()
+	defer mu.Unlock()
+	var phases []rebar.Phase
+	byProcessor := map[string][]rebar.EventType{}
+	for _, e := range events {
+		assert.False(t, e.Time.IsZero())
+		if e.Type == rebar.EventPhaseChanged {
+			phases = append(phases, e.Phase)
+		}
+		if e.Processor != "" {
+			byProcessor[e.Processor] = append(byProcessor[e.Processor], e.Type)
+		}
+	}
+	assert.Equal(t, []rebar.Phase{
+		rebar.PhaseStarting, rebar.PhaseRunning, rebar.PhaseStopping, rebar.PhaseStopped,
+	}, phases)
+	assert.Equal(t, []rebar.EventType{rebar.EventProcessorStarted, rebar.EventProcessorStopped},
+		byProcessor["worker"])
+	assert.Equal(t, []rebar.EventType{rebar.EventProcessorStarted, rebar.EventProcessorStopFailed},
+		byProcessor["stuck"])
+
+	// every event is logged, with its fields
+	assert.Equal(t, len(events), logs.Len())
+	failed := logs.FilterField(zap.String("processor", "stuck")).FilterMessage("unable to stop processor").All()
+	require.Len(t, failed, 1)
+	assert.Equal(t, zapcore.ErrorLevel, failed[0].Level)
+	fields := failed[0].ContextMap()
+	assert.Equal(t, string(rebar.EventProcessorStopFailed), fields["event"])
+	assert.Equal(t, string(rebar.PhaseStopping), fields["phase"])
+	assert.Equal(t, "stuck", fields["error"])
+	assert.Contains(t, fields, "duration")
+}
+
+func Test_Rebar_Events_WithoutLogger(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var events []rebar.Event
+	r := rebar.New(rebar.Options{
+		Environment: rebar.Test,
+		Port:        freePort(t),
+		OnEvent: func(e rebar.Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, e)
+		},
+	})
+	// the default logger is nil when it can't be built
+	r.Logger = nil
+
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- r.RunWithContext(ctx, stop)
+	}()
+	require.Eventually(t, func() bool { return r.Phase() == rebar.PhaseRunning },
+		2*time.Second, 10*time.Millisecond)
+	stop()
+	require.NoError(t, <-done)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.NotEmpty(t, events)
+	assert.Equal(t, rebar.PhaseStopped, events[len(events)-1].Phase)
+}
@@ -0,0 +1,334 @@
+package rebar
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Phase is the lifecycle phase a Rebar app is in
+type Phase string
+
+const (
+	// PhaseStarting lasts until all processors are started and the server is listening
+	PhaseStarting Phase = "starting"
+	// PhaseRunning lasts until the app context is canceled
+	PhaseRunning Phase = "running"
+	// PhaseDraining lasts for Options.DrainDelay. The app keeps serving requests but
+	// reports itself as not ready, so that load balancers take it out of rotation.
+	PhaseDraining Phase = "draining"
+	// PhaseStopping lasts while processors are stopped and the server shuts down
+	PhaseStopping Phase = "stopping"
+	// PhaseStopped is reached when RunWithContext returns
+	PhaseStopped Phase = "stopped"
+)
+
+// HealthOptions configures the health endpoints registered by rebar.
+type HealthOptions struct {
+	// Disabled prevents rebar from registering the health and version endpoints. The
+	// handlers are still available with Rebar.LivenessHandler, Rebar.ReadinessHandler,
+	// Rebar.StartupHandler and Rebar.VersionHandler.
+	Disabled bool
+	// OnRouter registers the health endpoints, but not /version, on Router when
+	// there's no AdminPort. They're only registered on the admin listener by default,
+	// so that they never clash with routes of the app nor make readiness public.
+	OnRouter bool
+	// LivenessPath defaults to /healthz. It's always 200 unless a liveness check fails.
+	LivenessPath string
+	// ReadinessPath defaults to /readyz. It's 200 once all processors are started,
+	// until shutdown begins, and as long as every readiness check passes.
+	ReadinessPath string
+	// StartupPath defaults to /startupz. It's 200 once all processors are started.
+	StartupPath string
+	// VersionPath defaults to /version. It serves the build info of the binary, on the
+	// admin listener only, as it lists the dependencies and their versions.
+	VersionPath string
+}
+
+func (o HealthOptions) valuesOrDefaults() HealthOptions {
+	if o.LivenessPath == "" {
+		o.LivenessPath = "/healthz"
+	}
+	if o.ReadinessPath == "" {
+		o.ReadinessPath = "/readyz"
+	}
+	if o.StartupPath == "" {
+		o.StartupPath = "/startupz"
+	}
+	if o.VersionPath == "" {
+		o.VersionPath = "/version"
+	}
+	return o
+}
+
+// HealthCheck returns an error when the dependency it checks is not healthy.
+// It should give up when ctx is done.
+type HealthCheck func(ctx context.Context) error
+
+// HealthCheckOptions configures a registered health check.
+type HealthCheckOptions struct {
+	// Timeout defaults to 5 seconds. A check that takes longer is failed.
+	Timeout time.Duration
+	// CacheTTL defaults to 1 second. The result of the check is reused for that long,
+	// so that frequent probes don't hammer the checked dependency. A negative value
+	// disables caching.
+	CacheTTL time.Duration
+	// Liveness also runs the check for the liveness endpoint. Checks only run for
+	// the readiness endpoint by default, because a failing dependency should take
+	// the app out of rotation but not get it restarted.
+	Liveness bool
+}
+
+func (o HealthCheckOptions) valuesOrDefaults() HealthCheckOptions {
+	if o.Timeout == 0 {
+		o.Timeout = 5 * time.Second
+	}
+	if o.CacheTTL == 0 {
+		o.CacheTTL = time.Second
+	}
+	return o
+}
+
+// HealthResult is the outcome of a single health check
+type HealthResult struct {
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Duration  string    `json:"duration"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// HealthReport is the JSON body of the health endpoints
+type HealthReport struct {
+	Status string                  `json:"status"`
+	Phase  Phase                   `json:"phase"`
+	Checks map[string]HealthResult `json:"checks,omitempty"`
+	// Info holds the state reported by the registered info providers, like the
+	// leadership of a processor
+	Info map[string]interface{} `json:"info,omitempty"`
+}
+
+const (
+	healthOK          = "ok"
+	healthUnavailable = "unavailable"
+)
+
+// HealthRegistry holds the named health checks of a Rebar app
+type HealthRegistry struct {
+	mu     sync.RWMutex
+	checks map[string]*registeredCheck
+	infos  map[string]HealthInfo
+}
+
+// HealthInfo reports some state of the app in the health endpoints, without
+// affecting their status. The returned value is marshaled to JSON.
+type HealthInfo func() interface{}
+
+type registeredCheck struct {
+	name  string
+	check HealthCheck
+	opts  HealthCheckOptions
+
+	mu      sync.Mutex
+	last    HealthResult
+	healthy bool
+	expires time.Time
+}
+
+// NewHealthRegistry creates an empty registry
+func NewHealthRegistry() *HealthRegistry {
+	return &HealthRegistry{checks: map[string]*registeredCheck{}, infos: map[string]HealthInfo{}}
+}
+
+// RegisterInfo adds a named info provider, replacing any provider already registered
+// with that name. Providers are called on every request to the liveness and readiness
+// endpoints, so they must be cheap.
+func (h *HealthRegistry) RegisterInfo(name string, info HealthInfo) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.infos[name] = info
+}
+
+// Info calls the registered info providers
+func (h *HealthRegistry) Info() map[string]interface{} {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if len(h.infos) == 0 {
+		return nil
+	}
+	infos := make(map[string]interface{}, len(h.infos))
+	for name, info := range h.infos {
+		infos[name] = info()
+	}
+	return infos
+}
+
+// Register adds a named check, replacing any check already registered with that name.
+func (h *HealthRegistry) Register(name string, check HealthCheck, opts HealthCheckOptions) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = &registeredCheck{
+		name:  name,
+		check: check,
+		opts:  opts.valuesOrDefaults(),
+	}
+}
+
+// Run runs the registered checks concurrently, only the liveness ones when liveness
+// is true, and reports whether they all passed.
+func (h *HealthRegistry) Run(ctx context.Context, liveness bool) (map[string]HealthResult, bool) {
+	h.mu.RLock()
+	var checks []*registeredCheck
+	for _, c := range h.checks {
+		if !liveness || c.opts.Liveness {
+			checks = append(checks, c)
+		}
+	}
+	h.mu.RUnlock()
+	sort.Slice(checks, func(i, j int) bool { return checks[i].name < checks[j].name })
+
+	results := make([]HealthResult, len(checks))
+	healthy := make([]bool, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *registeredCheck) {
+			defer wg.Done()
+			results[i], healthy[i] = c.run(ctx)
+		}(i, c)
+	}
+	wg.Wait()
+
+	all := true
+	byName := make(map[string]HealthResult, len(checks))
+	for i, c := range checks {
+		byName[c.name] = results[i]
+		all = all && healthy[i]
+	}
+	return byName, all
+}
+
+func (c *registeredCheck) run(ctx context.Context) (HealthResult, bool) {
+	// holding the lock while checking makes concurrent probes share one result
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Now().Before(c.expires) {
+		return c.last, c.healthy
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+	defer cancel()
+	start := time.Now()
+	result := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				result <- fmt.Errorf("health check panicked: %v", p)
+			}
+		}()
+		result <- c.check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-result:
+	case <-ctx.Done():
+		err = fmt.Errorf("health check timed out after %s", c.opts.Timeout)
+	}
+
+	c.healthy = err == nil
+	c.last = HealthResult{
+		Status:    healthOK,
+		Duration:  time.Since(start).String(),
+		CheckedAt: start,
+	}
+	if err != nil {
+		c.last.Status = healthUnavailable
+		c.last.Error = err.Error()
+	}
+	if c.opts.CacheTTL > 0 {
+		c.expires = start.Add(c.opts.CacheTTL)
+	}
+	return c.last, c.healthy
+}
+
+// Phase returns the lifecycle phase the app is in
+func (r *Rebar) Phase() Phase {
+	r.phaseMu.RLock()
+	defer r.phaseMu.RUnlock()
+	return r.phase
+}
+
+func (r *Rebar) setPhase(phase Phase) {
+	r.phaseMu.Lock()
+	r.phase = phase
+	r.phaseMu.Unlock()
+	e := Event{Type: EventPhaseChanged, Message: "rebar is " + string(phase), Phase: phase}
+	if phase == PhaseStarting {
+		build := ReadBuildInfo()
+		e.Build = &build
+	}
+	r.emit(e)
+}
+
+// LivenessHandler reports whether the app is alive, running the liveness checks
+func (r *Rebar) LivenessHandler() gin.HandlerFunc {
+	return r.healthHandler(true, func(Phase) bool { return true })
+}
+
+// ReadinessHandler reports whether the app is ready to receive traffic: all
+// processors are started, shutdown has not begun and every check passes. When
+// processors fail to start and the app runs anyway, the failures are reported by
+// the failing processors check.
+func (r *Rebar) ReadinessHandler() gin.HandlerFunc {
+	return r.healthHandler(false, func(phase Phase) bool { return phase == PhaseRunning })
+}
+
+// StartupHandler reports whether the app completed its startup
+func (r *Rebar) StartupHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		phase := r.Phase()
+		report := HealthReport{Status: healthOK, Phase: phase}
+		code := http.StatusOK
+		if phase == PhaseStarting {
+			report.Status = healthUnavailable
+			code = http.StatusServiceUnavailable
+		}
+		c.JSON(code, report)
+	}
+}
+
+func (r *Rebar) healthHandler(liveness bool, phaseOK func(Phase) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		phase := r.Phase()
+		checks, healthy := r.Health.Run(c.Request.Context(), liveness)
+		report := HealthReport{Status: healthOK, Phase: phase, Checks: checks, Info: r.Health.Info()}
+		code := http.StatusOK
+		if !healthy || !phaseOK(phase) {
+			report.Status = healthUnavailable
+			code = http.StatusServiceUnavailable
+		}
+		c.JSON(code, report)
+	}
+}
+
+func processorsStartError(errs []error) error {
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	return fmt.Errorf("processors failed to start: %s", strings.Join(messages, "; "))
+}
+
+func (r *Rebar) registerHealthEndpoints(router gin.IRoutes, opts HealthOptions) {
+	if opts.Disabled {
+		return
+	}
+	router.GET(opts.LivenessPath, r.LivenessHandler())
+	router.GET(opts.ReadinessPath, r.ReadinessHandler())
+	router.GET(opts.StartupPath, r.StartupHandler())
+}
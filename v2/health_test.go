@@ -0,0 +1,259 @@
+package rebar_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/masonhubco/rebar/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_HealthRegistry_Run(t *testing.T) {
+	t.Parallel()
+
+	h := rebar.NewHealthRegistry()
+	h.Register("database", func(ctx context.Context) error { return nil },
+		rebar.HealthCheckOptions{Liveness: true})
+	h.Register("redis", func(ctx context.Context) error { return errors.New("connection refused") },
+		rebar.HealthCheckOptions{})
+	h.Register("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}, rebar.HealthCheckOptions{Timeout: 10 * time.Millisecond})
+	h.Register("panicky", func(ctx context.Context) error { panic("boom") },
+		rebar.HealthCheckOptions{})
+
+	results, healthy := h.Run(context.Background(), false)
+	assert.False(t, healthy)
+	require.Len(t, results, 4)
+	assert.Equal(t, "ok", results["database"].Status)
+	assert.Equal(t, "unavailable", results["redis"].Status)
+	assert.Equal(t, "connection refused", results["redis"].Error)
+	assert.Equal(t, "health check timed out after 10ms", results["slow"].Error)
+	assert.Equal(t, "health check panicked: boom", results["panicky"].Error)
+
+	results, healthy = h.Run(context.Background(), true)
+	assert.True(t, healthy)
+	assert.Len(t, results, 1)
+	assert.Contains(t, results, "database")
+}
+
+func Test_HealthRegistry_Info(t *testing.T) {
+	t.Parallel()
+
+	h := rebar.NewHealthRegistry()
+	assert.Nil(t, h.Info())
+
+	var leader int32
+	h.RegisterInfo("leader", func() interface{} { return atomic.LoadInt32(&leader) == 1 })
+	h.RegisterInfo("version", func() interface{} { return "1.2.3" })
+	assert.Equal(t, map[string]interface{}{"leader": false, "version": "1.2.3"}, h.Info())
+
+	atomic.StoreInt32(&leader, 1)
+	assert.Equal(t, true, h.Info()["leader"])
+}
+
+func Test_HealthRegistry_Cache(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		cacheTTL  time.Duration
+		wantCalls int32
+	}{
+		{name: "cached by default", cacheTTL: 0, wantCalls: 1},
+		{name: "cache disabled", cacheTTL: -1, wantCalls: 3},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var calls int32
+			h := rebar.NewHealthRegistry()
+			h.Register("counted", func(ctx context.Context) error {
+				atomic.AddInt32(&calls, 1)
+				return nil
+			}, rebar.HealthCheckOptions{CacheTTL: tc.cacheTTL})
+
+			for i := 0; i < 3; i++ {
+				h.Run(context.Background(), false)
+			}
+			assert.Equal(t, tc.wantCalls, atomic.LoadInt32(&calls))
+		})
+	}
+}
+
+type blockingProcessor struct {
+	started chan struct{}
+	stopped chan struct{}
+}
+
+func (p *blockingProcessor) Start(ctx context.Context) error {
+	<-p.started
+	return nil
+}
+
+func (p *blockingProcessor) Stop(ctx context.Context) error {
+	<-p.stopped
+	return nil
+}
+
+func Test_Rebar_HealthEndpoints(t *testing.T) {
+	t.Parallel()
+
+	r := rebar.New(rebar.Options{Environment: rebar.Test, ShutDownWait: time.Second,
+		Health: rebar.HealthOptions{OnRouter: true}})
+	r.Server.Addr = "127.0.0.1:0"
+	p := &blockingProcessor{started: make(chan struct{}), stopped: make(chan struct{})}
+	r.AddLifecycleProcessor(p)
+
+	probe := func(path string) (int, rebar.HealthReport) {
+		rr := httptest.NewRecorder()
+		r.Router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		var report rebar.HealthReport
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report))
+		return rr.Code, report
+	}
+	waitForPhase := func(phase rebar.Phase) {
+		require.Eventually(t, func() bool { return r.Phase() == phase }, time.Second, time.Millisecond)
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- r.RunWithContext(ctx, stop)
+	}()
+
+	// processors are starting
+	code, report := probe("/healthz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, rebar.PhaseStarting, report.Phase)
+	code, _ = probe("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	code, _ = probe("/startupz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+
+	close(p.started)
+	waitForPhase(rebar.PhaseRunning)
+	code, report = probe("/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", report.Status)
+	code, _ = probe("/startupz")
+	assert.Equal(t, http.StatusOK, code)
+
+	// a failing check takes the app out of rotation without failing liveness
+	r.Health.Register("database", func(ctx context.Context) error {
+		return errors.New("database is down")
+	}, rebar.HealthCheckOptions{})
+	code, report = probe("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "database is down", report.Checks["database"].Error)
+	code, _ = probe("/healthz")
+	assert.Equal(t, http.StatusOK, code)
+	r.Health.Register("database", func(ctx context.Context) error { return nil },
+		rebar.HealthCheckOptions{})
+
+	// info providers are reported without affecting the status
+	r.Health.RegisterInfo("leader", func() interface{} { return false })
+	code, report = probe("/healthz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]interface{}{"leader": false}, report.Info)
+
+	// processors are stopping
+	stop()
+	waitForPhase(rebar.PhaseStopping)
+	code, report = probe("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, rebar.PhaseStopping, report.Phase)
+	code, _ = probe("/startupz")
+	assert.Equal(t, http.StatusOK, code)
+
+	close(p.stopped)
+	require.NoError(t, <-done)
+	assert.Equal(t, rebar.PhaseStopped, r.Phase())
+}
+
+func Test_Rebar_HealthEndpoints_Options(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		given    rebar.HealthOptions
+		wantPath string
+		wantCode int
+	}{
+		{name: "not on router by default", given: rebar.HealthOptions{}, wantPath: "/healthz", wantCode: http.StatusNotFound},
+		{name: "on router", given: rebar.HealthOptions{OnRouter: true}, wantPath: "/healthz", wantCode: http.StatusOK},
+		{name: "custom path", given: rebar.HealthOptions{OnRouter: true, LivenessPath: "/live"}, wantPath: "/live", wantCode: http.StatusOK},
+		{name: "disabled", given: rebar.HealthOptions{OnRouter: true, Disabled: true}, wantPath: "/healthz", wantCode: http.StatusNotFound},
+		{name: "version not public", given: rebar.HealthOptions{OnRouter: true}, wantPath: "/version", wantCode: http.StatusNotFound},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := rebar.New(rebar.Options{Health: tc.given})
+			rr := httptest.NewRecorder()
+			r.Router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.wantPath, nil))
+			assert.Equal(t, tc.wantCode, rr.Code)
+		})
+	}
+}
+
+func Test_Rebar_Readiness_ProcessorStartFailure(t *testing.T) {
+	t.Parallel()
+
+	r := rebar.New(rebar.Options{Environment: rebar.Test, Port: freePort(t), ShutDownWait: time.Second,
+		Health: rebar.HealthOptions{OnRouter: true}})
+	r.AddProcessor(&mockProcessor{
+		startFn: func() error { return errors.New("broker unreachable") },
+		stopFn:  func() error { return nil },
+	}, rebar.WithName("consumer"))
+
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- r.RunWithContext(ctx, stop)
+	}()
+	require.Eventually(t, func() bool { return r.Phase() == rebar.PhaseRunning }, time.Second, time.Millisecond)
+
+	rr := httptest.NewRecorder()
+	r.Router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	var report rebar.HealthReport
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report))
+	assert.Contains(t, report.Checks["processors"].Error, "broker unreachable")
+
+	// the app is still alive
+	rr = httptest.NewRecorder()
+	r.Router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	stop()
+	require.NoError(t, <-done)
+}
+
+func Test_Rebar_HealthEndpoints_AppRoutes(t *testing.T) {
+	t.Parallel()
+
+	// the health paths are free for the routes of the app by default
+	r := rebar.New(rebar.Options{})
+	assert.NotPanics(t, func() {
+		r.Router.GET("/healthz", func(c *gin.Context) { c.String(http.StatusOK, "app") })
+	})
+	rr := httptest.NewRecorder()
+	r.Router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, "app", rr.Body.String())
+}
@@ -0,0 +1,95 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/masonhubco/rebar/v2"
+)
+
+// DefaultMaxAttempts is the number of attempts of jobs enqueued without the
+// MaxAttempts option
+const DefaultMaxAttempts = 10
+
+// EnqueueOption configures an enqueued job
+type EnqueueOption func(*Job)
+
+// Queue puts the job on the named queue, instead of DefaultQueue
+func Queue(name string) EnqueueOption {
+	return func(j *Job) {
+		j.Queue = name
+	}
+}
+
+// RunAt delays the job until t
+func RunAt(t time.Time) EnqueueOption {
+	return func(j *Job) {
+		j.RunAt = t
+	}
+}
+
+// RunIn delays the job by d
+func RunIn(d time.Duration) EnqueueOption {
+	return func(j *Job) {
+		j.RunAt = time.Now().Add(d)
+	}
+}
+
+// MaxAttempts sets how many times the job runs before it's moved to the dead letters
+func MaxAttempts(n int) EnqueueOption {
+	return func(j *Job) {
+		j.MaxAttempts = n
+	}
+}
+
+// Client enqueues jobs
+type Client struct {
+	backend Backend
+}
+
+// NewClient creates a client enqueuing jobs in backend
+func NewClient(backend Backend) *Client {
+	return &Client{backend: backend}
+}
+
+// Enqueue stores a job of the given kind, with payload marshaled to JSON
+func (c *Client) Enqueue(ctx context.Context, kind string, payload interface{}, opts ...EnqueueOption) (*Job, error) {
+	return c.EnqueueTx(ctx, nil, kind, payload, opts...)
+}
+
+// EnqueueTx stores a job in tx, so that it's only visible to workers once tx commits
+func (c *Client) EnqueueTx(ctx context.Context, tx *sqlx.Tx, kind string, payload interface{}, opts ...EnqueueOption) (*Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("jobs: marshal the payload of %s: %w", kind, err)
+	}
+	job := &Job{
+		Queue:       DefaultQueue,
+		Kind:        kind,
+		Payload:     data,
+		MaxAttempts: DefaultMaxAttempts,
+		RunAt:       time.Now(),
+	}
+	for _, opt := range opts {
+		opt(job)
+	}
+	if job.MaxAttempts < 1 {
+		job.MaxAttempts = 1
+	}
+	if err := c.backend.Enqueue(ctx, tx, job); err != nil {
+		return nil, fmt.Errorf("jobs: enqueue %s: %w", kind, err)
+	}
+	return job, nil
+}
+
+// EnqueueFrom stores a job in the transaction of the request, set by the
+// middleware.Transaction middleware, so that it's dropped when the request fails.
+// Without a transaction in the context, the job is stored right away.
+func (c *Client) EnqueueFrom(gc *gin.Context, kind string, payload interface{}, opts ...EnqueueOption) (*Job, error) {
+	tx, _ := rebar.TxFrom(gc)
+	return c.EnqueueTx(gc.Request.Context(), tx, kind, payload, opts...)
+}
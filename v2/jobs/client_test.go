@@ -0,0 +1,120 @@
+package jobs_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/masonhubco/rebar/v2"
+	"github.com/masonhubco/rebar/v2/jobs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type welcome struct {
+	Email string `json:"email"`
+}
+
+func Test_Client_Enqueue(t *testing.T) {
+	t.Parallel()
+
+	runAt := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name            string
+		opts            []jobs.EnqueueOption
+		wantQueue       string
+		wantMaxAttempts int
+		wantRunAt       time.Time
+	}{
+		{
+			name:            "defaults",
+			wantQueue:       jobs.DefaultQueue,
+			wantMaxAttempts: jobs.DefaultMaxAttempts,
+		},
+		{
+			name:            "options",
+			opts:            []jobs.EnqueueOption{jobs.Queue("emails"), jobs.RunAt(runAt), jobs.MaxAttempts(3)},
+			wantQueue:       "emails",
+			wantMaxAttempts: 3,
+			wantRunAt:       runAt,
+		},
+		{
+			name:            "at least one attempt",
+			opts:            []jobs.EnqueueOption{jobs.MaxAttempts(0)},
+			wantQueue:       jobs.DefaultQueue,
+			wantMaxAttempts: 1,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			backend := jobs.NewMemoryBackend()
+			job, err := jobs.NewClient(backend).Enqueue(context.Background(), "welcome",
+				welcome{Email: "jo@example.com"}, tc.opts...)
+			require.NoError(t, err)
+
+			stored := backend.Jobs(jobs.StatusPending)
+			require.Len(t, stored, 1)
+			assert.Equal(t, job.ID, stored[0].ID)
+			assert.Equal(t, "welcome", stored[0].Kind)
+			assert.Equal(t, tc.wantQueue, stored[0].Queue)
+			assert.Equal(t, tc.wantMaxAttempts, stored[0].MaxAttempts)
+			if tc.wantRunAt.IsZero() {
+				assert.WithinDuration(t, time.Now(), stored[0].RunAt, time.Second)
+			} else {
+				assert.Equal(t, tc.wantRunAt, stored[0].RunAt)
+			}
+
+			var payload welcome
+			require.NoError(t, stored[0].Decode(&payload))
+			assert.Equal(t, "jo@example.com", payload.Email)
+		})
+	}
+}
+
+func Test_Client_EnqueueFrom(t *testing.T) {
+	t.Parallel()
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	client := jobs.NewClient(jobs.NewPostgresBackend(sqlxDB, jobs.PostgresOptions{}))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO rebar_jobs")).
+		WithArgs(jobs.DefaultQueue, "welcome", `{"email":"jo@example.com"}`, jobs.DefaultMaxAttempts, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "created_at"}).AddRow(7, "pending", time.Now()))
+	mock.ExpectRollback()
+
+	tx, err := sqlxDB.Beginx()
+	require.NoError(t, err)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/users", nil)
+	c.Set(rebar.TxKey, tx)
+
+	job, err := client.EnqueueFrom(c, "welcome", welcome{Email: "jo@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), job.ID)
+	assert.Equal(t, jobs.StatusPending, job.Status)
+
+	// the job goes away with the transaction
+	require.NoError(t, tx.Rollback())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func Test_Client_Enqueue_Errors(t *testing.T) {
+	t.Parallel()
+
+	client := jobs.NewClient(jobs.NewMemoryBackend())
+	_, err := client.Enqueue(context.Background(), "welcome", func() {})
+	assert.EqualError(t, err, "jobs: marshal the payload of welcome: json: unsupported type: func()")
+}
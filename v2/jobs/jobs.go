@@ -0,0 +1,108 @@
+// Package jobs is a durable background job queue stored in Postgres. Jobs can be
+// enqueued in the transaction of a request, so that they only run when it commits,
+// and are run by a Worker added to the app as a processor.
+//
+//	backend := jobs.NewPostgresBackend(db, jobs.PostgresOptions{})
+//	client := jobs.NewClient(backend)
+//	worker := jobs.NewWorker(backend, jobs.WorkerOptions{Queues: map[string]int{"emails": 5}})
+//	worker.Handle("welcome_email", sendWelcomeEmail)
+//	app.AddLifecycleProcessor(worker, rebar.WithName("jobs"))
+//
+//	// in a handler behind middleware.Transaction
+//	client.EnqueueFrom(c, "welcome_email", user, jobs.Queue("emails"))
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DefaultQueue is the queue of jobs enqueued without the Queue option
+const DefaultQueue = "default"
+
+// Status is the state of a job in its backend
+type Status string
+
+const (
+	// StatusPending jobs wait for their RunAt time
+	StatusPending Status = "pending"
+	// StatusRunning jobs are claimed by a worker
+	StatusRunning Status = "running"
+	// StatusDead jobs failed their last attempt, or failed permanently. They are kept
+	// in the backend, with their last error, until removed by hand.
+	StatusDead Status = "dead"
+)
+
+// Job is a unit of work stored in a backend. Completed jobs are removed.
+type Job struct {
+	ID          int64
+	Queue       string
+	Kind        string
+	Payload     json.RawMessage
+	Status      Status
+	Attempts    int
+	MaxAttempts int
+	RunAt       time.Time
+	LastError   string
+	CreatedAt   time.Time
+}
+
+// Decode unmarshals the JSON payload of the job into v
+func (j *Job) Decode(v interface{}) error {
+	return json.Unmarshal(j.Payload, v)
+}
+
+// Handler runs a job. Returned errors are retried, unless wrapped with Permanent. ctx
+// is canceled when the job times out, or when the worker stops waiting for it.
+type Handler func(ctx context.Context, job *Job) error
+
+// ErrLeaseLost is returned by backends when the outcome of a job can't be recorded,
+// because its lease expired and another worker claimed it again
+var ErrLeaseLost = errors.New("jobs: lease lost, the job was claimed again")
+
+// Backend stores jobs. Implementations must let concurrent workers claim jobs without
+// claiming the same job twice.
+type Backend interface {
+	// Enqueue stores a new pending job, filling its ID, Status and CreatedAt. tx is
+	// optional, the job is stored in it when given.
+	Enqueue(ctx context.Context, tx *sqlx.Tx, job *Job) error
+	// Claim marks up to limit jobs of the queue as running and increments their
+	// attempts. Pending jobs are claimed once their RunAt time is reached, in that
+	// order, and running jobs once their lease expired, as their worker likely died.
+	Claim(ctx context.Context, queue string, limit int, lease time.Duration) ([]*Job, error)
+	// Complete removes a job that ran successfully. Like Retry and Dead, it only
+	// applies to the claim of the job, the running job with the same attempts, and
+	// returns ErrLeaseLost otherwise.
+	Complete(ctx context.Context, job *Job) error
+	// Retry makes a failed job pending again, to run at runAt
+	Retry(ctx context.Context, job *Job, runAt time.Time, cause error) error
+	// Dead moves a job to the dead letters
+	Dead(ctx context.Context, job *Job, cause error) error
+}
+
+// Permanent wraps err so that the failed job is moved to the dead letters right away,
+// without being retried
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+func isPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
@@ -0,0 +1,144 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// MemoryBackend keeps jobs in memory, for tests and local development. It doesn't
+// take part in transactions: jobs enqueued with a transaction are stored right away.
+type MemoryBackend struct {
+	mu     sync.Mutex
+	nextID int64
+	jobs   map[int64]*memoryJob
+}
+
+type memoryJob struct {
+	Job
+	lockedUntil time.Time
+}
+
+// claimedAs reports whether the job is still running for the claim that returned job
+func (j *memoryJob) claimedAs(job *Job) bool {
+	return j.Status == StatusRunning && j.Attempts == job.Attempts
+}
+
+// NewMemoryBackend creates an empty in-memory backend
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{jobs: map[int64]*memoryJob{}}
+}
+
+// Enqueue stores a new pending job
+func (b *MemoryBackend) Enqueue(ctx context.Context, tx *sqlx.Tx, job *Job) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextID++
+	job.ID = b.nextID
+	job.Status = StatusPending
+	job.CreatedAt = time.Now()
+	b.jobs[job.ID] = &memoryJob{Job: *job}
+	return nil
+}
+
+// Claim marks up to limit jobs of the queue as running
+func (b *MemoryBackend) Claim(ctx context.Context, queue string, limit int, lease time.Duration) ([]*Job, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	var ready []*memoryJob
+	for _, j := range b.jobs {
+		if j.Queue != queue {
+			continue
+		}
+		if (j.Status == StatusPending && !j.RunAt.After(now)) ||
+			(j.Status == StatusRunning && j.lockedUntil.Before(now)) {
+			ready = append(ready, j)
+		}
+	}
+	sort.Slice(ready, func(i, k int) bool {
+		if ready[i].RunAt.Equal(ready[k].RunAt) {
+			return ready[i].ID < ready[k].ID
+		}
+		return ready[i].RunAt.Before(ready[k].RunAt)
+	})
+	if len(ready) > limit {
+		ready = ready[:limit]
+	}
+
+	claimed := make([]*Job, len(ready))
+	for i, j := range ready {
+		j.Status = StatusRunning
+		j.Attempts++
+		j.lockedUntil = now.Add(lease)
+		job := j.Job
+		claimed[i] = &job
+	}
+	return claimed, nil
+}
+
+// Complete removes the job
+func (b *MemoryBackend) Complete(ctx context.Context, job *Job) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	j, ok := b.jobs[job.ID]
+	if !ok {
+		return fmt.Errorf("job %d not found", job.ID)
+	}
+	if !j.claimedAs(job) {
+		return fmt.Errorf("job %d: %w", job.ID, ErrLeaseLost)
+	}
+	delete(b.jobs, job.ID)
+	return nil
+}
+
+// Retry makes the job pending again
+func (b *MemoryBackend) Retry(ctx context.Context, job *Job, runAt time.Time, cause error) error {
+	return b.update(job, func(j *memoryJob) {
+		j.Status = StatusPending
+		j.RunAt = runAt
+		j.LastError = cause.Error()
+	})
+}
+
+// Dead moves the job to the dead letters
+func (b *MemoryBackend) Dead(ctx context.Context, job *Job, cause error) error {
+	return b.update(job, func(j *memoryJob) {
+		j.Status = StatusDead
+		j.LastError = cause.Error()
+	})
+}
+
+func (b *MemoryBackend) update(job *Job, fn func(*memoryJob)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	j, ok := b.jobs[job.ID]
+	if !ok {
+		return fmt.Errorf("job %d not found", job.ID)
+	}
+	if !j.claimedAs(job) {
+		return fmt.Errorf("job %d: %w", job.ID, ErrLeaseLost)
+	}
+	fn(j)
+	j.lockedUntil = time.Time{}
+	return nil
+}
+
+// Jobs returns a copy of the stored jobs with the given status, ordered by ID. All
+// the jobs are returned when status is empty.
+func (b *MemoryBackend) Jobs(status Status) []Job {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var jobs []Job
+	for _, j := range b.jobs {
+		if status == "" || j.Status == status {
+			jobs = append(jobs, j.Job)
+		}
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].ID < jobs[k].ID })
+	return jobs
+}
@@ -0,0 +1,102 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/masonhubco/rebar/v2/jobs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_MemoryBackend_Claim(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	backend := jobs.NewMemoryBackend()
+	now := time.Now()
+	for _, job := range []*jobs.Job{
+		{Queue: "emails", Kind: "later", RunAt: now.Add(time.Hour), MaxAttempts: 3},
+		{Queue: "emails", Kind: "second", RunAt: now.Add(-time.Minute), MaxAttempts: 3},
+		{Queue: "emails", Kind: "first", RunAt: now.Add(-time.Hour), MaxAttempts: 3},
+		{Queue: "reports", Kind: "other queue", RunAt: now.Add(-time.Hour), MaxAttempts: 3},
+	} {
+		require.NoError(t, backend.Enqueue(ctx, nil, job))
+		assert.Equal(t, jobs.StatusPending, job.Status)
+	}
+
+	claimed, err := backend.Claim(ctx, "emails", 1, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, "first", claimed[0].Kind)
+	assert.Equal(t, jobs.StatusRunning, claimed[0].Status)
+	assert.Equal(t, 1, claimed[0].Attempts)
+
+	// running and future jobs aren't claimed
+	claimed, err = backend.Claim(ctx, "emails", 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, "second", claimed[0].Kind)
+
+	// until their lease expires
+	claimed, err = backend.Claim(ctx, "reports", 10, -time.Second)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	claimed, err = backend.Claim(ctx, "reports", 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, 2, claimed[0].Attempts)
+}
+
+func Test_MemoryBackend_Outcomes(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	backend := jobs.NewMemoryBackend()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, backend.Enqueue(ctx, nil, &jobs.Job{Queue: "default", Kind: "job", MaxAttempts: 3}))
+	}
+	claimed, err := backend.Claim(ctx, "default", 3, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 3)
+
+	retryAt := time.Now().Add(time.Hour)
+	require.NoError(t, backend.Complete(ctx, claimed[0]))
+	require.NoError(t, backend.Retry(ctx, claimed[1], retryAt, errors.New("timeout")))
+	require.NoError(t, backend.Dead(ctx, claimed[2], errors.New("invalid payload")))
+
+	pending := backend.Jobs(jobs.StatusPending)
+	require.Len(t, pending, 1)
+	assert.Equal(t, claimed[1].ID, pending[0].ID)
+	assert.Equal(t, retryAt, pending[0].RunAt)
+	assert.Equal(t, "timeout", pending[0].LastError)
+	dead := backend.Jobs(jobs.StatusDead)
+	require.Len(t, dead, 1)
+	assert.Equal(t, "invalid payload", dead[0].LastError)
+	assert.Len(t, backend.Jobs(""), 2)
+
+	assert.EqualError(t, backend.Complete(ctx, claimed[0]), "job 1 not found")
+}
+
+func Test_MemoryBackend_LeaseLost(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	backend := jobs.NewMemoryBackend()
+	require.NoError(t, backend.Enqueue(ctx, nil, &jobs.Job{Queue: "default", Kind: "job", MaxAttempts: 3}))
+	expired, err := backend.Claim(ctx, "default", 1, -time.Second)
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+	claimed, err := backend.Claim(ctx, "default", 1, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+
+	// the first worker can't record the outcome of the job anymore
+	assert.ErrorIs(t, backend.Complete(ctx, expired[0]), jobs.ErrLeaseLost)
+	assert.ErrorIs(t, backend.Retry(ctx, expired[0], time.Now(), errors.New("timeout")), jobs.ErrLeaseLost)
+	assert.ErrorIs(t, backend.Dead(ctx, expired[0], errors.New("invalid payload")), jobs.ErrLeaseLost)
+	require.NoError(t, backend.Complete(ctx, claimed[0]))
+	assert.Empty(t, backend.Jobs(""))
+}
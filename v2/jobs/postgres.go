@@ -0,0 +1,157 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// PostgresOptions configures a PostgresBackend
+type PostgresOptions struct {
+	// Table defaults to rebar_jobs and may be qualified with a schema, like
+	// queue.jobs. The name is written into the SQL of the backend, never build it
+	// from user input.
+	Table string
+}
+
+// PostgresBackend stores jobs in a Postgres table. Workers claim jobs with
+// SELECT ... FOR UPDATE SKIP LOCKED, so that any number of them can share the table.
+type PostgresBackend struct {
+	db      *sqlx.DB
+	table   string
+	queries postgresQueries
+}
+
+type postgresQueries struct {
+	create, enqueue, claim, complete, retry, dead string
+}
+
+// NewPostgresBackend creates a backend storing jobs through db. The table is created
+// by Migrate.
+func NewPostgresBackend(db *sqlx.DB, opts PostgresOptions) *PostgresBackend {
+	table := opts.Table
+	if table == "" {
+		table = "rebar_jobs"
+	}
+	return &PostgresBackend{
+		db:    db,
+		table: table,
+		queries: postgresQueries{
+			create: fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %[1]s (
+	id bigserial PRIMARY KEY,
+	queue text NOT NULL,
+	kind text NOT NULL,
+	payload jsonb NOT NULL,
+	status text NOT NULL DEFAULT 'pending',
+	attempts integer NOT NULL DEFAULT 0,
+	max_attempts integer NOT NULL,
+	run_at timestamptz NOT NULL,
+	locked_until timestamptz,
+	last_error text NOT NULL DEFAULT '',
+	created_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS %[1]s_claim_idx ON %[1]s (queue, status, run_at, id)`, table),
+			enqueue: fmt.Sprintf(`INSERT INTO %s (queue, kind, payload, max_attempts, run_at)
+VALUES ($1, $2, $3::jsonb, $4, $5)
+RETURNING id, status, created_at`, table),
+			claim: fmt.Sprintf(`UPDATE %[1]s
+SET status = 'running', attempts = attempts + 1, locked_until = now() + make_interval(secs => $3)
+WHERE id IN (
+	SELECT id FROM %[1]s
+	WHERE queue = $1
+	AND ((status = 'pending' AND run_at <= now()) OR (status = 'running' AND locked_until < now()))
+	ORDER BY run_at, id
+	LIMIT $2
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING id, queue, kind, payload::text, status, attempts, max_attempts, run_at, last_error, created_at`, table),
+			complete: fmt.Sprintf(`DELETE FROM %s WHERE id = $1 AND status = 'running' AND attempts = $2`, table),
+			retry: fmt.Sprintf(`UPDATE %s
+SET status = 'pending', run_at = $3, last_error = $4, locked_until = NULL
+WHERE id = $1 AND status = 'running' AND attempts = $2`, table),
+			dead: fmt.Sprintf(`UPDATE %s
+SET status = 'dead', last_error = $3, locked_until = NULL
+WHERE id = $1 AND status = 'running' AND attempts = $2`, table),
+		},
+	}
+}
+
+// Migrate creates the jobs table and its index when they don't exist
+func (b *PostgresBackend) Migrate(ctx context.Context) error {
+	if _, err := b.db.ExecContext(ctx, b.queries.create); err != nil {
+		return fmt.Errorf("create %s: %w", b.table, err)
+	}
+	return nil
+}
+
+// Enqueue inserts a new pending job, in tx when given
+func (b *PostgresBackend) Enqueue(ctx context.Context, tx *sqlx.Tx, job *Job) error {
+	var queryer sqlx.QueryerContext = b.db
+	if tx != nil {
+		queryer = tx
+	}
+	var status string
+	err := queryer.QueryRowxContext(ctx, b.queries.enqueue,
+		job.Queue, job.Kind, string(job.Payload), job.MaxAttempts, job.RunAt,
+	).Scan(&job.ID, &status, &job.CreatedAt)
+	job.Status = Status(status)
+	return err
+}
+
+// Claim marks up to limit jobs of the queue as running, skipping the rows locked by
+// other workers
+func (b *PostgresBackend) Claim(ctx context.Context, queue string, limit int, lease time.Duration) ([]*Job, error) {
+	rows, err := b.db.QueryxContext(ctx, b.queries.claim, queue, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var claimed []*Job
+	for rows.Next() {
+		var job Job
+		var payload, status string
+		if err := rows.Scan(&job.ID, &job.Queue, &job.Kind, &payload, &status,
+			&job.Attempts, &job.MaxAttempts, &job.RunAt, &job.LastError, &job.CreatedAt); err != nil {
+			return nil, err
+		}
+		job.Payload = []byte(payload)
+		job.Status = Status(status)
+		claimed = append(claimed, &job)
+	}
+	return claimed, rows.Err()
+}
+
+// Complete deletes the job
+func (b *PostgresBackend) Complete(ctx context.Context, job *Job) error {
+	return b.exec(ctx, job, b.queries.complete)
+}
+
+// Retry makes the job pending again
+func (b *PostgresBackend) Retry(ctx context.Context, job *Job, runAt time.Time, cause error) error {
+	return b.exec(ctx, job, b.queries.retry, runAt, cause.Error())
+}
+
+// Dead moves the job to the dead letters, keeping it with the dead status
+func (b *PostgresBackend) Dead(ctx context.Context, job *Job, cause error) error {
+	return b.exec(ctx, job, b.queries.dead, cause.Error())
+}
+
+// exec runs a query recording the outcome of a job, fenced by its ID and attempts so
+// that it doesn't apply once another worker claimed the job again
+func (b *PostgresBackend) exec(ctx context.Context, job *Job, query string, args ...interface{}) error {
+	result, err := b.db.ExecContext(ctx, query, append([]interface{}{job.ID, job.Attempts}, args...)...)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("job %d: %w", job.ID, ErrLeaseLost)
+	}
+	return nil
+}
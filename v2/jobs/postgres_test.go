@@ -0,0 +1,115 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/masonhubco/rebar/v2/jobs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPostgresBackend(t *testing.T) (*jobs.PostgresBackend, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, mock.ExpectationsWereMet())
+		db.Close()
+	})
+	return jobs.NewPostgresBackend(sqlx.NewDb(db, "postgres"), jobs.PostgresOptions{Table: "queue_jobs"}), mock
+}
+
+func Test_PostgresBackend_Migrate(t *testing.T) {
+	t.Parallel()
+
+	backend, mock := newPostgresBackend(t)
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS queue_jobs")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	require.NoError(t, backend.Migrate(context.Background()))
+
+	mock.ExpectExec("CREATE TABLE").WillReturnError(errors.New("permission denied"))
+	assert.EqualError(t, backend.Migrate(context.Background()), "create queue_jobs: permission denied")
+}
+
+func Test_PostgresBackend_Enqueue(t *testing.T) {
+	t.Parallel()
+
+	backend, mock := newPostgresBackend(t)
+	runAt := time.Now()
+	createdAt := runAt.Add(time.Millisecond)
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO queue_jobs (queue, kind, payload, max_attempts, run_at)")).
+		WithArgs("emails", "welcome", `{"id":1}`, 3, runAt).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "created_at"}).AddRow(42, "pending", createdAt))
+
+	job := &jobs.Job{Queue: "emails", Kind: "welcome", Payload: []byte(`{"id":1}`), MaxAttempts: 3, RunAt: runAt}
+	require.NoError(t, backend.Enqueue(context.Background(), nil, job))
+	assert.Equal(t, int64(42), job.ID)
+	assert.Equal(t, jobs.StatusPending, job.Status)
+	assert.Equal(t, createdAt, job.CreatedAt)
+}
+
+func Test_PostgresBackend_Claim(t *testing.T) {
+	t.Parallel()
+
+	backend, mock := newPostgresBackend(t)
+	now := time.Now()
+	mock.ExpectQuery(`UPDATE queue_jobs\s+SET status = 'running'.+FOR UPDATE SKIP LOCKED`).
+		WithArgs("emails", 2, 90.0).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "queue", "kind", "payload", "status", "attempts", "max_attempts", "run_at", "last_error", "created_at",
+		}).
+			AddRow(1, "emails", "welcome", `{"id":1}`, "running", 1, 3, now, "", now).
+			AddRow(2, "emails", "welcome", `{"id":2}`, "running", 2, 3, now, "timeout", now))
+
+	claimed, err := backend.Claim(context.Background(), "emails", 2, 90*time.Second)
+	require.NoError(t, err)
+	require.Len(t, claimed, 2)
+	assert.Equal(t, &jobs.Job{
+		ID:          2,
+		Queue:       "emails",
+		Kind:        "welcome",
+		Payload:     []byte(`{"id":2}`),
+		Status:      jobs.StatusRunning,
+		Attempts:    2,
+		MaxAttempts: 3,
+		RunAt:       now,
+		LastError:   "timeout",
+		CreatedAt:   now,
+	}, claimed[1])
+
+	mock.ExpectQuery("UPDATE queue_jobs").WillReturnError(errors.New("connection refused"))
+	_, err = backend.Claim(context.Background(), "emails", 2, 90*time.Second)
+	assert.EqualError(t, err, "connection refused")
+}
+
+func Test_PostgresBackend_Outcomes(t *testing.T) {
+	t.Parallel()
+
+	backend, mock := newPostgresBackend(t)
+	ctx := context.Background()
+	job := &jobs.Job{ID: 5, Attempts: 2}
+	runAt := time.Now()
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM queue_jobs WHERE id = $1 AND status = 'running' AND attempts = $2")).
+		WithArgs(5, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE queue_jobs\s+SET status = 'pending'.*\s+WHERE id = \$1 AND status = 'running' AND attempts = \$2`).
+		WithArgs(5, 2, runAt, "timeout").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE queue_jobs\s+SET status = 'dead'.*\s+WHERE id = \$1 AND status = 'running' AND attempts = \$2`).
+		WithArgs(5, 2, "invalid payload").WillReturnResult(sqlmock.NewResult(0, 1))
+	// claimed again by another worker once the lease expired
+	mock.ExpectExec("DELETE FROM queue_jobs").
+		WithArgs(5, 2).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, backend.Complete(ctx, job))
+	require.NoError(t, backend.Retry(ctx, job, runAt, errors.New("timeout")))
+	require.NoError(t, backend.Dead(ctx, job, errors.New("invalid payload")))
+	err := backend.Complete(ctx, job)
+	assert.ErrorIs(t, err, jobs.ErrLeaseLost)
+	assert.EqualError(t, err, "job 5: jobs: lease lost, the job was claimed again")
+}
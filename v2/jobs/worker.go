@@ -0,0 +1,274 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/masonhubco/rebar/v2"
+	"go.uber.org/zap"
+)
+
+// WorkerOptions configures a Worker
+type WorkerOptions struct {
+	// Queues maps the queues to work on to how many of their jobs run at once. It
+	// defaults to a single job at a time from DefaultQueue.
+	Queues map[string]int
+	// PollInterval is how long a queue without ready jobs waits before looking again.
+	// It defaults to 1 second.
+	PollInterval time.Duration
+	// Timeout cancels the context of a job running for longer, and defaults to 5
+	// minutes. A job is also claimed again once it has been running for Timeout and
+	// a minute, as its worker is then considered dead.
+	Timeout time.Duration
+	// Backoff gives the delay before retrying a job that failed the given attempt,
+	// and defaults to DefaultBackoff.
+	Backoff func(attempt int) time.Duration
+	// Logger defaults to the standard logger
+	Logger rebar.Logger
+}
+
+// ValuesOrDefaults returns the options a Worker runs with, working one job at a time
+// from DefaultQueue when no Queues are given
+func (o WorkerOptions) ValuesOrDefaults() WorkerOptions {
+	if len(o.Queues) == 0 {
+		o.Queues = map[string]int{DefaultQueue: 1}
+	}
+	if o.PollInterval == 0 {
+		o.PollInterval = time.Second
+	}
+	if o.Timeout == 0 {
+		o.Timeout = 5 * time.Minute
+	}
+	if o.Backoff == nil {
+		o.Backoff = DefaultBackoff
+	}
+	if o.Logger == nil {
+		o.Logger, _ = rebar.NewStandardLogger()
+	}
+	return o
+}
+
+// DefaultBackoff doubles the delay after each attempt, from 1 second up to 1 hour
+func DefaultBackoff(attempt int) time.Duration {
+	if attempt > 12 {
+		return time.Hour
+	}
+	delay := time.Second << uint(attempt-1)
+	if delay > time.Hour {
+		return time.Hour
+	}
+	return delay
+}
+
+// Worker is a rebar.LifecycleProcessor running the jobs of its queues with the
+// handler registered for their kind
+type Worker struct {
+	backend Backend
+	opts    WorkerOptions
+
+	mu       sync.Mutex
+	handlers map[string]Handler
+	started  bool
+	quit     chan struct{}
+	// jobCtx is the parent context of jobs, canceled when Stop stops waiting
+	jobCtx     context.Context
+	cancelJobs context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// NewWorker creates a worker claiming jobs from backend
+func NewWorker(backend Backend, opts WorkerOptions) *Worker {
+	return &Worker{
+		backend:  backend,
+		opts:     opts.ValuesOrDefaults(),
+		handlers: map[string]Handler{},
+	}
+}
+
+// Handle registers the handler of a kind of job. Jobs without a handler are moved to
+// the dead letters.
+func (w *Worker) Handle(kind string, handler Handler) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.handlers[kind] = handler
+}
+
+// Start polls the queues for jobs
+func (w *Worker) Start(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.started {
+		return errors.New("jobs: worker already started")
+	}
+	for queue, concurrency := range w.opts.Queues {
+		if concurrency < 1 {
+			return fmt.Errorf("jobs: invalid concurrency %d for queue %s", concurrency, queue)
+		}
+	}
+	w.started = true
+	w.quit = make(chan struct{})
+	w.jobCtx, w.cancelJobs = context.WithCancel(context.Background())
+	for queue, concurrency := range w.opts.Queues {
+		w.wg.Add(1)
+		go w.poll(queue, concurrency, w.quit)
+	}
+	return nil
+}
+
+// Stop stops claiming jobs and waits for the running ones to finish. When ctx is done
+// first, their context is canceled and ctx's error is returned. Canceled jobs failing
+// are retried like any failed job.
+func (w *Worker) Stop(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.started {
+		w.mu.Unlock()
+		return nil
+	}
+	w.started = false
+	close(w.quit)
+	cancelJobs := w.cancelJobs
+	w.mu.Unlock()
+	defer cancelJobs()
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("jobs: jobs still running: %w", ctx.Err())
+	}
+}
+
+// poll claims the jobs of a queue as long as fewer than concurrency of them run
+func (w *Worker) poll(queue string, concurrency int, quit chan struct{}) {
+	defer w.wg.Done()
+	w.mu.Lock()
+	jobCtx := w.jobCtx
+	w.mu.Unlock()
+	logger := w.opts.Logger.With(zap.String("queue", queue))
+	// a job holds a slot of the semaphore while it runs
+	slots := make(chan struct{}, concurrency)
+
+	for {
+		select {
+		case <-quit:
+			return
+		case slots <- struct{}{}:
+		}
+		free := 1
+	fill:
+		for free < concurrency {
+			select {
+			case slots <- struct{}{}:
+				free++
+			default:
+				break fill
+			}
+		}
+
+		select {
+		case <-quit:
+			// the select above picks at random when a slot frees as Stop is called,
+			// and no job must be claimed once it was
+			return
+		default:
+		}
+		claimed, err := w.backend.Claim(jobCtx, queue, free, w.opts.Timeout+time.Minute)
+		if err != nil {
+			logger.Error("failed to claim jobs", zap.Error(err))
+		}
+		for _, job := range claimed {
+			w.wg.Add(1)
+			go func(job *Job) {
+				defer w.wg.Done()
+				defer func() { <-slots }()
+				w.process(jobCtx, job)
+			}(job)
+		}
+		for i := len(claimed); i < free; i++ {
+			<-slots
+		}
+
+		if len(claimed) < free {
+			// the queue is drained, for now
+			timer := time.NewTimer(w.opts.PollInterval)
+			select {
+			case <-quit:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+// process runs a claimed job and records its outcome
+func (w *Worker) process(ctx context.Context, job *Job) {
+	logger := w.opts.Logger.With(
+		zap.Int64("job_id", job.ID),
+		zap.String("queue", job.Queue),
+		zap.String("kind", job.Kind),
+		zap.Int("attempt", job.Attempts),
+	)
+	w.mu.Lock()
+	handler, ok := w.handlers[job.Kind]
+	w.mu.Unlock()
+
+	start := time.Now()
+	var err error
+	switch {
+	case !ok:
+		err = Permanent(fmt.Errorf("no handler for jobs of kind %s", job.Kind))
+	case job.Attempts > job.MaxAttempts:
+		// claimed again after its worker died during the last attempt
+		err = Permanent(errors.New("the last attempt timed out"))
+	default:
+		err = w.run(ctx, logger, handler, job)
+	}
+	duration := time.Since(start)
+
+	// the outcome is recorded even when the job was canceled by Stop
+	bookkeeping := context.Background()
+	switch {
+	case err == nil:
+		if err := w.backend.Complete(bookkeeping, job); err != nil {
+			logger.Error("failed to complete job", zap.Error(err))
+			return
+		}
+		logger.Debug("job succeeded", zap.Duration("duration", duration))
+	case isPermanent(err) || job.Attempts >= job.MaxAttempts:
+		if err := w.backend.Dead(bookkeeping, job, err); err != nil {
+			logger.Error("failed to move job to the dead letters", zap.Error(err))
+			return
+		}
+		logger.Error("job moved to the dead letters", zap.Error(err), zap.Duration("duration", duration))
+	default:
+		runAt := time.Now().Add(w.opts.Backoff(job.Attempts))
+		if err := w.backend.Retry(bookkeeping, job, runAt, err); err != nil {
+			logger.Error("failed to retry job", zap.Error(err))
+			return
+		}
+		logger.Warn("job failed, retrying", zap.Error(err), zap.Duration("duration", duration),
+			zap.Time("retry_at", runAt))
+	}
+}
+
+// run calls the handler, recovering from panics
+func (w *Worker) run(ctx context.Context, logger rebar.Logger, handler Handler, job *Job) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, w.opts.Timeout)
+	defer cancel()
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+			logger.Error("job panicked and recovered", zap.Any("panic", p), zap.Stack("stack"))
+		}
+	}()
+	return handler(ctx, job)
+}
@@ -0,0 +1,328 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/masonhubco/rebar/v2/jobs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func newWorker(t *testing.T, backend jobs.Backend, opts jobs.WorkerOptions) (*jobs.Worker, *observer.ObservedLogs) {
+	t.Helper()
+	core, logs := observer.New(zapcore.DebugLevel)
+	opts.Logger = zap.New(core)
+	if opts.PollInterval == 0 {
+		opts.PollInterval = 5 * time.Millisecond
+	}
+	if opts.Backoff == nil {
+		opts.Backoff = func(int) time.Duration { return 0 }
+	}
+	w := jobs.NewWorker(backend, opts)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = w.Stop(ctx)
+	})
+	return w, logs
+}
+
+func enqueue(t *testing.T, backend jobs.Backend, kind string, opts ...jobs.EnqueueOption) *jobs.Job {
+	t.Helper()
+	job, err := jobs.NewClient(backend).Enqueue(context.Background(), kind, nil, opts...)
+	require.NoError(t, err)
+	return job
+}
+
+func Test_Worker_Outcomes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		kind        string
+		maxAttempts int
+		handler     jobs.Handler
+		wantRuns    int32
+		wantStatus  jobs.Status
+		wantError   string
+		wantLog     string
+	}{
+		{
+			name:        "succeeds",
+			kind:        "ok",
+			maxAttempts: 3,
+			handler:     func(ctx context.Context, job *jobs.Job) error { return nil },
+			wantRuns:    1,
+			wantLog:     "job succeeded",
+		},
+		{
+			name:        "retried until dead",
+			kind:        "failing",
+			maxAttempts: 3,
+			handler:     func(ctx context.Context, job *jobs.Job) error { return errors.New("smtp timeout") },
+			wantRuns:    3,
+			wantStatus:  jobs.StatusDead,
+			wantError:   "smtp timeout",
+			wantLog:     "job failed, retrying",
+		},
+		{
+			name:        "permanent failure",
+			kind:        "invalid",
+			maxAttempts: 3,
+			handler: func(ctx context.Context, job *jobs.Job) error {
+				return jobs.Permanent(errors.New("invalid email"))
+			},
+			wantRuns:   1,
+			wantStatus: jobs.StatusDead,
+			wantError:  "invalid email",
+			wantLog:    "job moved to the dead letters",
+		},
+		{
+			name:        "panic",
+			kind:        "panicky",
+			maxAttempts: 1,
+			handler:     func(ctx context.Context, job *jobs.Job) error { panic("nil map") },
+			wantRuns:    1,
+			wantStatus:  jobs.StatusDead,
+			wantError:   "panic: nil map",
+			wantLog:     "job panicked and recovered",
+		},
+		{
+			name:        "no handler",
+			kind:        "unknown",
+			maxAttempts: 3,
+			wantStatus:  jobs.StatusDead,
+			wantError:   "no handler for jobs of kind unknown",
+			wantLog:     "job moved to the dead letters",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			backend := jobs.NewMemoryBackend()
+			w, logs := newWorker(t, backend, jobs.WorkerOptions{})
+			var runs int32
+			if tc.handler != nil {
+				w.Handle(tc.kind, func(ctx context.Context, job *jobs.Job) error {
+					atomic.AddInt32(&runs, 1)
+					return tc.handler(ctx, job)
+				})
+			}
+			job := enqueue(t, backend, tc.kind, jobs.MaxAttempts(tc.maxAttempts))
+			require.NoError(t, w.Start(context.Background()))
+
+			assert.Eventually(t, func() bool {
+				stored := backend.Jobs("")
+				if tc.wantStatus == "" {
+					return len(stored) == 0
+				}
+				return len(stored) == 1 && stored[0].Status == tc.wantStatus
+			}, time.Second, time.Millisecond)
+			require.NoError(t, w.Stop(context.Background()))
+			assert.Equal(t, tc.wantRuns, atomic.LoadInt32(&runs))
+			if tc.wantError != "" {
+				assert.Equal(t, tc.wantError, backend.Jobs("")[0].LastError)
+			}
+
+			entries := logs.FilterMessage(tc.wantLog).All()
+			require.NotEmpty(t, entries)
+			fields := entries[0].ContextMap()
+			assert.Equal(t, job.ID, fields["job_id"])
+			assert.Equal(t, tc.kind, fields["kind"])
+			assert.Equal(t, jobs.DefaultQueue, fields["queue"])
+			assert.Equal(t, int64(1), fields["attempt"])
+		})
+	}
+}
+
+func Test_Worker_RunAt(t *testing.T) {
+	t.Parallel()
+
+	backend := jobs.NewMemoryBackend()
+	w, _ := newWorker(t, backend, jobs.WorkerOptions{})
+	ran := make(chan time.Time, 1)
+	w.Handle("later", func(ctx context.Context, job *jobs.Job) error {
+		ran <- time.Now()
+		return nil
+	})
+	runAt := time.Now().Add(50 * time.Millisecond)
+	enqueue(t, backend, "later", jobs.RunAt(runAt))
+	require.NoError(t, w.Start(context.Background()))
+
+	select {
+	case at := <-ran:
+		assert.False(t, at.Before(runAt))
+	case <-time.After(time.Second):
+		t.Fatal("the job didn't run")
+	}
+}
+
+func Test_Worker_Concurrency(t *testing.T) {
+	t.Parallel()
+
+	backend := jobs.NewMemoryBackend()
+	w, _ := newWorker(t, backend, jobs.WorkerOptions{Queues: map[string]int{"emails": 3, "reports": 1}})
+	var mu sync.Mutex
+	running, maxRunning := map[string]int{}, map[string]int{}
+	var done int32
+	w.Handle("work", func(ctx context.Context, job *jobs.Job) error {
+		mu.Lock()
+		running[job.Queue]++
+		if running[job.Queue] > maxRunning[job.Queue] {
+			maxRunning[job.Queue] = running[job.Queue]
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running[job.Queue]--
+		mu.Unlock()
+		atomic.AddInt32(&done, 1)
+		return nil
+	})
+	for i := 0; i < 9; i++ {
+		enqueue(t, backend, "work", jobs.Queue("emails"))
+	}
+	for i := 0; i < 3; i++ {
+		enqueue(t, backend, "work", jobs.Queue("reports"))
+	}
+	require.NoError(t, w.Start(context.Background()))
+
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&done) == 12 }, 2*time.Second, time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, map[string]int{"emails": 3, "reports": 1}, maxRunning)
+}
+
+func Test_Worker_Stop(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		runFor     time.Duration
+		stopWait   time.Duration
+		wantErr    error
+		wantStatus jobs.Status
+	}{
+		{name: "drains running jobs", runFor: 20 * time.Millisecond, stopWait: time.Second},
+		{
+			name:       "gives up on running jobs",
+			runFor:     time.Minute,
+			stopWait:   20 * time.Millisecond,
+			wantErr:    context.DeadlineExceeded,
+			wantStatus: jobs.StatusPending,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			backend := jobs.NewMemoryBackend()
+			w, _ := newWorker(t, backend, jobs.WorkerOptions{})
+			started := make(chan struct{})
+			w.Handle("work", func(ctx context.Context, job *jobs.Job) error {
+				close(started)
+				select {
+				case <-time.After(tc.runFor):
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+			enqueue(t, backend, "work")
+			require.NoError(t, w.Start(context.Background()))
+			<-started
+
+			ctx, cancel := context.WithTimeout(context.Background(), tc.stopWait)
+			defer cancel()
+			err := w.Stop(ctx)
+			if tc.wantErr == nil {
+				require.NoError(t, err)
+				assert.Empty(t, backend.Jobs(""))
+				return
+			}
+			assert.ErrorIs(t, err, tc.wantErr)
+			// the canceled job is retried later
+			assert.Eventually(t, func() bool {
+				stored := backend.Jobs("")
+				return len(stored) == 1 && stored[0].Status == tc.wantStatus &&
+					stored[0].LastError == "context canceled"
+			}, time.Second, time.Millisecond)
+		})
+	}
+}
+
+// gatedBackend blocks the first Claim, after claiming, until gate is closed
+type gatedBackend struct {
+	*jobs.MemoryBackend
+	gate   chan struct{}
+	claims int32
+}
+
+func (b *gatedBackend) Claim(ctx context.Context, queue string, limit int, lease time.Duration) ([]*jobs.Job, error) {
+	claimed, err := b.MemoryBackend.Claim(ctx, queue, limit, lease)
+	if atomic.AddInt32(&b.claims, 1) == 1 {
+		<-b.gate
+	}
+	return claimed, err
+}
+
+func Test_Worker_NoClaimAfterStop(t *testing.T) {
+	t.Parallel()
+
+	// once the first claim returns, the poll interval is over and a slot is free, as
+	// Stop was called: quit is ready at the same time as both, in every iteration
+	for i := 0; i < 20; i++ {
+		backend := &gatedBackend{MemoryBackend: jobs.NewMemoryBackend(), gate: make(chan struct{})}
+		w, _ := newWorker(t, backend, jobs.WorkerOptions{PollInterval: time.Nanosecond})
+		w.Handle("work", func(ctx context.Context, job *jobs.Job) error { return nil })
+		require.NoError(t, w.Start(context.Background()))
+		require.Eventually(t, func() bool { return atomic.LoadInt32(&backend.claims) == 1 },
+			time.Second, time.Millisecond)
+		enqueue(t, backend, "work")
+
+		// Stop returns right away, while the first claim is still in flight
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.Error(t, w.Stop(ctx))
+		close(backend.gate)
+
+		time.Sleep(10 * time.Millisecond)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&backend.claims))
+		stored := backend.Jobs("")
+		require.Len(t, stored, 1)
+		assert.Equal(t, jobs.StatusPending, stored[0].Status)
+	}
+}
+
+func Test_Worker_Start(t *testing.T) {
+	t.Parallel()
+
+	w, _ := newWorker(t, jobs.NewMemoryBackend(), jobs.WorkerOptions{Queues: map[string]int{"emails": 0}})
+	assert.EqualError(t, w.Start(context.Background()), "jobs: invalid concurrency 0 for queue emails")
+
+	w, _ = newWorker(t, jobs.NewMemoryBackend(), jobs.WorkerOptions{})
+	require.NoError(t, w.Start(context.Background()))
+	assert.EqualError(t, w.Start(context.Background()), "jobs: worker already started")
+}
+
+func Test_DefaultBackoff(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, time.Second, jobs.DefaultBackoff(1))
+	assert.Equal(t, 8*time.Second, jobs.DefaultBackoff(4))
+	assert.Equal(t, time.Hour, jobs.DefaultBackoff(13))
+	assert.Equal(t, time.Hour, jobs.DefaultBackoff(100))
+}
@@ -0,0 +1,282 @@
+// Package leader runs a processor on a single instance of an app at a time. Each
+// instance contends for a shared lock, and only the one holding it, the leader, runs
+// the processor. When the leader stops or loses the lock, another instance takes over.
+//
+//	elector := leader.New(leader.NewPostgresLock(db, "scheduler"), jobs, leader.Options{
+//		Name:   "scheduler",
+//		Health: app.Health,
+//	})
+//	app.AddLifecycleProcessor(elector, rebar.WithName("scheduler"))
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/masonhubco/rebar/v2"
+	"go.uber.org/zap"
+)
+
+// Options configures an Elector
+type Options struct {
+	// Name identifies the election in logs, and defaults to leader
+	Name string
+	// RetryInterval is how often an instance that isn't the leader tries to take the
+	// lock. It defaults to 5 seconds.
+	RetryInterval time.Duration
+	// CheckInterval is how often the leader checks that it still holds the lock. It
+	// defaults to 5 seconds.
+	CheckInterval time.Duration
+	// StopTimeout bounds how long the processor has to stop when the lock is lost.
+	// It defaults to 30 seconds. On shutdown, the deadline given to Stop applies.
+	StopTimeout time.Duration
+	// Logger defaults to the standard logger
+	Logger rebar.Logger
+	// Health is optional, usually the Health of the app. When it's set, the
+	// leadership state is reported under info in its health endpoints, by Name.
+	Health *rebar.HealthRegistry
+}
+
+// ValuesOrDefaults returns the options an Elector runs with. Health stays nil when
+// unset, so that only apps asking for it report the leadership state.
+func (o Options) ValuesOrDefaults() Options {
+	if o.Name == "" {
+		o.Name = "leader"
+	}
+	if o.RetryInterval == 0 {
+		o.RetryInterval = 5 * time.Second
+	}
+	if o.CheckInterval == 0 {
+		o.CheckInterval = 5 * time.Second
+	}
+	if o.StopTimeout == 0 {
+		o.StopTimeout = 30 * time.Second
+	}
+	if o.Logger == nil {
+		o.Logger, _ = rebar.NewStandardLogger()
+	}
+	return o
+}
+
+// Status is the leadership state of an instance
+type Status struct {
+	Leader bool `json:"leader"`
+	// Since is when the instance became the leader
+	Since *time.Time `json:"since,omitempty"`
+}
+
+// Elector is a rebar.LifecycleProcessor starting the wrapped processor while it
+// holds the lock, and stopping it when it loses the lock
+type Elector struct {
+	lock      Lock
+	processor rebar.LifecycleProcessor
+	opts      Options
+	logger    rebar.Logger
+
+	mu      sync.Mutex
+	status  Status
+	started bool
+	quit    chan struct{}
+	done    chan struct{}
+	// stopCtx is the context given to Stop, and stopErr the error of stopping the
+	// processor, once done is closed
+	stopCtx context.Context
+	stopErr error
+	// cancel cancels the lock operations in flight, and the context given to the
+	// processor's Start
+	cancel context.CancelFunc
+}
+
+// New creates an elector running processor while it holds lock. Processors
+// implementing the original rebar.Processor interface can be wrapped with
+// rebar.AdaptProcessor.
+func New(lock Lock, processor rebar.LifecycleProcessor, opts Options) *Elector {
+	opts = opts.ValuesOrDefaults()
+	e := &Elector{
+		lock:      lock,
+		processor: processor,
+		opts:      opts,
+		logger:    opts.Logger.With(zap.String("election", opts.Name)),
+	}
+	if opts.Health != nil {
+		opts.Health.RegisterInfo(opts.Name, e.Info)
+	}
+	return e
+}
+
+// Status returns the leadership state of the instance
+func (e *Elector) Status() Status {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.status
+}
+
+// IsLeader reports whether the instance holds the lock and runs the processor
+func (e *Elector) IsLeader() bool {
+	return e.Status().Leader
+}
+
+// Info reports the leadership state in the health endpoints. It's registered by New
+// when Options.Health is set.
+func (e *Elector) Info() interface{} {
+	return e.Status()
+}
+
+// Start contends for the lock in the background. The processor is started once the
+// lock is taken, so the instance may never run it.
+func (e *Elector) Start(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.started {
+		return errors.New("leader: elector already started")
+	}
+	e.started = true
+	e.quit = make(chan struct{})
+	e.done = make(chan struct{})
+	var runCtx context.Context
+	runCtx, e.cancel = context.WithCancel(context.Background())
+	go e.loop(runCtx, e.quit, e.done)
+	return nil
+}
+
+// Stop stops contending for the lock and, when leading, stops the processor and
+// releases the lock so that another instance takes over
+func (e *Elector) Stop(ctx context.Context) error {
+	e.mu.Lock()
+	if !e.started {
+		e.mu.Unlock()
+		return nil
+	}
+	e.started = false
+	e.stopCtx = ctx
+	close(e.quit)
+	cancel, done := e.cancel, e.done
+	e.mu.Unlock()
+	defer cancel()
+
+	select {
+	case <-done:
+		return e.stopErr
+	case <-ctx.Done():
+		// the loop still stops the processor and releases the lock once it's done
+		return fmt.Errorf("leader: election still in flight: %w", ctx.Err())
+	}
+}
+
+// loop contends for the lock until quit is closed, and then abdicates. Abdicating
+// in the loop rather than in Stop also covers a lock taken while Stop gave up
+// waiting.
+func (e *Elector) loop(ctx context.Context, quit, done chan struct{}) {
+	defer close(done)
+	for {
+		interval := e.opts.RetryInterval
+		if e.IsLeader() {
+			e.check(ctx)
+		} else {
+			e.campaign(ctx, quit)
+		}
+		if e.IsLeader() {
+			interval = e.opts.CheckInterval
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-quit:
+			timer.Stop()
+			e.mu.Lock()
+			stopCtx := e.stopCtx
+			e.mu.Unlock()
+			e.stopErr = e.abdicate(stopCtx)
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// campaign takes the lock when it's free, and starts the processor unless the
+// elector is being stopped
+func (e *Elector) campaign(ctx context.Context, quit chan struct{}) {
+	acquired, err := e.lock.TryAcquire(ctx)
+	if err != nil {
+		e.logger.Error("failed to acquire leadership", zap.Error(err))
+		return
+	}
+	if !acquired {
+		return
+	}
+	select {
+	case <-quit:
+		// ctx is canceled once Stop gives up waiting
+		releaseCtx, cancel := context.WithTimeout(context.Background(), e.opts.StopTimeout)
+		defer cancel()
+		e.release(releaseCtx)
+		return
+	default:
+	}
+	if err := e.processor.Start(ctx); err != nil {
+		e.logger.Error("failed to start the processor of the leader", zap.Error(err))
+		e.release(ctx)
+		return
+	}
+
+	since := time.Now()
+	e.mu.Lock()
+	e.status = Status{Leader: true, Since: &since}
+	e.mu.Unlock()
+	e.logger.Info("leadership acquired")
+}
+
+// check stops the processor when the lock is lost
+func (e *Elector) check(ctx context.Context) {
+	held, err := e.lock.Held(ctx)
+	if held && err == nil {
+		return
+	}
+	var fields []zap.Field
+	if err != nil {
+		fields = append(fields, zap.Error(err))
+	}
+	e.logger.Warn("leadership lost, stopping the processor", fields...)
+
+	stopCtx, cancel := context.WithTimeout(ctx, e.opts.StopTimeout)
+	defer cancel()
+	if err := e.processor.Stop(stopCtx); err != nil {
+		e.logger.Error("failed to stop the processor of the former leader", zap.Error(err))
+	}
+	e.resign(stopCtx)
+}
+
+// abdicate stops the processor and releases the lock, when leading. The lock is
+// released even when ctx is done, as Stop gave up waiting, within StopTimeout.
+func (e *Elector) abdicate(ctx context.Context) error {
+	if !e.IsLeader() {
+		return nil
+	}
+	err := e.processor.Stop(ctx)
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), e.opts.StopTimeout)
+		defer cancel()
+	}
+	e.resign(ctx)
+	e.logger.Info("leadership released")
+	return err
+}
+
+// resign releases the lock, if it's still held, and records that the instance is no
+// longer the leader
+func (e *Elector) resign(ctx context.Context) {
+	e.release(ctx)
+	e.mu.Lock()
+	e.status = Status{}
+	e.mu.Unlock()
+}
+
+func (e *Elector) release(ctx context.Context) {
+	if err := e.lock.Release(ctx); err != nil {
+		e.logger.Error("failed to release leadership", zap.Error(err))
+	}
+}
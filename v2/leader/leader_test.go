@@ -0,0 +1,264 @@
+package leader_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/masonhubco/rebar/v2"
+	"github.com/masonhubco/rebar/v2/leader"
+	"github.com/masonhubco/rebar/v2/rebartest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type recordingProcessor struct {
+	mu       sync.Mutex
+	running  bool
+	starts   int
+	startErr error
+	// starting is closed by Start, which then waits for startGate when it's set
+	starting  chan struct{}
+	startGate chan struct{}
+}
+
+func (p *recordingProcessor) Start(ctx context.Context) error {
+	if p.startGate != nil {
+		close(p.starting)
+		<-p.startGate
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.starts++
+	if p.startErr != nil {
+		return p.startErr
+	}
+	p.running = true
+	return nil
+}
+
+func (p *recordingProcessor) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running = false
+	return nil
+}
+
+func (p *recordingProcessor) isRunning() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.running
+}
+
+func newElector(t *testing.T, lock leader.Lock, p *recordingProcessor) (*leader.Elector, *observer.ObservedLogs) {
+	t.Helper()
+	core, logs := observer.New(zapcore.DebugLevel)
+	e := leader.New(lock, p, leader.Options{
+		Name:          "scheduler",
+		RetryInterval: time.Millisecond,
+		CheckInterval: time.Millisecond,
+		Logger:        zap.New(core),
+	})
+	t.Cleanup(func() {
+		_ = e.Stop(context.Background())
+	})
+	return e, logs
+}
+
+func Test_Elector_Failover(t *testing.T) {
+	t.Parallel()
+
+	locks := leader.NewMemoryLocks()
+	first, second := &recordingProcessor{}, &recordingProcessor{}
+	firstElector, logs := newElector(t, locks.Lock("scheduler"), first)
+	secondElector, _ := newElector(t, locks.Lock("scheduler"), second)
+
+	require.NoError(t, firstElector.Start(context.Background()))
+	require.Eventually(t, firstElector.IsLeader, time.Second, time.Millisecond)
+	assert.True(t, first.isRunning())
+	assert.NotNil(t, firstElector.Status().Since)
+
+	// only one instance runs the processor
+	require.NoError(t, secondElector.Start(context.Background()))
+	time.Sleep(20 * time.Millisecond)
+	assert.False(t, secondElector.IsLeader())
+	assert.False(t, second.isRunning())
+	assert.Equal(t, leader.Status{}, secondElector.Status())
+
+	// stopping the leader hands the processor over
+	require.NoError(t, firstElector.Stop(context.Background()))
+	assert.False(t, first.isRunning())
+	assert.False(t, firstElector.IsLeader())
+	require.Eventually(t, secondElector.IsLeader, time.Second, time.Millisecond)
+	assert.True(t, second.isRunning())
+
+	acquired := logs.FilterMessage("leadership acquired").All()
+	require.Len(t, acquired, 1)
+	assert.Equal(t, "scheduler", acquired[0].ContextMap()["election"])
+	assert.Equal(t, 1, logs.FilterMessage("leadership released").Len())
+}
+
+func Test_Elector_LostLock(t *testing.T) {
+	t.Parallel()
+
+	locks := leader.NewMemoryLocks()
+	p := &recordingProcessor{}
+	e, logs := newElector(t, locks.Lock("scheduler"), p)
+	require.NoError(t, e.Start(context.Background()))
+	require.Eventually(t, e.IsLeader, time.Second, time.Millisecond)
+
+	// another instance takes the lock before this one notices it lost it
+	locks.Revoke("scheduler")
+	other := locks.Lock("scheduler")
+	acquired, err := other.TryAcquire(context.Background())
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	require.Eventually(t, func() bool { return !e.IsLeader() }, time.Second, time.Millisecond)
+	assert.False(t, p.isRunning())
+	assert.Equal(t, 1, logs.FilterMessage("leadership lost, stopping the processor").Len())
+	// the lock of the new leader is left alone
+	assert.Same(t, other, locks.Holder("scheduler"))
+
+	require.NoError(t, other.Release(context.Background()))
+	require.Eventually(t, e.IsLeader, time.Second, time.Millisecond)
+	assert.True(t, p.isRunning())
+}
+
+func Test_Elector_StartFailure(t *testing.T) {
+	t.Parallel()
+
+	locks := leader.NewMemoryLocks()
+	p := &recordingProcessor{startErr: errors.New("no database")}
+	e, logs := newElector(t, locks.Lock("scheduler"), p)
+	require.NoError(t, e.Start(context.Background()))
+	assert.EqualError(t, e.Start(context.Background()), "leader: elector already started")
+
+	require.Eventually(t, func() bool {
+		return logs.FilterMessage("failed to start the processor of the leader").Len() >= 2
+	}, time.Second, time.Millisecond)
+	assert.False(t, e.IsLeader())
+	require.NoError(t, e.Stop(context.Background()))
+	// the lock is released for another instance to try
+	assert.Nil(t, locks.Holder("scheduler"))
+}
+
+// gatedLock waits for its gate before trying to acquire the lock
+type gatedLock struct {
+	*leader.MemoryLock
+	acquiring chan struct{}
+	gate      chan struct{}
+}
+
+func (l *gatedLock) TryAcquire(ctx context.Context) (bool, error) {
+	close(l.acquiring)
+	<-l.gate
+	return l.MemoryLock.TryAcquire(ctx)
+}
+
+func Test_Elector_StopTimeout(t *testing.T) {
+	t.Parallel()
+
+	t.Run("while acquiring the lock", func(t *testing.T) {
+		t.Parallel()
+
+		locks := leader.NewMemoryLocks()
+		lock := &gatedLock{MemoryLock: locks.Lock("scheduler"), acquiring: make(chan struct{}), gate: make(chan struct{})}
+		p := &recordingProcessor{}
+		e, _ := newElector(t, lock, p)
+		require.NoError(t, e.Start(context.Background()))
+		<-lock.acquiring
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.Error(t, e.Stop(ctx))
+		close(lock.gate)
+
+		// the lock taken after Stop returned is released, without starting the processor
+		require.Eventually(t, func() bool { return locks.Holder("scheduler") == nil }, time.Second, time.Millisecond)
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		assert.Zero(t, p.starts)
+	})
+
+	t.Run("while starting the processor", func(t *testing.T) {
+		t.Parallel()
+
+		locks := leader.NewMemoryLocks()
+		p := &recordingProcessor{starting: make(chan struct{}), startGate: make(chan struct{})}
+		e, logs := newElector(t, locks.Lock("scheduler"), p)
+		require.NoError(t, e.Start(context.Background()))
+		<-p.starting
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.Error(t, e.Stop(ctx))
+		close(p.startGate)
+
+		// the processor started after Stop returned is stopped, and the lock released
+		require.Eventually(t, func() bool {
+			return logs.FilterMessage("leadership released").Len() == 1
+		}, time.Second, time.Millisecond)
+		assert.False(t, p.isRunning())
+		assert.False(t, e.IsLeader())
+		assert.Nil(t, locks.Holder("scheduler"))
+	})
+}
+
+func Test_Elector_Info(t *testing.T) {
+	t.Parallel()
+
+	locks := leader.NewMemoryLocks()
+	e, _ := newElector(t, locks.Lock("scheduler"), &recordingProcessor{})
+
+	data, err := json.Marshal(e.Info())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"leader":false}`, string(data))
+
+	require.NoError(t, e.Start(context.Background()))
+	require.Eventually(t, e.IsLeader, time.Second, time.Millisecond)
+	data, err = json.Marshal(e.Info())
+	require.NoError(t, err)
+	var status map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &status))
+	assert.Equal(t, true, status["leader"])
+	assert.Contains(t, status, "since")
+}
+
+func Test_Elector_Health(t *testing.T) {
+	t.Parallel()
+
+	app := rebartest.New(t, rebartest.Options{
+		Options:  rebar.Options{Health: rebar.HealthOptions{OnRouter: true}},
+		InMemory: true,
+	})
+	locks := leader.NewMemoryLocks()
+	e := leader.New(locks.Lock("scheduler"), &recordingProcessor{}, leader.Options{
+		Name:          "scheduler",
+		RetryInterval: time.Millisecond,
+		CheckInterval: time.Millisecond,
+		Logger:        zap.NewNop(),
+		Health:        app.Health,
+	})
+	app.AddLifecycleProcessor(e, rebar.WithName("scheduler"))
+	app.Start()
+	require.Eventually(t, e.IsLeader, time.Second, time.Millisecond)
+
+	resp, err := app.Client.Get("/readyz")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var report struct {
+		Info map[string]leader.Status `json:"info"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+	assert.True(t, report.Info["scheduler"].Leader)
+	assert.NotNil(t, report.Info["scheduler"].Since)
+}
@@ -0,0 +1,170 @@
+package leader
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Lock is a lock shared by the instances of an app, held by the leader
+type Lock interface {
+	// TryAcquire takes the lock when it's free, without waiting, and reports whether
+	// it's held
+	TryAcquire(ctx context.Context) (bool, error)
+	// Held reports whether the lock is still held, as it can be lost without being
+	// released, like when the connection holding it breaks
+	Held(ctx context.Context) (bool, error)
+	// Release gives the lock up
+	Release(ctx context.Context) error
+}
+
+// PostgresLock is a Postgres session advisory lock. It's held by a connection taken
+// from the pool for as long as the lock is, and lost when that connection breaks.
+type PostgresLock struct {
+	db  *sqlx.DB
+	key int64
+
+	mu   sync.Mutex
+	conn *sql.Conn
+}
+
+// NewPostgresLock creates an advisory lock whose key is a hash of name
+func NewPostgresLock(db *sqlx.DB, name string) *PostgresLock {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return &PostgresLock{db: db, key: int64(h.Sum64())}
+}
+
+// TryAcquire takes the advisory lock with pg_try_advisory_lock
+func (l *PostgresLock) TryAcquire(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn != nil {
+		return l.held(ctx)
+	}
+
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", l.key).Scan(&acquired); err != nil {
+		conn.Close()
+		return false, err
+	}
+	if !acquired {
+		return false, conn.Close()
+	}
+	l.conn = conn
+	return true, nil
+}
+
+// Held checks that the connection holding the lock still works, as the lock is only
+// released with it
+func (l *PostgresLock) Held(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.held(ctx)
+}
+
+func (l *PostgresLock) held(ctx context.Context) (bool, error) {
+	if l.conn == nil {
+		return false, nil
+	}
+	var one int
+	if err := l.conn.QueryRowContext(ctx, "SELECT 1").Scan(&one); err != nil {
+		l.conn.Close()
+		l.conn = nil
+		return false, err
+	}
+	return true, nil
+}
+
+// Release unlocks the advisory lock and returns its connection to the pool
+func (l *PostgresLock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn == nil {
+		return nil
+	}
+	conn := l.conn
+	l.conn = nil
+	var released bool
+	err := conn.QueryRowContext(ctx, "SELECT pg_advisory_unlock($1)", l.key).Scan(&released)
+	if closeErr := conn.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("release advisory lock %d: %w", l.key, err)
+	}
+	return nil
+}
+
+// MemoryLocks hands out locks held in memory, for tests and local development. The
+// locks it hands out for a name exclude each other.
+type MemoryLocks struct {
+	mu      sync.Mutex
+	holders map[string]*MemoryLock
+}
+
+// NewMemoryLocks creates a set of free locks
+func NewMemoryLocks() *MemoryLocks {
+	return &MemoryLocks{holders: map[string]*MemoryLock{}}
+}
+
+// Lock returns a new contender for the named lock
+func (m *MemoryLocks) Lock(name string) *MemoryLock {
+	return &MemoryLock{locks: m, name: name}
+}
+
+// Holder returns the contender holding the named lock, or nil when it's free
+func (m *MemoryLocks) Holder(name string) *MemoryLock {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.holders[name]
+}
+
+// Revoke frees the named lock without its holder releasing it, like a broken
+// connection would
+func (m *MemoryLocks) Revoke(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.holders, name)
+}
+
+// MemoryLock is a contender for a lock of MemoryLocks
+type MemoryLock struct {
+	locks *MemoryLocks
+	name  string
+}
+
+// TryAcquire takes the lock when it's free
+func (l *MemoryLock) TryAcquire(ctx context.Context) (bool, error) {
+	l.locks.mu.Lock()
+	defer l.locks.mu.Unlock()
+	holder, ok := l.locks.holders[l.name]
+	if !ok {
+		l.locks.holders[l.name] = l
+		return true, nil
+	}
+	return holder == l, nil
+}
+
+// Held reports whether the lock is held by this contender
+func (l *MemoryLock) Held(ctx context.Context) (bool, error) {
+	return l.locks.Holder(l.name) == l, nil
+}
+
+// Release frees the lock when it's held by this contender
+func (l *MemoryLock) Release(ctx context.Context) error {
+	l.locks.mu.Lock()
+	defer l.locks.mu.Unlock()
+	if l.locks.holders[l.name] == l {
+		delete(l.locks.holders, l.name)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package leader_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/masonhubco/rebar/v2/leader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPostgresLock(t *testing.T) (*leader.PostgresLock, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, mock.ExpectationsWereMet())
+		db.Close()
+	})
+	return leader.NewPostgresLock(sqlx.NewDb(db, "postgres"), "scheduler"), mock
+}
+
+func Test_PostgresLock(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	lock, mock := newPostgresLock(t)
+	tryLock := regexp.QuoteMeta("SELECT pg_try_advisory_lock($1)")
+
+	// taken by another instance
+	mock.ExpectQuery(tryLock).WillReturnRows(sqlmock.NewRows([]string{"acquired"}).AddRow(false))
+	acquired, err := lock.TryAcquire(ctx)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+	held, err := lock.Held(ctx)
+	require.NoError(t, err)
+	assert.False(t, held)
+
+	mock.ExpectQuery(tryLock).WillReturnRows(sqlmock.NewRows([]string{"acquired"}).AddRow(true))
+	acquired, err = lock.TryAcquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	// held as long as its connection works
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT 1")).WillReturnRows(sqlmock.NewRows([]string{"one"}).AddRow(1))
+	held, err = lock.Held(ctx)
+	require.NoError(t, err)
+	assert.True(t, held)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT pg_advisory_unlock($1)")).
+		WillReturnRows(sqlmock.NewRows([]string{"released"}).AddRow(true))
+	require.NoError(t, lock.Release(ctx))
+	require.NoError(t, lock.Release(ctx))
+}
+
+func Test_PostgresLock_Lost(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	lock, mock := newPostgresLock(t)
+	mock.ExpectQuery("pg_try_advisory_lock").WillReturnRows(sqlmock.NewRows([]string{"acquired"}).AddRow(true))
+	acquired, err := lock.TryAcquire(ctx)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	mock.ExpectQuery("SELECT 1").WillReturnError(errors.New("connection reset by peer"))
+	held, err := lock.Held(ctx)
+	assert.EqualError(t, err, "connection reset by peer")
+	assert.False(t, held)
+
+	// nothing left to release
+	require.NoError(t, lock.Release(ctx))
+}
+
+func Test_MemoryLocks(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	locks := leader.NewMemoryLocks()
+	first, second := locks.Lock("scheduler"), locks.Lock("scheduler")
+
+	acquired, err := first.TryAcquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+	acquired, err = second.TryAcquire(ctx)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+	assert.Same(t, first, locks.Holder("scheduler"))
+
+	// other names are independent
+	acquired, err = locks.Lock("outbox").TryAcquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	require.NoError(t, second.Release(ctx))
+	held, _ := first.Held(ctx)
+	assert.True(t, held)
+
+	locks.Revoke("scheduler")
+	held, _ = first.Held(ctx)
+	assert.False(t, held)
+	acquired, _ = second.TryAcquire(ctx)
+	assert.True(t, acquired)
+	require.NoError(t, second.Release(ctx))
+	assert.Nil(t, locks.Holder("scheduler"))
+}
@@ -0,0 +1,239 @@
+package rebar
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Listen opens the listeners described by spec. A spec is one of:
+//
+//   - host:port or tcp://host:port, like :3000, 127.0.0.1:3000 or [::1]:3000. Use
+//     tcp4:// or tcp6:// to restrict the IP version.
+//   - unix:///path/to/socket, optionally with the file permissions the socket is
+//     created with, like unix:///run/app.sock?mode=0660. A stale socket file is
+//     removed first.
+//   - systemd, for every socket passed by systemd socket activation (LISTEN_FDS), or
+//     systemd://name for the sockets named name with FileDescriptorName=.
+//   - fd://3, for a listening socket inherited as file descriptor 3.
+func Listen(spec string) ([]net.Listener, error) {
+	scheme, address := "tcp", spec
+	if i := strings.Index(spec, "://"); i >= 0 {
+		scheme, address = spec[:i], spec[i+3:]
+	} else if spec == "systemd" {
+		scheme, address = "systemd", ""
+	}
+
+	var listeners []net.Listener
+	var err error
+	switch scheme {
+	case "tcp", "tcp4", "tcp6":
+		var l net.Listener
+		l, err = net.Listen(scheme, address)
+		listeners = []net.Listener{l}
+	case "unix":
+		var l net.Listener
+		l, err = listenUnix(address)
+		listeners = []net.Listener{l}
+	case "systemd":
+		listeners, err = listenSystemd(address)
+	case "fd":
+		var l net.Listener
+		l, err = listenFD(address)
+		listeners = []net.Listener{l}
+	default:
+		err = fmt.Errorf("unknown scheme %q", scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("listen %s: %w", spec, err)
+	}
+	return listeners, nil
+}
+
+func listenUnix(address string) (net.Listener, error) {
+	path, rawQuery := address, ""
+	if i := strings.Index(address, "?"); i >= 0 {
+		path, rawQuery = address[:i], address[i+1:]
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		// left over by a previous process that didn't exit cleanly
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	mode := query.Get("mode")
+	if mode == "" {
+		return net.Listen("unix", path)
+	}
+	perm, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mode %q: %w", mode, err)
+	}
+	return listenUnixWithMode(path, os.FileMode(perm)&os.ModePerm)
+}
+
+// listenUnixWithMode creates the socket in a private directory next to path, where
+// no one can connect to it until its mode is perm, and then moves it to path.
+// Changing the mode of a socket created at path would leave it open for a moment.
+func listenUnixWithMode(path string, perm os.FileMode) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".rebar-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	created := filepath.Join(dir, filepath.Base(path))
+	l, err := net.Listen("unix", created)
+	if err != nil {
+		return nil, err
+	}
+	unix := l.(*net.UnixListener)
+	unix.SetUnlinkOnClose(false)
+	if err := os.Chmod(created, perm); err != nil {
+		l.Close()
+		return nil, err
+	}
+	if err := os.Rename(created, path); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return &movedUnixListener{UnixListener: unix, path: path, unlink: true}, nil
+}
+
+// movedUnixListener is a unix socket moved to path once created. It reports path as
+// its address, and removes it when closed, like a socket created at path would.
+type movedUnixListener struct {
+	*net.UnixListener
+	path   string
+	unlink bool
+	close  sync.Once
+}
+
+func (l *movedUnixListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: l.path, Net: "unix"}
+}
+
+// SetUnlinkOnClose sets whether the socket file is removed when the listener is
+// closed
+func (l *movedUnixListener) SetUnlinkOnClose(unlink bool) {
+	l.unlink = unlink
+}
+
+func (l *movedUnixListener) Close() error {
+	err := l.UnixListener.Close()
+	l.close.Do(func() {
+		if l.unlink {
+			os.Remove(l.path)
+		}
+	})
+	return err
+}
+
+func listenFD(address string) (net.Listener, error) {
+	fd, err := strconv.Atoi(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file descriptor %q", address)
+	}
+	return fileListener(os.NewFile(uintptr(fd), "fd://"+address))
+}
+
+// fileListener turns an inherited file into a listener. The file is closed, as the
+// listener works on its own duplicate of the file descriptor.
+func fileListener(f *os.File) (net.Listener, error) {
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+const systemdFirstFD = 3
+
+// systemd holds the sockets passed by systemd until they're used
+var systemd struct {
+	sync.Mutex
+	loaded bool
+	files  []systemdFile
+	err    error
+}
+
+type systemdFile struct {
+	name string
+	file *os.File
+}
+
+// listenSystemd returns the sockets passed by systemd, as documented by
+// sd_listen_fds(3). They can only be used once.
+func listenSystemd(name string) ([]net.Listener, error) {
+	systemd.Lock()
+	if !systemd.loaded {
+		systemd.files, systemd.err = systemdListenFiles()
+		systemd.loaded = true
+	}
+	if systemd.err != nil {
+		systemd.Unlock()
+		return nil, systemd.err
+	}
+	var files []*os.File
+	remaining := systemd.files[:0]
+	for _, f := range systemd.files {
+		if name == "" || f.name == name {
+			files = append(files, f.file)
+		} else {
+			remaining = append(remaining, f)
+		}
+	}
+	systemd.files = remaining
+	systemd.Unlock()
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no socket passed by systemd")
+	}
+
+	listeners := make([]net.Listener, 0, len(files))
+	for _, f := range files {
+		l, err := fileListener(f)
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+func systemdListenFiles() ([]systemdFile, error) {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		// the sockets were meant for another process
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LISTEN_FDS: %w", err)
+	}
+	if count < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS: %d", count)
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	files := make([]systemdFile, count)
+	for i := range files {
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		files[i] = systemdFile{
+			name: name,
+			file: os.NewFile(uintptr(systemdFirstFD+i), "systemd:"+name),
+		}
+	}
+	return files, nil
+}
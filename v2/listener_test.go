@@ -0,0 +1,155 @@
+package rebar_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/masonhubco/rebar/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Listen(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		givenSpec   string
+		wantNetwork string
+		wantErr     string
+	}{
+		{name: "host and port", givenSpec: "127.0.0.1:0", wantNetwork: "tcp"},
+		{name: "tcp scheme", givenSpec: "tcp://127.0.0.1:0", wantNetwork: "tcp"},
+		{name: "tcp4 scheme", givenSpec: "tcp4://127.0.0.1:0", wantNetwork: "tcp"},
+		{name: "unknown scheme", givenSpec: "udp://127.0.0.1:0", wantErr: `listen udp://127.0.0.1:0: unknown scheme "udp"`},
+		{name: "bad file descriptor", givenSpec: "fd://three", wantErr: `listen fd://three: invalid file descriptor "three"`},
+		{name: "no systemd socket", givenSpec: "systemd", wantErr: "listen systemd: no socket passed by systemd"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			listeners, err := rebar.Listen(tc.givenSpec)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, listeners, 1)
+			defer listeners[0].Close()
+			assert.Equal(t, tc.wantNetwork, listeners[0].Addr().Network())
+		})
+	}
+}
+
+func Test_Listen_IPv6Loopback(t *testing.T) {
+	t.Parallel()
+
+	if l, err := net.Listen("tcp6", "[::1]:0"); err != nil {
+		t.Skip("IPv6 is not available:", err)
+	} else {
+		l.Close()
+	}
+	listeners, err := rebar.Listen("[::1]:0")
+	require.NoError(t, err)
+	defer listeners[0].Close()
+	host, _, err := net.SplitHostPort(listeners[0].Addr().String())
+	require.NoError(t, err)
+	assert.Equal(t, "::1", host)
+}
+
+func Test_Listen_Unix(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.sock")
+
+	// a stale socket left by a previous process
+	stale, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	listeners, err := rebar.Listen("unix://" + path + "?mode=0660")
+	require.NoError(t, err)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0660), info.Mode().Perm())
+	// the socket is created in a private directory, which is removed once it's moved
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "app.sock", entries[0].Name())
+	assert.Equal(t, path, listeners[0].Addr().String())
+	conn, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	conn.Close()
+	require.NoError(t, listeners[0].Close())
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "the socket is removed when the listener is closed")
+
+	_, err = rebar.Listen("unix://" + filepath.Join(dir, "other.sock") + "?mode=rw")
+	assert.EqualError(t, err, `listen unix://`+filepath.Join(dir, "other.sock")+`?mode=rw: invalid mode "rw": strconv.ParseUint: parsing "rw": invalid syntax`)
+}
+
+func Test_Rebar_RunWithListeners(t *testing.T) {
+	t.Parallel()
+
+	socket := filepath.Join(t.TempDir(), "app.sock")
+	r := rebar.New(rebar.Options{
+		Listeners:    []string{"127.0.0.1:0", "tcp://127.0.0.1:0", "unix://" + socket},
+		ShutDownWait: time.Second,
+	})
+	r.Router.GET("/ping", func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	})
+
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- r.RunWithContext(ctx, stop)
+	}()
+	require.Eventually(t, func() bool { return r.Phase() == rebar.PhaseRunning },
+		time.Second, time.Millisecond)
+
+	addrs := r.Addrs()
+	require.Len(t, addrs, 3)
+	for _, addr := range addrs {
+		addr := addr
+		client := &http.Client{Transport: &http.Transport{
+			DisableKeepAlives: true,
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, addr.Network(), addr.String())
+			},
+		}}
+		resp, err := client.Get("http://rebar/ping")
+		require.NoError(t, err, addr.String())
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, "pong", string(body))
+	}
+
+	stop()
+	require.NoError(t, <-done)
+	_, err := os.Stat(socket)
+	assert.True(t, os.IsNotExist(err), "the unix socket is removed on shutdown")
+}
+
+func Test_Rebar_RunWithListeners_Error(t *testing.T) {
+	t.Parallel()
+
+	r := rebar.New(rebar.Options{Listeners: []string{"127.0.0.1:0", "bogus://"}})
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	err := r.RunWithContext(ctx, stop)
+	assert.EqualError(t, err, `[rebar] ERROR: listen bogus://: unknown scheme "bogus"`)
+}
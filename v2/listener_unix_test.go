@@ -0,0 +1,101 @@
+//go:build !windows
+// +build !windows
+
+package rebar_test
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/masonhubco/rebar/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Listen_FD(t *testing.T) {
+	t.Parallel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	f, err := l.(*net.TCPListener).File()
+	require.NoError(t, err)
+	defer f.Close()
+	// Listen takes ownership of the file descriptor, so give it its own
+	fd, err := syscall.Dup(int(f.Fd()))
+	require.NoError(t, err)
+
+	listeners, err := rebar.Listen("fd://" + strconv.Itoa(fd))
+	require.NoError(t, err)
+	defer listeners[0].Close()
+	assert.Equal(t, l.Addr().String(), listeners[0].Addr().String())
+}
+
+// Test_Listen_Systemd runs itself in a subprocess that inherits two sockets, the
+// way systemd passes them to socket activated units
+func Test_Listen_Systemd(t *testing.T) {
+	if os.Getenv("REBAR_TEST_SYSTEMD") == "1" {
+		// LISTEN_PID is only known once the process is started
+		t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+		admin, err := rebar.Listen("systemd://admin")
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		rest, err := rebar.Listen("systemd")
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Print(admin[0].Addr(), " ", len(rest), " ", rest[0].Addr())
+		os.Exit(0)
+	}
+
+	var files []*os.File
+	var addrs []string
+	for i := 0; i < 2; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer l.Close()
+		f, err := l.(*net.TCPListener).File()
+		require.NoError(t, err)
+		defer f.Close()
+		files = append(files, f)
+		addrs = append(addrs, l.Addr().String())
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^Test_Listen_Systemd$")
+	cmd.Env = append(os.Environ(),
+		"REBAR_TEST_SYSTEMD=1",
+		"LISTEN_FDS=2",
+		"LISTEN_FDNAMES=http:admin",
+	)
+	cmd.ExtraFiles = files
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	assert.Equal(t, fmt.Sprintf("%s 1 %s", addrs[1], addrs[0]), string(out))
+}
+
+// Test_Listen_SystemdInvalidCount runs itself in a subprocess, as the sockets passed
+// by systemd are only looked up once per process
+func Test_Listen_SystemdInvalidCount(t *testing.T) {
+	if os.Getenv("REBAR_TEST_SYSTEMD") == "1" {
+		t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+		_, err := rebar.Listen("systemd")
+		fmt.Print(err)
+		os.Exit(0)
+	}
+
+	for _, count := range []string{"two", "-1"} {
+		cmd := exec.Command(os.Args[0], "-test.run=^Test_Listen_SystemdInvalidCount$")
+		cmd.Env = append(os.Environ(), "REBAR_TEST_SYSTEMD=1", "LISTEN_FDS="+count)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		assert.Contains(t, string(out), "invalid LISTEN_FDS", count)
+	}
+}
@@ -14,8 +14,16 @@ type Logger interface {
 	With(fields ...zap.Field) *zap.Logger
 }
 
+// NewStandardLogger builds the default rebar logger, logging at info level
 func NewStandardLogger() (Logger, error) {
+	return NewStandardLoggerAt(zap.NewAtomicLevelAt(zap.InfoLevel))
+}
+
+// NewStandardLoggerAt is like NewStandardLogger, but logs at level. Changing level
+// applies right away to the logger and every logger derived from it with With.
+func NewStandardLoggerAt(level zap.AtomicLevel) (Logger, error) {
 	config := zap.NewProductionConfig()
+	config.Level = level
 	config.Encoding = "console"
 	config.EncoderConfig.EncodeLevel = func(l zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
 		lvl := l.CapitalString()
@@ -0,0 +1,211 @@
+package rebar
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// ErrLogLevelNotControlled is returned when changing the log level of an app whose
+// Logger was given without its LogLevel
+var ErrLogLevelNotControlled = errors.New("[rebar] the log level is not controlled by rebar, set Options.LogLevel")
+
+// LogLevelState is the log level of an app, as reported by the log level endpoint
+type LogLevelState struct {
+	Level string `json:"level"`
+	// Default is the level restored once a temporary change expires
+	Default string `json:"default"`
+	// ExpiresAt is set while a temporary change with a TTL is in effect
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// logLevelControl changes the atomic level of the logger, and restores the default
+// level when temporary changes expire
+type logLevelControl struct {
+	level zap.AtomicLevel
+	emit  func(Event)
+
+	mu       sync.Mutex
+	def      zapcore.Level
+	expires  time.Time
+	revert   *time.Timer
+	revertID int
+}
+
+func newLogLevelControl(level zap.AtomicLevel, emit func(Event)) *logLevelControl {
+	return &logLevelControl{level: level, emit: emit, def: level.Level()}
+}
+
+// set changes the level. Without ttl, the change is permanent and becomes the new
+// default level.
+func (l *logLevelControl) set(level zapcore.Level, ttl time.Duration) LogLevelState {
+	l.mu.Lock()
+	l.stopRevert()
+	l.level.SetLevel(level)
+	e := Event{Type: EventLogLevelChanged, Message: "log level set to " + level.String()}
+	if ttl > 0 {
+		l.expires = time.Now().Add(ttl)
+		l.revertID++
+		id := l.revertID
+		l.revert = time.AfterFunc(ttl, func() { l.expire(id) })
+		e.Message += ", until " + l.expires.Format(time.RFC3339)
+		e.Duration = ttl
+	} else {
+		l.def = level
+	}
+	state := l.stateLocked()
+	l.mu.Unlock()
+	l.emit(e)
+	return state
+}
+
+// toggleDebug switches to the debug level until toggled again, or back to the
+// default level when the debug level is on
+func (l *logLevelControl) toggleDebug(e Event) {
+	l.mu.Lock()
+	l.stopRevert()
+	next := zapcore.DebugLevel
+	if l.level.Level() == zapcore.DebugLevel {
+		next = l.def
+		if next == zapcore.DebugLevel {
+			next = zapcore.InfoLevel
+		}
+	}
+	l.level.SetLevel(next)
+	l.mu.Unlock()
+
+	e.Type = EventLogLevelChanged
+	e.Message = "log level set to " + next.String()
+	l.emit(e)
+}
+
+func (l *logLevelControl) expire(id int) {
+	l.mu.Lock()
+	if id != l.revertID || l.revert == nil {
+		// replaced by a later change
+		l.mu.Unlock()
+		return
+	}
+	l.revert = nil
+	l.expires = time.Time{}
+	l.level.SetLevel(l.def)
+	def := l.def
+	l.mu.Unlock()
+	l.emit(Event{Type: EventLogLevelChanged, Message: "log level reverted to " + def.String()})
+}
+
+func (l *logLevelControl) stopRevert() {
+	if l.revert != nil {
+		l.revert.Stop()
+		l.revert = nil
+	}
+	l.expires = time.Time{}
+}
+
+func (l *logLevelControl) state() LogLevelState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stateLocked()
+}
+
+func (l *logLevelControl) stateLocked() LogLevelState {
+	state := LogLevelState{Level: l.level.Level().String(), Default: l.def.String()}
+	if !l.expires.IsZero() {
+		expires := l.expires
+		state.ExpiresAt = &expires
+	}
+	return state
+}
+
+// LogLevel returns the atomic level of the app logger, or nil when the Logger was
+// given without its LogLevel. Prefer SetLogLevel to change it, which keeps track of
+// the default level.
+func (r *Rebar) LogLevel() *zap.AtomicLevel {
+	if r.logLevel == nil {
+		return nil
+	}
+	return &r.logLevel.level
+}
+
+// SetLogLevel changes the level of the app logger, and of every logger derived from
+// it like the request loggers. With a positive ttl, the change is temporary and the
+// previous level is restored after ttl. Otherwise, level becomes the default level.
+func (r *Rebar) SetLogLevel(level zapcore.Level, ttl time.Duration) (LogLevelState, error) {
+	if r.logLevel == nil {
+		return LogLevelState{}, ErrLogLevelNotControlled
+	}
+	return r.logLevel.set(level, ttl), nil
+}
+
+// logLevelRequest is the body of a PUT on the log level endpoint
+type logLevelRequest struct {
+	Level string `json:"level"`
+	// TTL is a duration, like 15m
+	TTL string `json:"ttl"`
+}
+
+// LogLevelHandler reports the log level on GET, and changes it on PUT with a JSON
+// body like {"level": "debug", "ttl": "15m"}. The ttl is optional. The handler isn't
+// authenticated, Options.AdminToken registers it behind a bearer token.
+func (r *Rebar) LogLevelHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if r.logLevel == nil {
+			c.AbortWithStatusJSON(http.StatusNotImplemented, gin.H{"error": ErrLogLevelNotControlled.Error()})
+			return
+		}
+		if c.Request.Method == http.MethodGet {
+			c.JSON(http.StatusOK, r.logLevel.state())
+			return
+		}
+
+		var req logLevelRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var level zapcore.Level
+		if err := level.UnmarshalText([]byte(req.Level)); req.Level == "" || err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid level %q", req.Level)})
+			return
+		}
+		var ttl time.Duration
+		if req.TTL != "" {
+			var err error
+			if ttl, err = time.ParseDuration(req.TTL); err != nil || ttl <= 0 {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid ttl %q", req.TTL)})
+				return
+			}
+		}
+		c.JSON(http.StatusOK, r.logLevel.set(level, ttl))
+	}
+}
+
+// registerLogLevelEndpoint registers the log level endpoint behind token, only when
+// there's one
+func (r *Rebar) registerLogLevelEndpoint(router gin.IRoutes, token string) {
+	if token == "" {
+		return
+	}
+	handlers := []gin.HandlerFunc{requireAdminToken(token), r.LogLevelHandler()}
+	router.GET("/debug/loglevel", handlers...)
+	router.PUT("/debug/loglevel", handlers...)
+}
+
+// requireAdminToken rejects the requests without the bearer token
+func requireAdminToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		given, ok := BearerToken(c)
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "unauthorized"})
+			return
+		}
+		c.Next()
+	}
+}
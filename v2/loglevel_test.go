@@ -0,0 +1,227 @@
+package rebar_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/masonhubco/rebar/v2"
+	"github.com/masonhubco/rebar/v2/middleware"
+	"github.com/masonhubco/rebar/v2/rebartest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func Test_Rebar_LogLevelEndpoint(t *testing.T) {
+	t.Parallel()
+
+	level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	app := rebartest.New(t, rebartest.Options{
+		Options:  rebar.Options{LogLevel: &level, AdminPort: freePort(t), AdminToken: "admin-token"},
+		InMemory: true,
+	})
+	app.Router.Use(middleware.Logger(app.Logger))
+	app.Router.GET("/work", func(c *gin.Context) {
+		rebar.LoggerFrom(c).Debug("working hard")
+		c.Status(http.StatusNoContent)
+	})
+	app.Start()
+
+	do := func(method, body string) (int, rebar.LogLevelState) {
+		req := httptest.NewRequest(method, "/debug/loglevel", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer admin-token")
+		rr := httptest.NewRecorder()
+		app.Admin.ServeHTTP(rr, req)
+		var state rebar.LogLevelState
+		_ = json.Unmarshal(rr.Body.Bytes(), &state)
+		return rr.Code, state
+	}
+	work := func() {
+		resp, err := app.Client.Get("/work")
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	debugLogs := func() int {
+		return app.Logs.FilterMessage("working hard").Len()
+	}
+
+	code, state := do(http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, rebar.LogLevelState{Level: "info", Default: "info"}, state)
+	work()
+	assert.Zero(t, debugLogs())
+
+	// request loggers follow the change right away
+	code, state = do(http.MethodPut, `{"level":"debug","ttl":"100ms"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "debug", state.Level)
+	assert.Equal(t, "info", state.Default)
+	require.NotNil(t, state.ExpiresAt)
+	work()
+	assert.Equal(t, 1, debugLogs())
+
+	// until the change expires
+	require.Eventually(t, func() bool { return level.Level() == zapcore.InfoLevel }, time.Second, 5*time.Millisecond)
+	work()
+	assert.Equal(t, 1, debugLogs())
+	changes := app.Logs.FilterField(zap.String("event", string(rebar.EventLogLevelChanged))).All()
+	require.Len(t, changes, 2)
+	assert.Equal(t, "log level reverted to info", changes[1].Message)
+
+	// a change without ttl becomes the default level
+	code, state = do(http.MethodPut, `{"level":"warn"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, rebar.LogLevelState{Level: "warn", Default: "warn"}, state)
+}
+
+func Test_Rebar_LogLevelEndpoint_Errors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		opts     rebar.Options
+		auth     string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "no token",
+			opts:     rebar.Options{AdminPort: "9090", AdminToken: "admin-token"},
+			body:     `{"level":"debug"}`,
+			wantCode: http.StatusUnauthorized,
+			wantBody: `{"status":"unauthorized"}`,
+		},
+		{
+			name:     "wrong token",
+			opts:     rebar.Options{AdminPort: "9090", AdminToken: "admin-token"},
+			auth:     "Bearer admin",
+			body:     `{"level":"debug"}`,
+			wantCode: http.StatusUnauthorized,
+			wantBody: `{"status":"unauthorized"}`,
+		},
+		{
+			name:     "token without scheme",
+			opts:     rebar.Options{AdminPort: "9090", AdminToken: "admin-token"},
+			auth:     "admin-token",
+			body:     `{"level":"debug"}`,
+			wantCode: http.StatusUnauthorized,
+			wantBody: `{"status":"unauthorized"}`,
+		},
+		{
+			name:     "case insensitive scheme",
+			opts:     rebar.Options{AdminPort: "9090", AdminToken: "admin-token"},
+			auth:     "bearer admin-token",
+			body:     `{"level":"debug"}`,
+			wantCode: http.StatusOK,
+			wantBody: `{"level":"debug","default":"debug"}`,
+		},
+		{
+			name:     "invalid level",
+			opts:     rebar.Options{AdminPort: "9090", AdminToken: "admin-token"},
+			auth:     "Bearer admin-token",
+			body:     `{"level":"verbose"}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"error":"invalid level \"verbose\""}`,
+		},
+		{
+			name:     "missing level",
+			opts:     rebar.Options{AdminPort: "9090", AdminToken: "admin-token"},
+			auth:     "Bearer admin-token",
+			body:     `{"ttl":"1m"}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"error":"invalid level \"\""}`,
+		},
+		{
+			name:     "invalid ttl",
+			opts:     rebar.Options{AdminPort: "9090", AdminToken: "admin-token"},
+			auth:     "Bearer admin-token",
+			body:     `{"level":"debug","ttl":"-1m"}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"error":"invalid ttl \"-1m\""}`,
+		},
+		{
+			name:     "logger without level",
+			opts:     rebar.Options{AdminPort: "9090", AdminToken: "admin-token", Logger: zap.NewNop()},
+			auth:     "Bearer admin-token",
+			body:     `{"level":"debug"}`,
+			wantCode: http.StatusNotImplemented,
+			wantBody: `{"error":"[rebar] the log level is not controlled by rebar, set Options.LogLevel"}`,
+		},
+		{
+			name:     "disabled without token",
+			opts:     rebar.Options{AdminPort: "9090"},
+			body:     `{"level":"debug"}`,
+			wantCode: http.StatusNotFound,
+			wantBody: `404 page not found`,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := rebar.New(tc.opts)
+			req := httptest.NewRequest(http.MethodPut, "/debug/loglevel", strings.NewReader(tc.body))
+			req.Header.Set("Authorization", tc.auth)
+			rr := httptest.NewRecorder()
+			r.Admin.ServeHTTP(rr, req)
+			assert.Equal(t, tc.wantCode, rr.Code)
+			assert.Equal(t, tc.wantBody, rr.Body.String())
+		})
+	}
+}
+
+func Test_Rebar_LogLevelEndpoint_Admin(t *testing.T) {
+	t.Parallel()
+
+	r := rebar.New(rebar.Options{AdminPort: "9090", AdminToken: "admin-token"})
+	req := httptest.NewRequest(http.MethodGet, "/debug/loglevel", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+
+	// served by the admin router only
+	rr := httptest.NewRecorder()
+	r.Router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	rr = httptest.NewRecorder()
+	r.Admin.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"level":"info","default":"info"}`, rr.Body.String())
+
+	// and never by the public one
+	r = rebar.New(rebar.Options{AdminToken: "admin-token"})
+	rr = httptest.NewRecorder()
+	r.Router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func Test_Rebar_SetLogLevel(t *testing.T) {
+	t.Parallel()
+
+	r := rebar.New(rebar.Options{})
+	require.NotNil(t, r.LogLevel())
+	state, err := r.SetLogLevel(zapcore.ErrorLevel, 0)
+	require.NoError(t, err)
+	assert.Equal(t, rebar.LogLevelState{Level: "error", Default: "error"}, state)
+	assert.Equal(t, zapcore.ErrorLevel, r.LogLevel().Level())
+
+	// a later change cancels the pending revert
+	_, err = r.SetLogLevel(zapcore.DebugLevel, 20*time.Millisecond)
+	require.NoError(t, err)
+	_, err = r.SetLogLevel(zapcore.WarnLevel, 0)
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, zapcore.WarnLevel, r.LogLevel().Level())
+
+	r = rebar.New(rebar.Options{Logger: zap.NewNop()})
+	assert.Nil(t, r.LogLevel())
+	_, err = r.SetLogLevel(zapcore.DebugLevel, 0)
+	assert.ErrorIs(t, err, rebar.ErrLogLevelNotControlled)
+}
@@ -0,0 +1,30 @@
+//go:build !windows
+// +build !windows
+
+package rebar
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchLogLevel toggles the debug level when the process receives SIGUSR1, until
+// ctx is done. The signal is caught from the moment it returns.
+func (r *Rebar) watchLogLevel(ctx context.Context) {
+	usr1 := make(chan os.Signal, 1)
+	signal.Notify(usr1, syscall.SIGUSR1)
+
+	go func() {
+		defer signal.Stop(usr1)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case s := <-usr1:
+				r.logLevel.toggleDebug(Event{Signal: s})
+			}
+		}
+	}()
+}
@@ -0,0 +1,35 @@
+//go:build !windows
+// +build !windows
+
+package rebar_test
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/masonhubco/rebar/v2"
+	"github.com/masonhubco/rebar/v2/rebartest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// not parallel, as the signal reaches every app running in the test process
+func Test_Rebar_LogLevelSignal(t *testing.T) {
+	level := zap.NewAtomicLevelAt(zapcore.WarnLevel)
+	app := rebartest.New(t, rebartest.Options{Options: rebar.Options{LogLevel: &level}, InMemory: true}).Start()
+
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGUSR1))
+	require.Eventually(t, func() bool { return level.Level() == zapcore.DebugLevel }, time.Second, time.Millisecond)
+
+	// toggled back to the default level
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGUSR1))
+	require.Eventually(t, func() bool { return level.Level() == zapcore.WarnLevel }, time.Second, time.Millisecond)
+
+	changes := app.Logs.FilterField(zap.String("event", string(rebar.EventLogLevelChanged))).All()
+	require.NotEmpty(t, changes)
+	assert.Equal(t, "log level set to debug", changes[0].Message)
+	assert.Equal(t, "user defined signal 1", changes[0].ContextMap()["signal"])
+}
@@ -0,0 +1,7 @@
+package rebar
+
+import "context"
+
+// watchLogLevel does nothing, as there's no SIGUSR1 on Windows. The log level can
+// still be changed on the admin endpoint.
+func (r *Rebar) watchLogLevel(ctx context.Context) {}
@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/masonhubco/rebar/v2"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrNoCredentials is returned by authenticators when the request doesn't carry
+	// the credentials they check, so that the next authenticator is tried
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials is wrapped by the errors of authenticators when the
+	// credentials of the request are not valid
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Authenticator authenticates requests with one kind of credentials
+type Authenticator interface {
+	// Authenticate returns the principal of the request. The error is ErrNoCredentials
+	// when the request doesn't carry the credentials, and wraps ErrInvalidCredentials
+	// when they're not valid. Any other error is a failure to check them. On success,
+	// it may add log fields identifying the credentials with rebar.AddLogFields.
+	Authenticate(c *gin.Context) (*rebar.Principal, error)
+	// Challenge is the WWW-Authenticate challenge of the credentials, like Bearer.
+	// It's empty when the credentials are not sent in a header.
+	Challenge() string
+}
+
+// Authenticate returns a middleware that tries the authenticators in order, and
+// authenticates the request as the principal of the first one that succeeds. The
+// principal is available to handlers with rebar.PrincipalFrom and
+// rebar.PrincipalFromContext, and is added to the request logs as the principal
+// and principal_type fields. When none succeeds, the request is aborted with a 401
+// listing the challenges of the authenticators in WWW-Authenticate, or with a 500
+// when credentials couldn't be checked.
+func Authenticate(authenticators ...Authenticator) gin.HandlerFunc {
+	var challenges []string
+	seen := map[string]bool{}
+	for _, authenticator := range authenticators {
+		if challenge := authenticator.Challenge(); challenge != "" && !seen[challenge] {
+			seen[challenge] = true
+			challenges = append(challenges, challenge)
+		}
+	}
+
+	return func(c *gin.Context) {
+		var invalid, failed []error
+		for _, authenticator := range authenticators {
+			principal, err := authenticator.Authenticate(c)
+			switch {
+			case err == nil:
+				rebar.SetPrincipal(c, principal)
+				rebar.AddLogFields(c, zap.String("principal", principal.Subject),
+					zap.String("principal_type", principal.Type))
+				c.Next()
+				return
+			case errors.Is(err, ErrNoCredentials):
+			case errors.Is(err, ErrInvalidCredentials):
+				invalid = append(invalid, err)
+			default:
+				failed = append(failed, err)
+			}
+		}
+
+		logger := rebar.LoggerFrom(c)
+		if len(failed) > 0 {
+			logger.Error("unable to authenticate the request", zap.Errors("errors", append(failed, invalid...)))
+			rebar.AbortWithError(c, http.StatusInternalServerError, errors.New("unable to authenticate the request"))
+			return
+		}
+		if len(invalid) > 0 {
+			logger.Warn("credentials not valid", zap.Errors("errors", invalid))
+		} else {
+			logger.Warn("no credentials in request")
+		}
+		for _, challenge := range challenges {
+			c.Writer.Header().Add("WWW-Authenticate", challenge)
+		}
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "unauthorized"})
+	}
+}
+
+// RequireScopes returns a middleware that lets requests through when their
+// principal was granted every scope, whichever way it was authenticated. Other
+// requests are aborted with a 403.
+func RequireScopes(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := rebar.PrincipalFrom(c)
+		if !ok {
+			rebar.LoggerFrom(c).Warn("no principal to check the scopes of")
+			rebar.AbortWithError(c, http.StatusForbidden, errors.New("forbidden"))
+			return
+		}
+		var missing []string
+		for _, scope := range scopes {
+			if !principal.HasScopes(scope) {
+				missing = append(missing, scope)
+			}
+		}
+		if len(missing) > 0 {
+			rebar.LoggerFrom(c).Warn("principal missing scopes",
+				zap.Strings("required", scopes), zap.Strings("granted", principal.Scopes))
+			rebar.AbortWithError(c, http.StatusForbidden,
+				fmt.Errorf("missing scopes: %s", strings.Join(missing, ", ")))
+			return
+		}
+		c.Next()
+	}
+}
+
+// ClientCertAuthenticator authenticates requests by the client certificate verified
+// during the TLS handshake, which requires a server verifying client certificates,
+// like with rebar.TLSOptions.ClientCAFile. The subject of the principal is the
+// common name of the certificate.
+func ClientCertAuthenticator() Authenticator {
+	return clientCertAuthenticator{}
+}
+
+type clientCertAuthenticator struct{}
+
+func (clientCertAuthenticator) Authenticate(c *gin.Context) (*rebar.Principal, error) {
+	if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 || len(c.Request.TLS.VerifiedChains[0]) == 0 {
+		return nil, ErrNoCredentials
+	}
+	cert := c.Request.TLS.VerifiedChains[0][0]
+	return &rebar.Principal{
+		Subject: cert.Subject.CommonName,
+		Type:    rebar.PrincipalClientCertificate,
+		Attributes: map[string]interface{}{
+			"serial_number": hex.EncodeToString(cert.SerialNumber.Bytes()),
+			"issuer":        cert.Issuer.String(),
+			"dns_names":     cert.DNSNames,
+		},
+	}, nil
+}
+
+func (clientCertAuthenticator) Challenge() string {
+	return ""
+}
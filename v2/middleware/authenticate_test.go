@@ -0,0 +1,228 @@
+package middleware_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/masonhubco/rebar/v2"
+	"github.com/masonhubco/rebar/v2/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// headerAuthenticator authenticates requests carrying its header, with the value
+// as the subject when it's valid
+type headerAuthenticator struct {
+	header, valid string
+	err           error
+}
+
+func (a headerAuthenticator) Authenticate(c *gin.Context) (*rebar.Principal, error) {
+	value := c.GetHeader(a.header)
+	switch {
+	case value == "":
+		return nil, middleware.ErrNoCredentials
+	case a.err != nil:
+		return nil, a.err
+	case value != a.valid:
+		return nil, middleware.ErrInvalidCredentials
+	}
+	return &rebar.Principal{Subject: value, Type: a.header}, nil
+}
+
+func (a headerAuthenticator) Challenge() string {
+	return a.header
+}
+
+func Test_Authenticate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		givenHeaders   map[string]string
+		givenBroken    bool
+		wantCode       int
+		wantBody       string
+		wantPrincipal  *rebar.Principal
+		wantChallenges []string
+		wantLog        string
+	}{
+		{
+			name:          "first authenticator",
+			givenHeaders:  map[string]string{"Token": "service"},
+			wantCode:      http.StatusOK,
+			wantPrincipal: &rebar.Principal{Subject: "service", Type: "Token"},
+		},
+		{
+			name:          "next authenticator after missing credentials",
+			givenHeaders:  map[string]string{"Key": "partner"},
+			wantCode:      http.StatusOK,
+			wantPrincipal: &rebar.Principal{Subject: "partner", Type: "Key"},
+		},
+		{
+			name:          "next authenticator after invalid credentials",
+			givenHeaders:  map[string]string{"Token": "wrong", "Key": "partner"},
+			wantCode:      http.StatusOK,
+			wantPrincipal: &rebar.Principal{Subject: "partner", Type: "Key"},
+		},
+		{
+			name:           "no credentials",
+			wantCode:       http.StatusUnauthorized,
+			wantBody:       `{"status":"unauthorized"}`,
+			wantChallenges: []string{"Token", "Key"},
+			wantLog:        "no credentials in request",
+		},
+		{
+			name:           "invalid credentials",
+			givenHeaders:   map[string]string{"Key": "wrong"},
+			wantCode:       http.StatusUnauthorized,
+			wantBody:       `{"status":"unauthorized"}`,
+			wantChallenges: []string{"Token", "Key"},
+			wantLog:        "credentials not valid",
+		},
+		{
+			name:         "unable to check credentials",
+			givenHeaders: map[string]string{"Key": "partner"},
+			givenBroken:  true,
+			wantCode:     http.StatusInternalServerError,
+			wantBody:     `{"request_id":"","error":"unable to authenticate the request"}`,
+			wantLog:      "unable to authenticate the request",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			key := headerAuthenticator{header: "Key", valid: "partner"}
+			if tc.givenBroken {
+				key.err = errors.New("connection refused")
+			}
+			core, logs := observer.New(zapcore.DebugLevel)
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				c.Set(rebar.LoggerKey, zap.New(core))
+			})
+			router.Use(middleware.Authenticate(
+				headerAuthenticator{header: "Token", valid: "service"},
+				key,
+				// a duplicate challenge is only sent once
+				headerAuthenticator{header: "Token", valid: "other"},
+			))
+			router.GET("/", func(c *gin.Context) {
+				principal, ok := rebar.PrincipalFrom(c)
+				require.True(t, ok)
+				fromContext, ok := rebar.PrincipalFromContext(c.Request.Context())
+				require.True(t, ok)
+				assert.Same(t, principal, fromContext)
+				assert.Equal(t, tc.wantPrincipal, principal)
+				rebar.LoggerFrom(c).Info("handled")
+				c.Status(http.StatusOK)
+			})
+
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for header, value := range tc.givenHeaders {
+				req.Header.Set(header, value)
+			}
+			router.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.wantCode, rr.Code)
+			assert.Equal(t, tc.wantChallenges, rr.Header().Values("WWW-Authenticate"))
+			require.Equal(t, 1, logs.Len())
+			entry := logs.All()[0]
+			if tc.wantCode == http.StatusOK {
+				assert.Equal(t, map[string]interface{}{
+					"principal":      tc.wantPrincipal.Subject,
+					"principal_type": tc.wantPrincipal.Type,
+				}, entry.ContextMap())
+				return
+			}
+			assert.JSONEq(t, tc.wantBody, rr.Body.String())
+			assert.Equal(t, tc.wantLog, entry.Message)
+		})
+	}
+}
+
+func Test_ClientCertAuthenticator(t *testing.T) {
+	t.Parallel()
+
+	cert := &x509.Certificate{
+		Subject:      pkix.Name{CommonName: "orders"},
+		Issuer:       pkix.Name{CommonName: "internal CA"},
+		SerialNumber: big.NewInt(0x2a),
+		DNSNames:     []string{"orders.internal"},
+	}
+
+	tests := []struct {
+		name          string
+		givenTLS      *tls.ConnectionState
+		wantCode      int
+		wantPrincipal *rebar.Principal
+	}{
+		{
+			name:     "verified certificate",
+			givenTLS: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}},
+			wantCode: http.StatusOK,
+			wantPrincipal: &rebar.Principal{
+				Subject: "orders",
+				Type:    rebar.PrincipalClientCertificate,
+				Attributes: map[string]interface{}{
+					"serial_number": "2a",
+					"issuer":        "CN=internal CA",
+					"dns_names":     []string{"orders.internal"},
+				},
+			},
+		},
+		{name: "certificate not verified", givenTLS: &tls.ConnectionState{}, wantCode: http.StatusUnauthorized},
+		{name: "no tls", wantCode: http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			router := gin.New()
+			router.Use(middleware.Authenticate(middleware.ClientCertAuthenticator()))
+			router.GET("/", func(c *gin.Context) {
+				principal, _ := rebar.PrincipalFrom(c)
+				assert.Equal(t, tc.wantPrincipal, principal)
+				c.Status(http.StatusOK)
+			})
+
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.TLS = tc.givenTLS
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.wantCode, rr.Code)
+			// client certificates are not challenged over HTTP
+			assert.Empty(t, rr.Header().Values("WWW-Authenticate"))
+		})
+	}
+}
+
+func Test_RequireScopes_Unauthenticated(t *testing.T) {
+	t.Parallel()
+
+	router := gin.New()
+	router.GET("/", middleware.RequireScopes("orders:read"), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.JSONEq(t, `{"request_id":"","error":"forbidden"}`, rr.Body.String())
+}
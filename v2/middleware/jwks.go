@@ -0,0 +1,345 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrUnknownKey is returned when no key matches the key ID of a token
+var ErrUnknownKey = errors.New("jwks: no key matches the key ID")
+
+// ErrKeysUnavailable is wrapped by the errors of key resolvers when the keys can't
+// be loaded, which is not a problem with the token. The JWT middleware fails the
+// request with a 500 for those, instead of a 401.
+var ErrKeysUnavailable = errors.New("jwks: keys unavailable")
+
+// KeyResolver returns the key verifying a token signed with alg, by the key of ID
+// kid. The key is a []byte for HS256, an *rsa.PublicKey for RS256 and an
+// *ecdsa.PublicKey for ES256.
+type KeyResolver interface {
+	Key(ctx context.Context, kid, alg string) (interface{}, error)
+}
+
+// keysUnavailableError keeps the message and the cause of a failure to load the
+// keys, while matching ErrKeysUnavailable
+type keysUnavailableError struct {
+	err error
+}
+
+func (e keysUnavailableError) Error() string {
+	return e.err.Error()
+}
+
+func (e keysUnavailableError) Unwrap() error {
+	return e.err
+}
+
+func (e keysUnavailableError) Is(target error) bool {
+	return target == ErrKeysUnavailable
+}
+
+// StaticKey resolves every token to key, whatever its key ID
+func StaticKey(key interface{}) KeyResolver {
+	return staticKey{key: key}
+}
+
+type staticKey struct {
+	key interface{}
+}
+
+func (s staticKey) Key(context.Context, string, string) (interface{}, error) {
+	return s.key, nil
+}
+
+// JWKSOptions configures a JWKS
+type JWKSOptions struct {
+	// RefreshInterval defaults to 1 hour. It's how long the keys are used before
+	// they're loaded again.
+	RefreshInterval time.Duration
+	// MinRefreshInterval defaults to 1 minute. A token signed by an unknown key ID
+	// reloads the keys, so that rotated keys are picked up, but not more often
+	// than that.
+	MinRefreshInterval time.Duration
+	// Client defaults to an HTTP client timing out after 10 seconds. It's used to
+	// fetch the keys from a URL.
+	Client *http.Client
+}
+
+func (o JWKSOptions) valuesOrDefaults() JWKSOptions {
+	if o.RefreshInterval == 0 {
+		o.RefreshInterval = time.Hour
+	}
+	if o.MinRefreshInterval == 0 {
+		o.MinRefreshInterval = time.Minute
+	}
+	if o.Client == nil {
+		o.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return o
+}
+
+// JWKS is a JSON Web Key Set, loaded from a file or a URL. Keys are loaded on
+// first use, then reloaded periodically and when a token is signed by a key ID
+// that's not in the set. Keys that can't be reloaded are kept in use. Loading
+// happens outside of the lock guarding the keys, so that known keys are served
+// while the set is reloaded, and concurrent lookups share a single load.
+type JWKS struct {
+	opts JWKSOptions
+	load func(ctx context.Context) ([]byte, error)
+
+	mu       sync.Mutex
+	keys     map[string]jwk
+	loadedAt time.Time
+	// triedAt is when the keys were last loaded, successfully or not
+	triedAt time.Time
+	// loadErr is why the keys were never loaded
+	loadErr error
+	// refreshing is the load in flight, if any
+	refreshing *jwksRefresh
+}
+
+// jwksRefresh is a load of the keys, shared by everyone waiting for it
+type jwksRefresh struct {
+	done chan struct{}
+	err  error
+}
+
+type jwk struct {
+	alg string
+	key interface{}
+}
+
+// NewFileJWKS creates a JWKS loaded from the file at path
+func NewFileJWKS(path string, opts JWKSOptions) *JWKS {
+	return &JWKS{
+		opts: opts.valuesOrDefaults(),
+		load: func(context.Context) ([]byte, error) {
+			return os.ReadFile(path)
+		},
+	}
+}
+
+// NewRemoteJWKS creates a JWKS fetched from url, like the jwks_uri of an OpenID
+// provider
+func NewRemoteJWKS(url string, opts JWKSOptions) *JWKS {
+	opts = opts.valuesOrDefaults()
+	return &JWKS{
+		opts: opts,
+		load: func(ctx context.Context) ([]byte, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return nil, err
+			}
+			resp, err := opts.Client.Do(req)
+			if err != nil {
+				return nil, err
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return nil, fmt.Errorf("unexpected status %s", resp.Status)
+			}
+			return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		},
+	}
+}
+
+// Refresh loads the keys now. It can be called at startup, so that a missing or
+// invalid key set is noticed before the first request.
+func (k *JWKS) Refresh(ctx context.Context) error {
+	k.mu.Lock()
+	refresh := k.startRefresh()
+	k.mu.Unlock()
+	select {
+	case <-refresh.done:
+		return refresh.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// startRefresh starts loading the keys, unless a load is in flight already. k.mu
+// must be held. The load isn't tied to the context of any caller, as others may
+// wait for it.
+func (k *JWKS) startRefresh() *jwksRefresh {
+	if k.refreshing != nil {
+		return k.refreshing
+	}
+	refresh := &jwksRefresh{done: make(chan struct{})}
+	k.refreshing = refresh
+	k.triedAt = time.Now()
+	go func() {
+		keys, err := k.fetch(context.Background())
+		k.mu.Lock()
+		if err == nil {
+			k.keys = keys
+			k.loadedAt = time.Now()
+		} else if k.keys == nil {
+			k.loadErr = err
+		}
+		k.refreshing = nil
+		k.mu.Unlock()
+		refresh.err = err
+		close(refresh.done)
+	}()
+	return refresh
+}
+
+func (k *JWKS) fetch(ctx context.Context) (map[string]jwk, error) {
+	raw, err := k.load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("jwks: unable to load the keys: %w", err)
+	}
+	keys, err := parseJWKS(raw)
+	if err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+	return keys, nil
+}
+
+// Key implements KeyResolver. A token without key ID is verified by the only key
+// of the set, if there's only one. A known key is served right away, even when
+// the set is stale and reloaded in the background. An unknown key ID waits for the
+// keys to be reloaded, at most every MinRefreshInterval.
+func (k *JWKS) Key(ctx context.Context, kid, alg string) (interface{}, error) {
+	k.mu.Lock()
+	now := time.Now()
+	stale := now.Sub(k.loadedAt) >= k.opts.RefreshInterval
+	due := now.Sub(k.triedAt) >= k.opts.MinRefreshInterval
+	_, known := k.lookup(kid)
+	var wait *jwksRefresh
+	switch {
+	case known && stale && due:
+		// a failed reload keeps the keys loaded before in use
+		k.startRefresh()
+	case !known && (due || k.refreshing != nil):
+		wait = k.startRefresh()
+	}
+	k.mu.Unlock()
+
+	if wait != nil {
+		select {
+		case <-wait.done:
+		case <-ctx.Done():
+			return nil, keysUnavailableError{err: ctx.Err()}
+		}
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.keys == nil {
+		return nil, keysUnavailableError{err: k.loadErr}
+	}
+	found, ok := k.lookup(kid)
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, kid)
+	}
+	if found.alg != "" && found.alg != alg {
+		return nil, fmt.Errorf("jwks: key %q is for %s, not %s", kid, found.alg, alg)
+	}
+	return found.key, nil
+}
+
+func (k *JWKS) lookup(kid string) (jwk, bool) {
+	if kid == "" && len(k.keys) == 1 {
+		for _, key := range k.keys {
+			return key, true
+		}
+	}
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+// parseJWKS decodes the signing keys of a key set, skipping the ones of an
+// unsupported type
+func parseJWKS(raw []byte) (map[string]jwk, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Alg string `json:"alg"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("invalid key set: %w", err)
+	}
+	keys := map[string]jwk{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var key interface{}
+		var err error
+		switch k.Kty {
+		case "RSA":
+			key, err = rsaKey(k.N, k.E)
+		case "EC":
+			if k.Crv != "P-256" {
+				continue
+			}
+			key, err = ecKey(k.X, k.Y)
+		case "oct":
+			key, err = base64.RawURLEncoding.DecodeString(k.K)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = jwk{alg: k.Alg, key: key}
+	}
+	return keys, nil
+}
+
+func rsaKey(n, e string) (*rsa.PublicKey, error) {
+	modulus, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, err
+	}
+	exponent, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, err
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(modulus),
+		E: int(new(big.Int).SetBytes(exponent).Int64()),
+	}, nil
+}
+
+func ecKey(x, y string) (*ecdsa.PublicKey, error) {
+	xBytes, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil {
+		return nil, err
+	}
+	yBytes, err := base64.RawURLEncoding.DecodeString(y)
+	if err != nil {
+		return nil, err
+	}
+	key := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(xBytes),
+		Y:     new(big.Int).SetBytes(yBytes),
+	}
+	if !key.Curve.IsOnCurve(key.X, key.Y) {
+		return nil, errors.New("point not on the P-256 curve")
+	}
+	return key, nil
+}
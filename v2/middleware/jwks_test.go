@@ -0,0 +1,290 @@
+package middleware_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/masonhubco/rebar/v2/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testKeys are the signing keys of the tests, by key ID
+type testKeys struct {
+	hmac  []byte
+	rsa   *rsa.PrivateKey
+	ecdsa *ecdsa.PrivateKey
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return testKeys{hmac: []byte("0123456789abcdef0123456789abcdef"), rsa: rsaKey, ecdsa: ecKey}
+}
+
+// jwks marshals the public keys as a key set, with the hs, rs and es key IDs
+func (k testKeys) jwks(t *testing.T) []byte {
+	t.Helper()
+	encode := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	raw, err := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "oct", "kid": "hs", "alg": "HS256", "k": encode(k.hmac)},
+		{"kty": "RSA", "kid": "rs", "use": "sig", "n": encode(k.rsa.N.Bytes()),
+			"e": encode(big.NewInt(int64(k.rsa.E)).Bytes())},
+		{"kty": "EC", "kid": "es", "crv": "P-256", "x": encode(k.ecdsa.X.Bytes()), "y": encode(k.ecdsa.Y.Bytes())},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "ignored", "e": "ignored"},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": "ignored"},
+	}})
+	require.NoError(t, err)
+	return raw
+}
+
+func writeJWKS(t *testing.T, raw []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, raw, 0o600))
+	return path
+}
+
+func Test_JWKS_Key(t *testing.T) {
+	t.Parallel()
+
+	keys := newTestKeys(t)
+	jwks := middleware.NewFileJWKS(writeJWKS(t, keys.jwks(t)), middleware.JWKSOptions{})
+
+	tests := []struct {
+		name     string
+		givenKid string
+		givenAlg string
+		wantKey  interface{}
+		wantErr  string
+	}{
+		{name: "hmac key", givenKid: "hs", givenAlg: "HS256", wantKey: keys.hmac},
+		{name: "rsa key", givenKid: "rs", givenAlg: "RS256", wantKey: &keys.rsa.PublicKey},
+		{name: "ecdsa key", givenKid: "es", givenAlg: "ES256", wantKey: &keys.ecdsa.PublicKey},
+		{name: "algorithm of another key", givenKid: "hs", givenAlg: "RS256", wantErr: `jwks: key "hs" is for HS256, not RS256`},
+		{name: "encryption key", givenKid: "enc", givenAlg: "RS256", wantErr: `jwks: no key matches the key ID "enc"`},
+		{name: "unsupported key", givenKid: "ed", givenAlg: "EdDSA", wantErr: `jwks: no key matches the key ID "ed"`},
+		{name: "no key ID among many keys", givenKid: "", givenAlg: "HS256", wantErr: `jwks: no key matches the key ID ""`},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			key, err := jwks.Key(context.Background(), tc.givenKid, tc.givenAlg)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantKey, key)
+		})
+	}
+}
+
+func Test_JWKS_SingleKey(t *testing.T) {
+	t.Parallel()
+
+	raw := []byte(`{"keys":[{"kty":"oct","k":"c2VjcmV0"}]}`)
+	jwks := middleware.NewFileJWKS(writeJWKS(t, raw), middleware.JWKSOptions{})
+
+	key, err := jwks.Key(context.Background(), "", "HS256")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("secret"), key)
+}
+
+func Test_JWKS_Refresh(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		given   []byte
+		wantErr string
+	}{
+		{name: "valid key set", given: []byte(`{"keys":[]}`)},
+		{name: "not json", given: []byte(`keys`), wantErr: "jwks: invalid key set: invalid character 'k' looking for beginning of value"},
+		{name: "invalid key", given: []byte(`{"keys":[{"kty":"EC","kid":"es","crv":"P-256","x":"AQ","y":"AQ"}]}`),
+			wantErr: `jwks: invalid key "es": point not on the P-256 curve`},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			jwks := middleware.NewFileJWKS(writeJWKS(t, tc.given), middleware.JWKSOptions{})
+			err := jwks.Refresh(context.Background())
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		t.Parallel()
+
+		jwks := middleware.NewFileJWKS(filepath.Join(t.TempDir(), "missing.json"), middleware.JWKSOptions{})
+		assert.ErrorIs(t, jwks.Refresh(context.Background()), os.ErrNotExist)
+		// the keys are never loaded, so every lookup fails with the load error
+		_, err := jwks.Key(context.Background(), "hs", "HS256")
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		assert.ErrorIs(t, err, middleware.ErrKeysUnavailable)
+	})
+}
+
+// jwksServer serves a key set that can be changed, broken or slowed down during a
+// test
+type jwksServer struct {
+	mu       sync.Mutex
+	keys     string
+	broken   bool
+	requests int
+	// hang holds the responses until it's closed, when it's set
+	hang chan struct{}
+}
+
+func (s *jwksServer) requestCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *jwksServer) set(keys string, broken bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys, s.broken = keys, broken
+}
+
+func (s *jwksServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	hang := s.hang
+	s.mu.Unlock()
+	if hang != nil {
+		<-hang
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	if s.broken {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	_, _ = w.Write([]byte(s.keys))
+}
+
+func Test_JWKS_Remote(t *testing.T) {
+	t.Parallel()
+
+	const (
+		keyA = `{"keys":[{"kty":"oct","kid":"a","k":"YQ"}]}`
+		keyB = `{"keys":[{"kty":"oct","kid":"b","k":"Yg"}]}`
+	)
+
+	t.Run("picks up a rotated key", func(t *testing.T) {
+		t.Parallel()
+
+		backend := &jwksServer{keys: keyA}
+		server := httptest.NewServer(backend)
+		defer server.Close()
+		jwks := middleware.NewRemoteJWKS(server.URL, middleware.JWKSOptions{MinRefreshInterval: time.Nanosecond})
+
+		key, err := jwks.Key(context.Background(), "a", "HS256")
+		require.NoError(t, err)
+		assert.Equal(t, []byte("a"), key)
+
+		backend.set(keyB, false)
+		key, err = jwks.Key(context.Background(), "b", "HS256")
+		require.NoError(t, err)
+		assert.Equal(t, []byte("b"), key)
+		assert.Equal(t, 2, backend.requestCount())
+	})
+
+	t.Run("limits reloads for unknown keys", func(t *testing.T) {
+		t.Parallel()
+
+		backend := &jwksServer{keys: keyA}
+		server := httptest.NewServer(backend)
+		defer server.Close()
+		jwks := middleware.NewRemoteJWKS(server.URL, middleware.JWKSOptions{MinRefreshInterval: time.Hour})
+		require.NoError(t, jwks.Refresh(context.Background()))
+
+		backend.set(keyB, false)
+		for i := 0; i < 3; i++ {
+			_, err := jwks.Key(context.Background(), "b", "HS256")
+			assert.ErrorIs(t, err, middleware.ErrUnknownKey)
+		}
+		assert.Equal(t, 1, backend.requestCount())
+	})
+
+	t.Run("keeps the keys when reloading fails", func(t *testing.T) {
+		t.Parallel()
+
+		backend := &jwksServer{keys: keyA}
+		server := httptest.NewServer(backend)
+		defer server.Close()
+		jwks := middleware.NewRemoteJWKS(server.URL, middleware.JWKSOptions{
+			RefreshInterval:    time.Nanosecond,
+			MinRefreshInterval: time.Nanosecond,
+		})
+		require.NoError(t, jwks.Refresh(context.Background()))
+
+		backend.set(keyA, true)
+		assert.EqualError(t, jwks.Refresh(context.Background()),
+			"jwks: unable to load the keys: unexpected status 502 Bad Gateway")
+		key, err := jwks.Key(context.Background(), "a", "HS256")
+		require.NoError(t, err)
+		assert.Equal(t, []byte("a"), key)
+		// the stale keys are reloaded in the background
+		assert.Eventually(t, func() bool { return backend.requestCount() == 3 }, time.Second, time.Millisecond)
+	})
+
+	t.Run("serves known keys while reloading", func(t *testing.T) {
+		t.Parallel()
+
+		backend := &jwksServer{keys: keyA}
+		server := httptest.NewServer(backend)
+		defer server.Close()
+		jwks := middleware.NewRemoteJWKS(server.URL, middleware.JWKSOptions{
+			RefreshInterval:    time.Nanosecond,
+			MinRefreshInterval: time.Nanosecond,
+		})
+		require.NoError(t, jwks.Refresh(context.Background()))
+
+		hang := make(chan struct{})
+		backend.mu.Lock()
+		backend.hang = hang
+		backend.mu.Unlock()
+		defer close(hang)
+
+		for i := 0; i < 3; i++ {
+			key, err := jwks.Key(context.Background(), "a", "HS256")
+			require.NoError(t, err)
+			assert.Equal(t, []byte("a"), key)
+		}
+		// an unknown key waits for the reload in flight, as long as its context allows
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err := jwks.Key(ctx, "b", "HS256")
+		assert.ErrorIs(t, err, middleware.ErrKeysUnavailable)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
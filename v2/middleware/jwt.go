@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/masonhubco/rebar/v2"
+)
+
+// JWTOptions configures the JWT middleware
+type JWTOptions struct {
+	// Keys is required, JWTAuthenticator panics without it. It resolves the key
+	// verifying each token: StaticKey for a single key, or a JWKS for keys that
+	// rotate.
+	Keys KeyResolver
+	// Algorithms defaults to HS256, RS256 and ES256. Tokens signed with any other
+	// algorithm are rejected.
+	Algorithms []string
+	// Audience must be one of the audiences of the token, when it's set
+	Audience string
+	// Issuer must be the issuer of the token, when it's set
+	Issuer string
+	// ClockSkew is the leeway given when checking the exp, nbf and iat claims, to
+	// account for clock differences with the token issuer.
+	ClockSkew time.Duration
+}
+
+func (o JWTOptions) valuesOrDefaults() JWTOptions {
+	if len(o.Algorithms) == 0 {
+		o.Algorithms = []string{"HS256", "RS256", "ES256"}
+	}
+	return o
+}
+
+// JWT returns a middleware that verifies the bearer token of requests, see
+// JWTAuthenticator.
+func JWT(opts JWTOptions) gin.HandlerFunc {
+	return Authenticate(JWTAuthenticator(opts))
+}
+
+// JWTAuthenticator authenticates requests by their bearer token, a JWT that must be
+// signed by a key of opts.Keys, must not be expired and must match the audience
+// and issuer when they're set. The verified claims are available to handlers with
+// rebar.ClaimsFrom. The subject of the principal is the subject of the token, its
+// scopes are the ones of the scope or scp claim, and its attributes are the claims.
+// It panics when opts.Keys is not set, as no token could ever be verified.
+func JWTAuthenticator(opts JWTOptions) Authenticator {
+	if opts.Keys == nil {
+		panic("[rebar] JWTOptions.Keys is required to verify tokens")
+	}
+	opts = opts.valuesOrDefaults()
+	parserOptions := []jwt.ParserOption{
+		jwt.WithValidMethods(opts.Algorithms),
+		jwt.WithLeeway(opts.ClockSkew),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+	}
+	if opts.Audience != "" {
+		parserOptions = append(parserOptions, jwt.WithAudience(opts.Audience))
+	}
+	if opts.Issuer != "" {
+		parserOptions = append(parserOptions, jwt.WithIssuer(opts.Issuer))
+	}
+	return jwtAuthenticator{keys: opts.Keys, parser: jwt.NewParser(parserOptions...)}
+}
+
+type jwtAuthenticator struct {
+	keys   KeyResolver
+	parser *jwt.Parser
+}
+
+func (a jwtAuthenticator) Authenticate(c *gin.Context) (*rebar.Principal, error) {
+	tokenString, ok := rebar.BearerToken(c)
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	mapClaims := jwt.MapClaims{}
+	_, err := a.parser.ParseWithClaims(tokenString, mapClaims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return a.keys.Key(c.Request.Context(), kid, token.Method.Alg())
+	})
+	if errors.Is(err, ErrKeysUnavailable) {
+		// the token may well be valid, it can't be verified
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidCredentials, err)
+	}
+
+	claims := newClaims(mapClaims)
+	c.Set(rebar.ClaimsKey, claims)
+	return &rebar.Principal{
+		Subject:    claims.Subject,
+		Type:       rebar.PrincipalJWT,
+		Scopes:     scopes(mapClaims),
+		Attributes: claims.Raw,
+	}, nil
+}
+
+func (jwtAuthenticator) Challenge() string {
+	return "Bearer"
+}
+
+// scopes returns the scopes of the scope claim, space separated as in OAuth 2.0, or
+// of the scp claim, a list of scopes
+func scopes(mapClaims jwt.MapClaims) []string {
+	if scope, ok := mapClaims["scope"].(string); ok {
+		return strings.Fields(scope)
+	}
+	list, _ := mapClaims["scp"].([]interface{})
+	var scopes []string
+	for _, scope := range list {
+		if s, ok := scope.(string); ok {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+func newClaims(mapClaims jwt.MapClaims) *rebar.Claims {
+	// the registered claims were validated by the parser already
+	claims := &rebar.Claims{Raw: mapClaims}
+	claims.Issuer, _ = mapClaims.GetIssuer()
+	claims.Subject, _ = mapClaims.GetSubject()
+	claims.Audience, _ = mapClaims.GetAudience()
+	claims.ID, _ = mapClaims["jti"].(string)
+	claims.ExpiresAt = numericTime(mapClaims.GetExpirationTime())
+	claims.NotBefore = numericTime(mapClaims.GetNotBefore())
+	claims.IssuedAt = numericTime(mapClaims.GetIssuedAt())
+	return claims
+}
+
+func numericTime(date *jwt.NumericDate, err error) *time.Time {
+	if err != nil || date == nil {
+		return nil
+	}
+	return &date.Time
+}
@@ -0,0 +1,227 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/masonhubco/rebar/v2"
+	"github.com/masonhubco/rebar/v2/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_JWT(t *testing.T) {
+	t.Parallel()
+
+	keys := newTestKeys(t)
+	otherKeys := newTestKeys(t)
+	router := gin.New()
+	router.Use(middleware.JWT(middleware.JWTOptions{
+		Keys:      middleware.NewFileJWKS(writeJWKS(t, keys.jwks(t)), middleware.JWKSOptions{}),
+		Audience:  "orders",
+		Issuer:    "https://auth.example.com",
+		ClockSkew: time.Minute,
+	}))
+	router.GET("/", func(c *gin.Context) {
+		c.JSON(http.StatusOK, rebar.ClaimsMustFrom(c))
+	})
+
+	now := time.Now()
+	validClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   "https://auth.example.com",
+			"sub":   "user-1",
+			"aud":   []string{"billing", "orders"},
+			"jti":   "token-1",
+			"exp":   now.Add(time.Hour).Unix(),
+			"nbf":   now.Add(-time.Minute).Unix(),
+			"iat":   now.Add(-time.Minute).Unix(),
+			"email": "jane@example.com",
+		}
+	}
+	sign := func(method jwt.SigningMethod, kid string, key interface{}, change func(jwt.MapClaims)) string {
+		claims := validClaims()
+		if change != nil {
+			change(claims)
+		}
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		require.NoError(t, err)
+		return signed
+	}
+
+	tests := []struct {
+		name       string
+		givenToken string
+		wantCode   int
+	}{
+		{name: "HS256", givenToken: sign(jwt.SigningMethodHS256, "hs", keys.hmac, nil), wantCode: http.StatusOK},
+		{name: "RS256", givenToken: sign(jwt.SigningMethodRS256, "rs", keys.rsa, nil), wantCode: http.StatusOK},
+		{name: "ES256", givenToken: sign(jwt.SigningMethodES256, "es", keys.ecdsa, nil), wantCode: http.StatusOK},
+		{name: "expired within the clock skew", wantCode: http.StatusOK,
+			givenToken: sign(jwt.SigningMethodHS256, "hs", keys.hmac, func(c jwt.MapClaims) { c["exp"] = now.Add(-30 * time.Second).Unix() })},
+		{name: "expired", wantCode: http.StatusUnauthorized,
+			givenToken: sign(jwt.SigningMethodHS256, "hs", keys.hmac, func(c jwt.MapClaims) { c["exp"] = now.Add(-2 * time.Minute).Unix() })},
+		{name: "without expiration", wantCode: http.StatusUnauthorized,
+			givenToken: sign(jwt.SigningMethodHS256, "hs", keys.hmac, func(c jwt.MapClaims) { delete(c, "exp") })},
+		{name: "not valid yet", wantCode: http.StatusUnauthorized,
+			givenToken: sign(jwt.SigningMethodHS256, "hs", keys.hmac, func(c jwt.MapClaims) { c["nbf"] = now.Add(2 * time.Minute).Unix() })},
+		{name: "issued in the future", wantCode: http.StatusUnauthorized,
+			givenToken: sign(jwt.SigningMethodHS256, "hs", keys.hmac, func(c jwt.MapClaims) { c["iat"] = now.Add(2 * time.Minute).Unix() })},
+		{name: "other audience", wantCode: http.StatusUnauthorized,
+			givenToken: sign(jwt.SigningMethodHS256, "hs", keys.hmac, func(c jwt.MapClaims) { c["aud"] = "billing" })},
+		{name: "other issuer", wantCode: http.StatusUnauthorized,
+			givenToken: sign(jwt.SigningMethodHS256, "hs", keys.hmac, func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" })},
+		{name: "signed by another key", givenToken: sign(jwt.SigningMethodRS256, "rs", otherKeys.rsa, nil), wantCode: http.StatusUnauthorized},
+		{name: "unknown key ID", givenToken: sign(jwt.SigningMethodHS256, "other", keys.hmac, nil), wantCode: http.StatusUnauthorized},
+		{name: "algorithm not allowed", givenToken: sign(jwt.SigningMethodHS512, "hs", keys.hmac, nil), wantCode: http.StatusUnauthorized},
+		{name: "unsigned", givenToken: sign(jwt.SigningMethodNone, "hs", jwt.UnsafeAllowNoneSignatureType, nil), wantCode: http.StatusUnauthorized},
+		{name: "malformed", givenToken: "not.a.token", wantCode: http.StatusUnauthorized},
+		{name: "no token", givenToken: "", wantCode: http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.givenToken != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.givenToken)
+			}
+			router.ServeHTTP(rr, req)
+			require.Equal(t, tc.wantCode, rr.Code)
+			if tc.wantCode != http.StatusOK {
+				assert.JSONEq(t, `{"status":"unauthorized"}`, rr.Body.String())
+				return
+			}
+
+			var claims rebar.Claims
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &claims))
+			assert.Equal(t, "https://auth.example.com", claims.Issuer)
+			assert.Equal(t, "user-1", claims.Subject)
+			assert.Equal(t, []string{"billing", "orders"}, claims.Audience)
+			assert.Equal(t, "token-1", claims.ID)
+			assert.NotNil(t, claims.ExpiresAt)
+			require.NotNil(t, claims.NotBefore)
+			assert.Equal(t, now.Add(-time.Minute).Unix(), claims.NotBefore.Unix())
+			assert.NotNil(t, claims.IssuedAt)
+			assert.Equal(t, "jane@example.com", claims.Raw["email"])
+		})
+	}
+}
+
+func Test_JWT_StaticKey(t *testing.T) {
+	t.Parallel()
+
+	router := gin.New()
+	router.Use(middleware.JWT(middleware.JWTOptions{Keys: middleware.StaticKey([]byte("secret"))}))
+	router.GET("/", func(c *gin.Context) {
+		claims, _ := rebar.ClaimsFrom(c)
+		c.String(http.StatusOK, claims.Subject)
+	})
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "service-1",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte("secret"))
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "service-1", rr.Body.String())
+}
+
+func Test_JWT_KeysRequired(t *testing.T) {
+	t.Parallel()
+
+	assert.PanicsWithValue(t, "[rebar] JWTOptions.Keys is required to verify tokens", func() {
+		middleware.JWT(middleware.JWTOptions{Issuer: "issuer"})
+	})
+}
+
+func Test_JWTAuthenticator_Scopes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		givenClaim jwt.MapClaims
+		wantScopes []string
+	}{
+		{name: "scope claim", givenClaim: jwt.MapClaims{"scope": "orders:read orders:write"}, wantScopes: []string{"orders:read", "orders:write"}},
+		{name: "scp claim", givenClaim: jwt.MapClaims{"scp": []string{"orders:read"}}, wantScopes: []string{"orders:read"}},
+		{name: "no scopes", givenClaim: jwt.MapClaims{}, wantScopes: nil},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			router := gin.New()
+			router.Use(middleware.Authenticate(middleware.JWTAuthenticator(middleware.JWTOptions{
+				Keys: middleware.StaticKey([]byte("secret")),
+			})))
+			router.GET("/", func(c *gin.Context) {
+				principal, _ := rebar.PrincipalFrom(c)
+				assert.Equal(t, "user-1", principal.Subject)
+				assert.Equal(t, rebar.PrincipalJWT, principal.Type)
+				assert.Equal(t, tc.wantScopes, principal.Scopes)
+				assert.Equal(t, "user-1", principal.Attributes["sub"])
+				c.Status(http.StatusOK)
+			})
+
+			claims := jwt.MapClaims{"sub": "user-1", "exp": time.Now().Add(time.Minute).Unix()}
+			for name, value := range tc.givenClaim {
+				claims[name] = value
+			}
+			token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+			require.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusOK, rr.Code)
+		})
+	}
+}
+
+func Test_JWT_KeysUnavailable(t *testing.T) {
+	t.Parallel()
+
+	router := gin.New()
+	router.Use(middleware.JWT(middleware.JWTOptions{
+		Keys: middleware.NewFileJWKS(filepath.Join(t.TempDir(), "missing.json"), middleware.JWKSOptions{}),
+	}))
+	router.GET("/", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "user-1",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte("secret"))
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(rr, req)
+	// the token can't be verified, which is not the fault of the caller
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.JSONEq(t, `{"request_id":"","error":"unable to authenticate the request"}`, rr.Body.String())
+}
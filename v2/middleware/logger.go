@@ -85,6 +85,7 @@ func LoggerWithConfig(logger rebar.Logger, conf LoggerConfig) gin.HandlerFunc {
 				zap.String("method", c.Request.Method),
 				zap.String("path", path),
 			}
+			fields = append(fields, rebar.LogFieldsFrom(c)...)
 
 			if len(c.Errors) > 0 {
 				fields = append(fields,
@@ -8,8 +8,14 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang/mock/gomock"
+	"github.com/masonhubco/rebar/v2"
 	"github.com/masonhubco/rebar/v2/middleware"
 	"github.com/masonhubco/rebar/v2/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func Test_Logger(t *testing.T) {
@@ -142,3 +148,20 @@ func Test_LoggerWithConfig(t *testing.T) {
 		})
 	}
 }
+
+func Test_Logger_AddedFields(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	router := gin.New()
+	router.Use(middleware.Logger(zap.New(core)))
+	router.GET("/ok", func(c *gin.Context) {
+		rebar.AddLogFields(c, zap.String("caller", "orders"))
+		c.String(http.StatusOK, "200 OK")
+	})
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/ok", nil))
+
+	entries := logs.FilterMessage("[rebar] /ok").All()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "orders", entries[0].ContextMap()["caller"])
+}
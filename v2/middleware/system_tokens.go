@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/masonhubco/rebar/v2"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+)
+
+// SystemToken is a shared token a caller authenticates with
+type SystemToken struct {
+	// Name identifies the caller in logs
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"`
+	// ExpiresAt is optional. Once it's passed, the token is rejected, so that an old
+	// and a new token can both be accepted while callers switch to the new one.
+	ExpiresAt time.Time `yaml:"expires_at"`
+}
+
+func (t SystemToken) expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt)
+}
+
+// TokenProvider returns the tokens accepted by SystemTokens. It's called for every
+// request, so it must be cheap.
+type TokenProvider interface {
+	Tokens() []SystemToken
+}
+
+// TokenSet is a TokenProvider whose tokens can be replaced at runtime
+type TokenSet struct {
+	mu     sync.RWMutex
+	tokens []SystemToken
+}
+
+// NewTokenSet creates a set of tokens
+func NewTokenSet(tokens ...SystemToken) *TokenSet {
+	return &TokenSet{tokens: tokens}
+}
+
+// Tokens implements TokenProvider
+func (s *TokenSet) Tokens() []SystemToken {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tokens
+}
+
+// Set replaces the tokens of the set
+func (s *TokenSet) Set(tokens ...SystemToken) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = tokens
+}
+
+// LoadFile replaces the tokens of the set with the ones listed in a YAML or JSON
+// file, each with a name, a token and an optional expires_at time. The tokens are
+// kept when the file can't be loaded.
+func (s *TokenSet) LoadFile(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("system tokens: %w", err)
+	}
+	var tokens []SystemToken
+	if err := yaml.Unmarshal(raw, &tokens); err != nil {
+		return fmt.Errorf("system tokens: invalid file %s: %w", path, err)
+	}
+	for i, token := range tokens {
+		if token.Name == "" || token.Token == "" {
+			return fmt.Errorf("system tokens: token %d of %s needs a name and a token", i, path)
+		}
+	}
+	s.Set(tokens...)
+	return nil
+}
+
+// SystemTokens returns a middleware that authenticates callers by the bearer token
+// of their requests, see SystemTokenAuthenticator.
+func SystemTokens(provider TokenProvider) gin.HandlerFunc {
+	return Authenticate(SystemTokenAuthenticator(provider))
+}
+
+// SystemTokenAuthenticator authenticates callers by the bearer token of their
+// requests. The token is compared in constant time with every token of provider,
+// expired tokens are rejected, and the name of the matching token is the subject
+// of the principal. It's added to the request logs as the caller field.
+func SystemTokenAuthenticator(provider TokenProvider) Authenticator {
+	return systemTokenAuthenticator{provider: provider}
+}
+
+type systemTokenAuthenticator struct {
+	provider TokenProvider
+}
+
+func (a systemTokenAuthenticator) Authenticate(c *gin.Context) (*rebar.Principal, error) {
+	given, ok := rebar.BearerToken(c)
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	token, ok := matchToken(a.provider.Tokens(), given)
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown system token", ErrInvalidCredentials)
+	}
+	if token.expired(time.Now()) {
+		return nil, fmt.Errorf("%w: system token of %s expired at %s", ErrInvalidCredentials,
+			token.Name, token.ExpiresAt.Format(time.RFC3339))
+	}
+	rebar.AddLogFields(c, zap.String("caller", token.Name))
+	return &rebar.Principal{Subject: token.Name, Type: rebar.PrincipalSystemToken}, nil
+}
+
+func (systemTokenAuthenticator) Challenge() string {
+	return "Bearer"
+}
+
+// matchToken compares the digests of the tokens, so that neither their content
+// nor their length leaks through timing. Every token is compared, preferring one
+// that's not expired when several match.
+func matchToken(tokens []SystemToken, given string) (SystemToken, bool) {
+	now := time.Now()
+	digest := sha256.Sum256([]byte(given))
+	var match SystemToken
+	var found bool
+	for _, token := range tokens {
+		candidate := sha256.Sum256([]byte(token.Token))
+		if subtle.ConstantTimeCompare(digest[:], candidate[:]) == 1 && (!found || match.expired(now)) {
+			match, found = token, true
+		}
+	}
+	return match, found
+}
@@ -0,0 +1,178 @@
+package middleware_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/masonhubco/rebar/v2"
+	"github.com/masonhubco/rebar/v2/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func Test_SystemTokens(t *testing.T) {
+	t.Parallel()
+
+	tokens := middleware.NewTokenSet(
+		middleware.SystemToken{Name: "orders", Token: "old-token", ExpiresAt: time.Now().Add(time.Hour)},
+		middleware.SystemToken{Name: "orders", Token: "new-token"},
+		middleware.SystemToken{Name: "billing", Token: "expired-token", ExpiresAt: time.Now().Add(-time.Minute)},
+	)
+
+	tests := []struct {
+		name       string
+		givenAuth  string
+		wantCode   int
+		wantCaller string
+		wantLog    string
+	}{
+		{name: "current token", givenAuth: "Bearer new-token", wantCode: http.StatusOK, wantCaller: "orders"},
+		{name: "token being rotated", givenAuth: "Bearer old-token", wantCode: http.StatusOK, wantCaller: "orders"},
+		{name: "lower case scheme", givenAuth: "bearer new-token", wantCode: http.StatusOK, wantCaller: "orders"},
+		{name: "expired token", givenAuth: "Bearer expired-token", wantCode: http.StatusUnauthorized, wantLog: "credentials not valid"},
+		{name: "unknown token", givenAuth: "Bearer new-token2", wantCode: http.StatusUnauthorized, wantLog: "credentials not valid"},
+		{name: "other scheme", givenAuth: "Basic new-token", wantCode: http.StatusUnauthorized, wantLog: "no credentials in request"},
+		{name: "empty token", givenAuth: "Bearer ", wantCode: http.StatusUnauthorized, wantLog: "no credentials in request"},
+		{name: "no token", givenAuth: "", wantCode: http.StatusUnauthorized, wantLog: "no credentials in request"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			core, logs := observer.New(zapcore.DebugLevel)
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				c.Set(rebar.LoggerKey, zap.New(core))
+			})
+			router.Use(middleware.SystemTokens(tokens))
+			router.GET("/", func(c *gin.Context) {
+				rebar.LoggerFrom(c).Info("handled")
+				c.String(http.StatusOK, "200 OK")
+			})
+
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.givenAuth != "" {
+				req.Header.Set("Authorization", tc.givenAuth)
+			}
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.wantCode, rr.Code)
+			require.Equal(t, 1, logs.Len())
+			entry := logs.All()[0]
+			if tc.wantCode == http.StatusOK {
+				assert.Equal(t, "handled", entry.Message)
+				assert.Equal(t, tc.wantCaller, entry.ContextMap()["caller"])
+				assert.Equal(t, tc.wantCaller, entry.ContextMap()["principal"])
+				assert.Equal(t, rebar.PrincipalSystemToken, entry.ContextMap()["principal_type"])
+				return
+			}
+			assert.JSONEq(t, `{"status":"unauthorized"}`, rr.Body.String())
+			assert.Equal(t, "Bearer", rr.Header().Get("WWW-Authenticate"))
+			assert.Equal(t, tc.wantLog, entry.Message)
+		})
+	}
+}
+
+func Test_TokenSet_Set(t *testing.T) {
+	t.Parallel()
+
+	tokens := middleware.NewTokenSet(middleware.SystemToken{Name: "orders", Token: "old-token"})
+	router := gin.New()
+	router.Use(middleware.SystemTokens(tokens))
+	router.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, "200 OK")
+	})
+	get := func(token string) int {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusOK, get("old-token"))
+	assert.Equal(t, http.StatusUnauthorized, get("new-token"))
+
+	tokens.Set(middleware.SystemToken{Name: "orders", Token: "new-token"})
+	assert.Equal(t, http.StatusUnauthorized, get("old-token"))
+	assert.Equal(t, http.StatusOK, get("new-token"))
+}
+
+func Test_TokenSet_LoadFile(t *testing.T) {
+	t.Parallel()
+
+	initial := middleware.SystemToken{Name: "initial", Token: "initial-token"}
+
+	tests := []struct {
+		name       string
+		givenFile  string
+		wantTokens []middleware.SystemToken
+		wantErr    string
+	}{
+		{
+			name: "yaml",
+			givenFile: "- name: orders\n  token: orders-token\n  expires_at: 2021-10-01T00:00:00Z\n" +
+				"- name: billing\n  token: billing-token\n",
+			wantTokens: []middleware.SystemToken{
+				{Name: "orders", Token: "orders-token", ExpiresAt: time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)},
+				{Name: "billing", Token: "billing-token"},
+			},
+		},
+		{
+			name:       "json",
+			givenFile:  `[{"name":"orders","token":"orders-token"}]`,
+			wantTokens: []middleware.SystemToken{{Name: "orders", Token: "orders-token"}},
+		},
+		{
+			name:       "token without name",
+			givenFile:  "- token: orders-token\n",
+			wantTokens: []middleware.SystemToken{initial},
+			wantErr:    "system tokens: token 0 of %s needs a name and a token",
+		},
+		{
+			name:       "not a list",
+			givenFile:  "orders: orders-token\n",
+			wantTokens: []middleware.SystemToken{initial},
+			wantErr:    "system tokens: invalid file %s: yaml: unmarshal errors:\n  line 1: cannot unmarshal !!map into []middleware.SystemToken",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "tokens.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(tc.givenFile), 0o600))
+			tokens := middleware.NewTokenSet(initial)
+
+			err := tokens.LoadFile(path)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, fmt.Sprintf(tc.wantErr, path))
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.wantTokens, tokens.Tokens())
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		t.Parallel()
+
+		tokens := middleware.NewTokenSet(initial)
+		assert.ErrorIs(t, tokens.LoadFile(filepath.Join(t.TempDir(), "missing.yaml")), os.ErrNotExist)
+		assert.Equal(t, []middleware.SystemToken{initial}, tokens.Tokens())
+	})
+}
@@ -1,10 +1,14 @@
 package rebar
 
 import (
+	"fmt"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
 // Options is the set of custom options you'd like to use
@@ -12,14 +16,42 @@ import (
 type Options struct {
 	// Environment defaults to development. Possible value could be development,
 	// test, staging, integration, sandbox and production. When it's set to
-	// development, it activates Gin's debug mode, test triggers test mode, and
-	// everything else maps to release mode
+	// development, the app runs in Gin's debug mode, test in test mode, and
+	// everything else maps to release mode. That mode is kept on the app, see
+	// Rebar.Mode: Gin's global mode is never changed, it's left to GIN_MODE and
+	// gin.SetMode.
 	Environment string
 	// Port defaults to 3000. It's the port rebar http server will listen to.
 	Port string
+	// Listeners is optional. When it's set, it replaces Port with the listeners
+	// to serve on, all at the same time. See Listen for the supported specs: TCP
+	// host:port, unix sockets, systemd socket activation and inherited file
+	// descriptors.
+	Listeners []string
+	// AdminPort is optional. When it's set, rebar starts a second http server on
+	// that port for operational routes only: health endpoints, and with AdminToken
+	// the runtime metrics expvar publishes on /debug/vars and pprof on /debug/pprof.
+	// They're served by Rebar.Admin, which doesn't share any middleware with
+	// Rebar.Router.
+	AdminPort string
+	// TLS is optional. When it's set, the server only accepts TLS connections and
+	// reloads its certificate from disk when the files change or on SIGHUP.
+	TLS *TLSOptions
 	// Logger is used throughout rebar for writing logs. It accepts an instance
 	// of zap logger.
 	Logger Logger
+	// LogLevel is the level of Logger, which can be changed while the app runs on
+	// the admin endpoint and with SIGUSR1. It defaults to info when Logger is not
+	// set. When Logger is set, give the atomic level it was built with to control
+	// it, otherwise the level can't be changed. It's not loaded by the config package.
+	LogLevel *zap.AtomicLevel `config:"-"`
+	// AdminToken is optional. When it's set, the log level can be read and changed
+	// on /debug/loglevel of the admin listener with this bearer token, which the
+	// metrics and pprof also need.
+	AdminToken string
+	// OnEvent is optional. It's called with every lifecycle event rebar logs:
+	// phase changes, processors starting, stopping and exiting, signals received...
+	OnEvent EventHook
 	// WriteTimeout defaults to 15 seconds. It maps to http.Server's WriteTimeout.
 	WriteTimeout time.Duration
 	// ReadTimeout defaults to 15 seconds. It maps to http.Server's ReadTimeout.
@@ -29,20 +61,53 @@ type Options struct {
 	// ShutDownWait defaults to 30 seconds. It tells the server how long it has
 	// to gracefully shutdown
 	ShutDownWait time.Duration
+	// DrainDelay defaults to 0, no drain. When it's set, rebar keeps serving requests
+	// for that long after receiving the shutdown signal, while reporting itself as
+	// not ready, before stopping processors and shutting down the server. It gives
+	// load balancers time to notice and stop routing requests to the instance. A
+	// second SIGINT or SIGTERM cuts it short.
+	DrainDelay time.Duration
+	// ProcessorShutdownBudget defaults to ShutDownWait. It's the total time all
+	// attached processors share to stop. Processors that miss their deadline are
+	// reported by name and abandoned so that the server can still shut down.
+	ProcessorShutdownBudget time.Duration
+	// GracefulUpgrade enables zero-downtime binary upgrades. When the process
+	// receives SIGUSR2, it starts its executable again, handing its listening
+	// sockets over to the new process. Once the new process is running, the
+	// current one shuts down gracefully. Not supported on Windows.
+	GracefulUpgrade bool
+	// UpgradeTimeout defaults to 1 minute. It's how long the new process has to
+	// be running, before it's killed and the upgrade abandoned.
+	UpgradeTimeout time.Duration
 	// StopOnProcessorStartFailure will prevent the server from starting if any attached processors fail to start
 	StopOnProcessorStartFailure bool
+	// Health configures the liveness, readiness, startup and version endpoints. They're
+	// registered on /healthz, /readyz, /startupz and /version of the admin listener, if
+	// any. OnRouter registers the health endpoints, but not /version, on Router.
+	Health HealthOptions
 }
 
 func (o Options) ValuesOrDefaults() Options {
+	o = o.nonLoggerDefaults()
+	if o.Logger == nil {
+		if o.LogLevel == nil {
+			level := zap.NewAtomicLevelAt(zap.InfoLevel)
+			o.LogLevel = &level
+		}
+		o.Logger, _ = NewStandardLoggerAt(*o.LogLevel)
+	}
+	return o
+}
+
+// nonLoggerDefaults applies the defaults of every option but Logger and LogLevel,
+// which would need a logger to be built
+func (o Options) nonLoggerDefaults() Options {
 	if o.Environment == "" {
 		o.Environment = "development"
 	}
 	if o.Port == "" {
 		o.Port = "3000"
 	}
-	if o.Logger == nil {
-		o.Logger, _ = NewStandardLogger()
-	}
 	if o.WriteTimeout == 0 {
 		o.WriteTimeout = 15 * time.Second
 	}
@@ -55,6 +120,13 @@ func (o Options) ValuesOrDefaults() Options {
 	if o.ShutDownWait == 0 {
 		o.ShutDownWait = 30 * time.Second
 	}
+	if o.UpgradeTimeout == 0 {
+		o.UpgradeTimeout = time.Minute
+	}
+	if o.ProcessorShutdownBudget == 0 {
+		o.ProcessorShutdownBudget = o.ShutDownWait
+	}
+	o.Health = o.Health.valuesOrDefaults()
 	return o
 }
 
@@ -76,5 +148,106 @@ func (o Options) Mode() string {
 	case Staging, Integration, Sandbox, Production:
 		return gin.ReleaseMode
 	}
+	if mode, ok := customEnvironment(o.Environment); ok {
+		return mode
+	}
 	return gin.ReleaseMode
 }
+
+var customEnvironments = struct {
+	sync.RWMutex
+	modes map[string]string
+}{modes: map[string]string{}}
+
+// RegisterEnvironment makes name a valid Environment, running gin in mode:
+// gin.DebugMode, gin.TestMode or gin.ReleaseMode.
+func RegisterEnvironment(name, mode string) {
+	customEnvironments.Lock()
+	defer customEnvironments.Unlock()
+	customEnvironments.modes[strings.ToLower(name)] = mode
+}
+
+func customEnvironment(name string) (string, bool) {
+	customEnvironments.RLock()
+	defer customEnvironments.RUnlock()
+	mode, ok := customEnvironments.modes[strings.ToLower(name)]
+	return mode, ok
+}
+
+// OptionsError lists every invalid option
+type OptionsError struct {
+	Errs []error
+}
+
+func (e *OptionsError) Error() string {
+	var buffer strings.Builder
+	buffer.WriteString("[rebar] invalid options:")
+	for _, err := range e.Errs {
+		fmt.Fprintf(&buffer, "\n  - %s", err)
+	}
+	return buffer.String()
+}
+
+// Validate checks the options, once defaults other than Logger are applied, and returns an
+// *OptionsError listing every invalid one:
+//   - Environment must be a known environment, or registered with RegisterEnvironment
+//   - Port and AdminPort must be valid port numbers, and different. Port can be 0 with
+//     Listeners, AdminPort never is
+//   - timeouts, delays and budgets can't be negative
+//   - ShutDownWait can't be shorter than ProcessorShutdownBudget
+func (o Options) Validate() error {
+	o = o.nonLoggerDefaults()
+	var errs []error
+
+	switch strings.ToLower(o.Environment) {
+	case Development, Test, Staging, Sandbox, Integration, Production:
+	default:
+		if _, ok := customEnvironment(o.Environment); !ok {
+			errs = append(errs, fmt.Errorf("unknown Environment %q, register it with RegisterEnvironment", o.Environment))
+		}
+	}
+
+	// 0 binds a random port, which only makes sense for Port when Listeners tell where
+	// to serve. They don't apply to AdminPort, so it's never 0.
+	if !validPort(o.Port, len(o.Listeners) > 0) {
+		errs = append(errs, fmt.Errorf("invalid Port %q", o.Port))
+	}
+	if o.AdminPort != "" {
+		if !validPort(o.AdminPort, false) {
+			errs = append(errs, fmt.Errorf("invalid AdminPort %q", o.AdminPort))
+		} else if o.AdminPort == o.Port && len(o.Listeners) == 0 {
+			errs = append(errs, fmt.Errorf("the AdminPort %s is already the server Port", o.AdminPort))
+		}
+	}
+
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"WriteTimeout", o.WriteTimeout},
+		{"ReadTimeout", o.ReadTimeout},
+		{"IdleTimeout", o.IdleTimeout},
+		{"ShutDownWait", o.ShutDownWait},
+		{"DrainDelay", o.DrainDelay},
+		{"ProcessorShutdownBudget", o.ProcessorShutdownBudget},
+		{"UpgradeTimeout", o.UpgradeTimeout},
+	} {
+		if d.value < 0 {
+			errs = append(errs, fmt.Errorf("negative %s %s", d.name, d.value))
+		}
+	}
+	if o.ShutDownWait < o.ProcessorShutdownBudget {
+		errs = append(errs, fmt.Errorf("the ShutDownWait of %s is shorter than the ProcessorShutdownBudget of %s",
+			o.ShutDownWait, o.ProcessorShutdownBudget))
+	}
+
+	if len(errs) > 0 {
+		return &OptionsError{Errs: errs}
+	}
+	return nil
+}
+
+func validPort(port string, allowZero bool) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && (n > 0 || (n == 0 && allowZero)) && n <= 65535
+}
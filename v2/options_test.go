@@ -1,11 +1,14 @@
 package rebar_test
 
 import (
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/masonhubco/rebar/v2"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_Options_Mode(t *testing.T) {
@@ -31,3 +34,99 @@ func Test_Options_Mode(t *testing.T) {
 		})
 	}
 }
+
+func Test_Options_Validate(t *testing.T) {
+	t.Parallel()
+	rebar.RegisterEnvironment("Preview", gin.ReleaseMode)
+
+	tests := []struct {
+		name    string
+		given   rebar.Options
+		wantErr string
+	}{
+		{name: "defaults", given: rebar.Options{}},
+		{name: "custom environment", given: rebar.Options{Environment: "preview"}},
+		{
+			name: "valid",
+			given: rebar.Options{
+				Environment:             "Production",
+				Port:                    "8080",
+				AdminPort:               "9090",
+				ShutDownWait:            time.Minute,
+				ProcessorShutdownBudget: 45 * time.Second,
+			},
+		},
+		{
+			name:    "unknown environment",
+			given:   rebar.Options{Environment: "prod"},
+			wantErr: `unknown Environment "prod", register it with RegisterEnvironment`,
+		},
+		{
+			name:    "bad ports",
+			given:   rebar.Options{Port: "http", AdminPort: "70000"},
+			wantErr: "invalid Port \"http\"\n  - invalid AdminPort \"70000\"",
+		},
+		{
+			name:    "random ports",
+			given:   rebar.Options{Port: "0", AdminPort: "0"},
+			wantErr: "invalid Port \"0\"\n  - invalid AdminPort \"0\"",
+		},
+		{
+			name:    "random port with listeners",
+			given:   rebar.Options{Port: "0", Listeners: []string{":8080"}},
+			wantErr: "",
+		},
+		{
+			name:    "random admin port with listeners",
+			given:   rebar.Options{AdminPort: "0", Listeners: []string{":8080"}},
+			wantErr: "invalid AdminPort \"0\"",
+		},
+		{
+			name:    "same ports",
+			given:   rebar.Options{Port: "3000", AdminPort: "3000"},
+			wantErr: "the AdminPort 3000 is already the server Port",
+		},
+		{
+			name:    "same ports with listeners",
+			given:   rebar.Options{Port: "3000", AdminPort: "3000", Listeners: []string{":8080"}},
+			wantErr: "",
+		},
+		{
+			name: "negative durations",
+			given: rebar.Options{
+				ReadTimeout:  -time.Second,
+				DrainDelay:   -time.Second,
+				ShutDownWait: 10 * time.Second,
+			},
+			wantErr: "negative ReadTimeout -1s\n  - negative DrainDelay -1s",
+		},
+		{
+			name:    "processor budget over shutdown wait",
+			given:   rebar.Options{ShutDownWait: 10 * time.Second, ProcessorShutdownBudget: 20 * time.Second},
+			wantErr: "the ShutDownWait of 10s is shorter than the ProcessorShutdownBudget of 20s",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tc.given.Validate()
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var invalid *rebar.OptionsError
+			require.True(t, errors.As(err, &invalid))
+			assert.EqualError(t, err, "[rebar] invalid options:\n  - "+tc.wantErr)
+		})
+	}
+}
+
+func Test_RegisterEnvironment(t *testing.T) {
+	t.Parallel()
+
+	rebar.RegisterEnvironment("qa", gin.TestMode)
+	assert.Equal(t, gin.TestMode, rebar.Options{Environment: "QA"}.Mode())
+}
@@ -0,0 +1,138 @@
+// Package outbox publishes events only once the transaction writing them commits.
+// Handlers write messages in the transaction of the request, and a Relay added to the
+// app as a processor publishes them afterwards, at least once and in order for each
+// aggregate key.
+//
+//	box := outbox.New(db, outbox.Options{})
+//	relay := outbox.NewRelay(box, publisher, outbox.RelayOptions{})
+//	app.AddLifecycleProcessor(relay, rebar.WithName("outbox"))
+//
+//	// in a handler behind middleware.Transaction
+//	box.WriteFrom(c, "order.created", order.ID, order)
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/masonhubco/rebar/v2"
+)
+
+// ErrNoTransaction is returned when writing a message without a transaction
+var ErrNoTransaction = errors.New("outbox: a transaction is required")
+
+// Message is an event waiting in the outbox to be published
+type Message struct {
+	ID    int64
+	Topic string
+	// Key identifies the aggregate the event is about. Messages sharing a key are
+	// published in the order they were written, messages without key in any order.
+	Key      string
+	Payload  json.RawMessage
+	Attempts int
+	// LastError is the error of the last failed attempt to publish the message
+	LastError string
+	CreatedAt time.Time
+}
+
+// Decode unmarshals the JSON payload of the message into v
+func (m *Message) Decode(v interface{}) error {
+	return json.Unmarshal(m.Payload, v)
+}
+
+// Options configures an Outbox
+type Options struct {
+	// Table defaults to rebar_outbox. It names the table, and its index with a _key_idx
+	// suffix, in the statements of New, so it's set by the app and never by its users.
+	Table string
+}
+
+// Outbox stores messages in a Postgres table until they are published
+type Outbox struct {
+	db      *sqlx.DB
+	table   string
+	queries queries
+}
+
+type queries struct {
+	create, write, next, published, failed string
+}
+
+// New creates an outbox storing messages through db. The table is created by Migrate.
+func New(db *sqlx.DB, opts Options) *Outbox {
+	table := opts.Table
+	if table == "" {
+		table = "rebar_outbox"
+	}
+	return &Outbox{
+		db:    db,
+		table: table,
+		queries: queries{
+			create: fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %[1]s (
+	id bigserial PRIMARY KEY,
+	topic text NOT NULL,
+	key text NOT NULL DEFAULT '',
+	payload jsonb NOT NULL,
+	attempts integer NOT NULL DEFAULT 0,
+	next_attempt_at timestamptz NOT NULL DEFAULT now(),
+	last_error text NOT NULL DEFAULT '',
+	created_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS %[1]s_key_idx ON %[1]s (key, id)`, table),
+			write: fmt.Sprintf(`INSERT INTO %s (topic, key, payload)
+VALUES ($1, $2, $3::jsonb)
+RETURNING id, created_at`, table),
+			// only the oldest message of each key is ready, so that a message waiting
+			// for a retry, or locked by another relay, holds back the next ones
+			next: fmt.Sprintf(`SELECT id, topic, key, payload::text, attempts, last_error, created_at
+FROM %[1]s o
+WHERE next_attempt_at <= now()
+AND (key = '' OR NOT EXISTS (SELECT 1 FROM %[1]s p WHERE p.key = o.key AND p.id < o.id))
+ORDER BY id
+LIMIT $1
+FOR UPDATE SKIP LOCKED`, table),
+			published: fmt.Sprintf(`DELETE FROM %s WHERE id = $1`, table),
+			failed: fmt.Sprintf(`UPDATE %s
+SET attempts = attempts + 1, last_error = $2, next_attempt_at = now() + make_interval(secs => $3)
+WHERE id = $1`, table),
+		},
+	}
+}
+
+// Migrate creates the outbox table and its index when they don't exist
+func (o *Outbox) Migrate(ctx context.Context) error {
+	if _, err := o.db.ExecContext(ctx, o.queries.create); err != nil {
+		return fmt.Errorf("create %s: %w", o.table, err)
+	}
+	return nil
+}
+
+// Write stores a message in tx, with payload marshaled to JSON. It's published once
+// tx commits, and dropped if it rolls back.
+func (o *Outbox) Write(ctx context.Context, tx *sqlx.Tx, topic, key string, payload interface{}) (*Message, error) {
+	if tx == nil {
+		return nil, ErrNoTransaction
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("outbox: marshal the payload of %s: %w", topic, err)
+	}
+	msg := &Message{Topic: topic, Key: key, Payload: data}
+	err = tx.QueryRowxContext(ctx, o.queries.write, topic, key, string(data)).Scan(&msg.ID, &msg.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("outbox: write %s: %w", topic, err)
+	}
+	return msg, nil
+}
+
+// WriteFrom stores a message in the transaction of the request, set by the
+// middleware.Transaction middleware. ErrNoTransaction is returned without it.
+func (o *Outbox) WriteFrom(c *gin.Context, topic, key string, payload interface{}) (*Message, error) {
+	tx, _ := rebar.TxFrom(c)
+	return o.Write(c.Request.Context(), tx, topic, key, payload)
+}
@@ -0,0 +1,96 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/masonhubco/rebar/v2"
+	"github.com/masonhubco/rebar/v2/outbox"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type orderCreated struct {
+	OrderID string `json:"order_id"`
+}
+
+func newOutbox(t *testing.T) (*outbox.Outbox, *sqlx.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, mock.ExpectationsWereMet())
+		db.Close()
+	})
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	return outbox.New(sqlxDB, outbox.Options{Table: "events_outbox"}), sqlxDB, mock
+}
+
+func Test_Outbox_Migrate(t *testing.T) {
+	t.Parallel()
+
+	box, _, mock := newOutbox(t)
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS events_outbox")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	require.NoError(t, box.Migrate(context.Background()))
+
+	mock.ExpectExec("CREATE TABLE").WillReturnError(errors.New("permission denied"))
+	assert.EqualError(t, box.Migrate(context.Background()), "create events_outbox: permission denied")
+}
+
+func Test_Outbox_WriteFrom(t *testing.T) {
+	t.Parallel()
+
+	box, db, mock := newOutbox(t)
+	createdAt := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO events_outbox (topic, key, payload)")).
+		WithArgs("order.created", "order-1", `{"order_id":"order-1"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(3, createdAt))
+	mock.ExpectCommit()
+
+	tx, err := db.Beginx()
+	require.NoError(t, err)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/orders", nil)
+	c.Set(rebar.TxKey, tx)
+
+	msg, err := box.WriteFrom(c, "order.created", "order-1", orderCreated{OrderID: "order-1"})
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+	assert.Equal(t, int64(3), msg.ID)
+	assert.Equal(t, createdAt, msg.CreatedAt)
+	var payload orderCreated
+	require.NoError(t, msg.Decode(&payload))
+	assert.Equal(t, "order-1", payload.OrderID)
+}
+
+func Test_Outbox_Write_Errors(t *testing.T) {
+	t.Parallel()
+
+	box, db, mock := newOutbox(t)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/orders", nil)
+	_, err := box.WriteFrom(c, "order.created", "order-1", nil)
+	assert.ErrorIs(t, err, outbox.ErrNoTransaction)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO events_outbox").WillReturnError(errors.New("relation does not exist"))
+	mock.ExpectRollback()
+	tx, err := db.Beginx()
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	_, err = box.Write(context.Background(), tx, "order.created", "order-1", func() {})
+	assert.EqualError(t, err, "outbox: marshal the payload of order.created: json: unsupported type: func()")
+	_, err = box.Write(context.Background(), tx, "order.created", "order-1", nil)
+	assert.EqualError(t, err, "outbox: write order.created: relation does not exist")
+}
@@ -0,0 +1,61 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+)
+
+// Publisher sends messages to a broker. Messages can be published more than once,
+// when the relay fails to record that they were, so consumers must be idempotent.
+type Publisher interface {
+	Publish(ctx context.Context, msg *Message) error
+}
+
+// PublisherFunc adapts a function to the Publisher interface
+type PublisherFunc func(ctx context.Context, msg *Message) error
+
+// Publish calls f
+func (f PublisherFunc) Publish(ctx context.Context, msg *Message) error {
+	return f(ctx, msg)
+}
+
+// MemoryPublisher keeps the published messages in memory, for tests and local
+// development
+type MemoryPublisher struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewMemoryPublisher creates a publisher without any message
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+// Publish records a copy of msg
+func (p *MemoryPublisher) Publish(ctx context.Context, msg *Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, *msg)
+	return nil
+}
+
+// Messages returns the published messages, in the order they were published. All
+// the messages are returned when topic is empty.
+func (p *MemoryPublisher) Messages(topic string) []Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var messages []Message
+	for _, msg := range p.messages {
+		if topic == "" || msg.Topic == topic {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+// Reset forgets the published messages
+func (p *MemoryPublisher) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = nil
+}
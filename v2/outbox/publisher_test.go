@@ -0,0 +1,32 @@
+package outbox_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/masonhubco/rebar/v2/outbox"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_MemoryPublisher(t *testing.T) {
+	t.Parallel()
+
+	publisher := outbox.NewMemoryPublisher()
+	for _, msg := range []*outbox.Message{
+		{ID: 1, Topic: "order.created", Key: "order-1"},
+		{ID: 2, Topic: "order.shipped", Key: "order-1"},
+		{ID: 3, Topic: "order.created", Key: "order-2"},
+	} {
+		require.NoError(t, publisher.Publish(context.Background(), msg))
+	}
+
+	assert.Len(t, publisher.Messages(""), 3)
+	created := publisher.Messages("order.created")
+	require.Len(t, created, 2)
+	assert.Equal(t, int64(1), created[0].ID)
+	assert.Equal(t, int64(3), created[1].ID)
+
+	publisher.Reset()
+	assert.Empty(t, publisher.Messages(""))
+}
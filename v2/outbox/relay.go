@@ -0,0 +1,197 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/masonhubco/rebar/v2"
+	"go.uber.org/zap"
+)
+
+// RelayOptions configures a Relay
+type RelayOptions struct {
+	// PollInterval is how long the relay waits when no message is ready. It defaults
+	// to 1 second.
+	PollInterval time.Duration
+	// BatchSize is how many messages are published per transaction, and defaults
+	// to 100
+	BatchSize int
+	// Backoff gives the delay before publishing again a message that failed the given
+	// attempt, and defaults to DefaultBackoff
+	Backoff func(attempt int) time.Duration
+	// Logger defaults to the standard logger
+	Logger rebar.Logger
+}
+
+// ValuesOrDefaults returns the options a Relay runs with, polling every second for
+// batches of up to 100 messages when unset
+func (o RelayOptions) ValuesOrDefaults() RelayOptions {
+	if o.PollInterval == 0 {
+		o.PollInterval = time.Second
+	}
+	if o.BatchSize == 0 {
+		o.BatchSize = 100
+	}
+	if o.Backoff == nil {
+		o.Backoff = DefaultBackoff
+	}
+	if o.Logger == nil {
+		o.Logger, _ = rebar.NewStandardLogger()
+	}
+	return o
+}
+
+// DefaultBackoff doubles the delay after each attempt, from 1 second up to 5 minutes
+func DefaultBackoff(attempt int) time.Duration {
+	if attempt > 9 {
+		return 5 * time.Minute
+	}
+	delay := time.Second << uint(attempt-1)
+	if delay > 5*time.Minute {
+		return 5 * time.Minute
+	}
+	return delay
+}
+
+// Relay is a rebar.LifecycleProcessor publishing the messages of an outbox. Messages
+// are removed once published, and retried forever with backoff otherwise.
+type Relay struct {
+	outbox    *Outbox
+	publisher Publisher
+	opts      RelayOptions
+
+	mu      sync.Mutex
+	started bool
+	quit    chan struct{}
+	// cancel cancels the batch in flight, when Stop stops waiting for it
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewRelay creates a relay publishing the messages of outbox with publisher
+func NewRelay(outbox *Outbox, publisher Publisher, opts RelayOptions) *Relay {
+	return &Relay{outbox: outbox, publisher: publisher, opts: opts.ValuesOrDefaults()}
+}
+
+// Start polls the outbox
+func (r *Relay) Start(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.started {
+		return errors.New("outbox: relay already started")
+	}
+	r.started = true
+	r.quit = make(chan struct{})
+	r.done = make(chan struct{})
+	var runCtx context.Context
+	runCtx, r.cancel = context.WithCancel(context.Background())
+	go r.loop(runCtx, r.quit, r.done)
+	return nil
+}
+
+// Stop stops polling and waits for the batch in flight. When ctx is done first, the
+// batch is canceled and rolled back, and ctx's error is returned.
+func (r *Relay) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	if !r.started {
+		r.mu.Unlock()
+		return nil
+	}
+	r.started = false
+	close(r.quit)
+	cancel, done := r.cancel, r.done
+	r.mu.Unlock()
+	defer cancel()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("outbox: batch still in flight: %w", ctx.Err())
+	}
+}
+
+func (r *Relay) loop(ctx context.Context, quit, done chan struct{}) {
+	defer close(done)
+	for {
+		n, err := r.Flush(ctx)
+		if err != nil {
+			r.opts.Logger.Error("failed to relay outbox messages", zap.Error(err))
+		}
+		if n > 0 && err == nil {
+			// there are likely more messages waiting: a batch holds a single message of
+			// each key, so a smaller batch doesn't mean the outbox is empty
+			select {
+			case <-quit:
+				return
+			default:
+				continue
+			}
+		}
+		timer := time.NewTimer(r.opts.PollInterval)
+		select {
+		case <-quit:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Flush publishes one batch of ready messages in a transaction, and returns how many
+// were tried. Failed messages are held back, with the messages sharing their key,
+// until their backoff elapses.
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	tx, err := r.outbox.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	// a no-op once committed
+	defer tx.Rollback()
+
+	rows, err := tx.QueryxContext(ctx, r.outbox.queries.next, r.opts.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	var messages []*Message
+	for rows.Next() {
+		var msg Message
+		var payload string
+		if err := rows.Scan(&msg.ID, &msg.Topic, &msg.Key, &payload, &msg.Attempts, &msg.LastError, &msg.CreatedAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		msg.Payload = []byte(payload)
+		messages = append(messages, &msg)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, msg := range messages {
+		logger := r.opts.Logger.With(
+			zap.Int64("message_id", msg.ID),
+			zap.String("topic", msg.Topic),
+			zap.String("key", msg.Key),
+		)
+		if err := r.publisher.Publish(ctx, msg); err != nil {
+			attempt := msg.Attempts + 1
+			delay := r.opts.Backoff(attempt)
+			if _, err := tx.ExecContext(ctx, r.outbox.queries.failed, msg.ID, err.Error(), delay.Seconds()); err != nil {
+				return 0, err
+			}
+			logger.Warn("failed to publish outbox message", zap.Error(err), zap.Int("attempt", attempt),
+				zap.Duration("retry_in", delay))
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, r.outbox.queries.published, msg.ID); err != nil {
+			return 0, err
+		}
+		logger.Debug("outbox message published")
+	}
+	return len(messages), tx.Commit()
+}
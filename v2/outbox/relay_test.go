@@ -0,0 +1,143 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/masonhubco/rebar/v2/outbox"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+var messageColumns = []string{"id", "topic", "key", "payload", "attempts", "last_error", "created_at"}
+
+func Test_Relay_Flush(t *testing.T) {
+	t.Parallel()
+
+	box, _, mock := newOutbox(t)
+	core, logs := observer.New(zapcore.DebugLevel)
+	publisher := outbox.NewMemoryPublisher()
+	failing := outbox.PublisherFunc(func(ctx context.Context, msg *outbox.Message) error {
+		if msg.Key == "order-2" {
+			return errors.New("broker unavailable")
+		}
+		return publisher.Publish(ctx, msg)
+	})
+	relay := outbox.NewRelay(box, failing, outbox.RelayOptions{
+		BatchSize: 10,
+		Backoff:   func(attempt int) time.Duration { return time.Duration(attempt) * time.Second },
+		Logger:    zap.New(core),
+	})
+
+	now := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, topic, key, payload::text, attempts, last_error, created_at\s+FROM events_outbox o.+FOR UPDATE SKIP LOCKED`).
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows(messageColumns).
+			AddRow(1, "order.created", "order-1", `{"order_id":"order-1"}`, 0, "", now).
+			AddRow(2, "order.created", "order-2", `{"order_id":"order-2"}`, 2, "timeout", now))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM events_outbox WHERE id = $1")).
+		WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE events_outbox\s+SET attempts = attempts \+ 1`).
+		WithArgs(2, "broker unavailable", 3.0).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	n, err := relay.Flush(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	published := publisher.Messages("")
+	require.Len(t, published, 1)
+	assert.Equal(t, int64(1), published[0].ID)
+	assert.JSONEq(t, `{"order_id":"order-1"}`, string(published[0].Payload))
+
+	failures := logs.FilterMessage("failed to publish outbox message").All()
+	require.Len(t, failures, 1)
+	fields := failures[0].ContextMap()
+	assert.Equal(t, int64(2), fields["message_id"])
+	assert.Equal(t, "order-2", fields["key"])
+	assert.Equal(t, int64(3), fields["attempt"])
+	assert.Equal(t, "broker unavailable", fields["error"])
+}
+
+func Test_Relay_Flush_Errors(t *testing.T) {
+	t.Parallel()
+
+	box, _, mock := newOutbox(t)
+	relay := outbox.NewRelay(box, outbox.NewMemoryPublisher(), outbox.RelayOptions{})
+
+	// the batch is rolled back, so the published messages are published again
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id").
+		WillReturnRows(sqlmock.NewRows(messageColumns).AddRow(1, "order.created", "", `{}`, 0, "", time.Now()))
+	mock.ExpectExec("DELETE FROM events_outbox").WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	_, err := relay.Flush(context.Background())
+	assert.EqualError(t, err, "connection reset")
+}
+
+func Test_Relay_StartStop(t *testing.T) {
+	t.Parallel()
+
+	box, _, mock := newOutbox(t)
+	publisher := outbox.NewMemoryPublisher()
+	relay := outbox.NewRelay(box, publisher, outbox.RelayOptions{BatchSize: 1, PollInterval: time.Hour})
+
+	// a full batch is followed by another one right away
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(messageColumns).AddRow(1, "order.created", "order-1", `{}`, 0, "", time.Now()))
+	mock.ExpectExec("DELETE FROM events_outbox").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id").WithArgs(1).WillReturnRows(sqlmock.NewRows(messageColumns))
+	mock.ExpectCommit()
+
+	require.NoError(t, relay.Start(context.Background()))
+	assert.EqualError(t, relay.Start(context.Background()), "outbox: relay already started")
+	assert.Eventually(t, func() bool { return mock.ExpectationsWereMet() == nil }, time.Second, time.Millisecond)
+	require.NoError(t, relay.Stop(context.Background()))
+	assert.Len(t, publisher.Messages(""), 1)
+}
+
+func Test_Relay_SameKeyBacklog(t *testing.T) {
+	t.Parallel()
+
+	box, _, mock := newOutbox(t)
+	publisher := outbox.NewMemoryPublisher()
+	relay := outbox.NewRelay(box, publisher, outbox.RelayOptions{BatchSize: 10, PollInterval: time.Hour})
+
+	// messages of the same key are relayed one per batch, without waiting for
+	// PollInterval between the batches
+	for id := 1; id <= 3; id++ {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id").WithArgs(10).
+			WillReturnRows(sqlmock.NewRows(messageColumns).AddRow(id, "order.updated", "order-1", `{}`, 0, "", time.Now()))
+		mock.ExpectExec("DELETE FROM events_outbox").WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id").WithArgs(10).WillReturnRows(sqlmock.NewRows(messageColumns))
+	mock.ExpectCommit()
+
+	require.NoError(t, relay.Start(context.Background()))
+	assert.Eventually(t, func() bool { return mock.ExpectationsWereMet() == nil }, time.Second, time.Millisecond)
+	require.NoError(t, relay.Stop(context.Background()))
+	assert.Len(t, publisher.Messages(""), 3)
+}
+
+func Test_DefaultBackoff(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, time.Second, outbox.DefaultBackoff(1))
+	assert.Equal(t, 16*time.Second, outbox.DefaultBackoff(5))
+	assert.Equal(t, 5*time.Minute, outbox.DefaultBackoff(10))
+}
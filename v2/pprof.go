@@ -0,0 +1,179 @@
+package rebar
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The profiles are served with runtime/pprof rather than net/http/pprof, and the
+// metrics without expvar: importing either registers their endpoints on
+// http.DefaultServeMux, for every app importing rebar.
+
+// maxProfileDuration is the longest CPU profile or trace that can be requested
+const maxProfileDuration = time.Minute
+
+// pprofHandler serves the same routes as net/http/pprof, under /debug/pprof
+func pprofHandler(c *gin.Context) {
+	switch name := strings.TrimPrefix(c.Param("profile"), "/"); name {
+	case "":
+		pprofIndex(c)
+	case "cmdline":
+		c.String(http.StatusOK, strings.Join(os.Args, "\x00"))
+	case "profile":
+		cpuProfile(c)
+	case "symbol":
+		pprofSymbol(c)
+	case "trace":
+		executionTrace(c)
+	default:
+		namedProfile(c, name)
+	}
+}
+
+// pprofIndex lists the profiles
+func pprofIndex(c *gin.Context) {
+	var b strings.Builder
+	b.WriteString("profiles:\n")
+	for _, p := range pprof.Profiles() {
+		fmt.Fprintf(&b, "%d\t%s\n", p.Count(), p.Name())
+	}
+	b.WriteString("\nprofile, the CPU profile for ?seconds=30\n")
+	b.WriteString("trace, the execution trace for ?seconds=1\n")
+	c.String(http.StatusOK, b.String())
+}
+
+// namedProfile writes a profile like heap or goroutine, as text when debug is set
+func namedProfile(c *gin.Context, name string) {
+	p := pprof.Lookup(name)
+	if p == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("unknown profile %q", name)})
+		return
+	}
+	if gc, _ := strconv.Atoi(c.Query("gc")); name == "heap" && gc > 0 {
+		runtime.GC()
+	}
+	debug, _ := strconv.Atoi(c.Query("debug"))
+	if debug != 0 {
+		c.Header("Content-Type", "text/plain; charset=utf-8")
+	} else {
+		attachment(c, name)
+	}
+	p.WriteTo(c.Writer, debug)
+}
+
+// cpuProfile writes the CPU profile for the requested duration
+func cpuProfile(c *gin.Context) {
+	d, ok := profileDuration(c, 30*time.Second)
+	if !ok {
+		return
+	}
+	// the profile can be written before StartCPUProfile returns
+	attachment(c, "profile")
+	if err := pprof.StartCPUProfile(c.Writer); err != nil {
+		unattach(c)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	waitForProfile(c, d)
+	pprof.StopCPUProfile()
+}
+
+// executionTrace writes the execution trace for the requested duration
+func executionTrace(c *gin.Context) {
+	d, ok := profileDuration(c, time.Second)
+	if !ok {
+		return
+	}
+	attachment(c, "trace")
+	if err := trace.Start(c.Writer); err != nil {
+		unattach(c)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	waitForProfile(c, d)
+	trace.Stop()
+}
+
+// pprofSymbol returns the functions at the program counters given in the body of
+// POST requests, or in the query, separated by +
+func pprofSymbol(c *gin.Context) {
+	addrs := c.Request.URL.RawQuery
+	if c.Request.Method == http.MethodPost {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		addrs = string(body)
+	}
+	var b bytes.Buffer
+	// tells pprof that symbols are available
+	b.WriteString("num_symbols: 1\n")
+	for _, word := range strings.Split(addrs, "+") {
+		pc, err := strconv.ParseUint(word, 0, 64)
+		if err != nil || pc == 0 {
+			continue
+		}
+		if f := runtime.FuncForPC(uintptr(pc)); f != nil {
+			fmt.Fprintf(&b, "%#x %s\n", pc, f.Name())
+		}
+	}
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", b.Bytes())
+}
+
+// varsHandler serves the variables expvar publishes by default, cmdline and
+// memstats, in the same JSON document as expvar's /debug/vars
+func varsHandler(c *gin.Context) {
+	var memstats runtime.MemStats
+	runtime.ReadMemStats(&memstats)
+	c.JSON(http.StatusOK, gin.H{"cmdline": os.Args, "memstats": memstats})
+}
+
+// profileDuration returns the seconds param of the request, or def, and aborts the
+// request when it's not valid
+func profileDuration(c *gin.Context, def time.Duration) (time.Duration, bool) {
+	d := def
+	if seconds := c.Query("seconds"); seconds != "" {
+		n, err := strconv.ParseInt(seconds, 10, 64)
+		// compared in seconds, as a large n overflows once made a duration
+		if err != nil || n <= 0 || n > int64(maxProfileDuration/time.Second) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("seconds must be between 1 and %d", int(maxProfileDuration.Seconds())),
+			})
+			return 0, false
+		}
+		d = time.Duration(n) * time.Second
+	}
+	return d, true
+}
+
+// waitForProfile waits for d, or until the client is gone
+func waitForProfile(c *gin.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-c.Request.Context().Done():
+	}
+}
+
+func attachment(c *gin.Context, name string) {
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, name))
+}
+
+func unattach(c *gin.Context) {
+	c.Header("Content-Type", "")
+	c.Header("Content-Disposition", "")
+}
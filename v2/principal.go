@@ -0,0 +1,78 @@
+package rebar
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Principal types of the authenticators provided by rebar
+const (
+	PrincipalSystemToken       = "system_token"
+	PrincipalJWT               = "jwt"
+	PrincipalAPIKey            = "api_key"
+	PrincipalClientCertificate = "client_certificate"
+)
+
+// Principal is who a request is authenticated as, whatever the credentials
+type Principal struct {
+	// Subject identifies the principal, like the caller of a system token or the
+	// subject of a JWT
+	Subject string
+	// Type is how the principal was authenticated, like PrincipalJWT
+	Type   string
+	Scopes []string
+	// Attributes hold what else the credentials tell about the principal, like the
+	// claims of a JWT
+	Attributes map[string]interface{}
+}
+
+// HasScopes reports whether the principal was granted every scope
+func (p Principal) HasScopes(scopes ...string) bool {
+	for _, scope := range scopes {
+		granted := false
+		for _, s := range p.Scopes {
+			granted = granted || s == scope
+		}
+		if !granted {
+			return false
+		}
+	}
+	return true
+}
+
+type principalContextKey struct{}
+
+// ContextWithPrincipal returns a copy of ctx holding principal
+func ContextWithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal held by ctx, so that code without
+// access to the gin context, like a service called by a handler, knows who the
+// request is authenticated as
+func PrincipalFromContext(ctx context.Context) (principal *Principal, ok bool) {
+	principal, ok = ctx.Value(principalContextKey{}).(*Principal)
+	return
+}
+
+// SetPrincipal sets the principal of the request, in the gin context and in the
+// context of the request
+func SetPrincipal(c *gin.Context, principal *Principal) {
+	c.Set(PrincipalKey, principal)
+	if c.Request != nil {
+		c.Request = c.Request.WithContext(ContextWithPrincipal(c.Request.Context(), principal))
+	}
+}
+
+// PrincipalFrom returns the principal the request is authenticated as
+func PrincipalFrom(c *gin.Context) (principal *Principal, ok bool) {
+	if maybePrincipal, exists := c.Get(PrincipalKey); exists {
+		principal, ok = maybePrincipal.(*Principal)
+		return
+	}
+	if c.Request != nil {
+		return PrincipalFromContext(c.Request.Context())
+	}
+	return
+}
@@ -0,0 +1,111 @@
+package rebar_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/masonhubco/rebar/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Principal_HasScopes(t *testing.T) {
+	t.Parallel()
+
+	principal := rebar.Principal{Subject: "acme", Scopes: []string{"orders:read", "orders:write"}}
+
+	tests := []struct {
+		name  string
+		given []string
+		want  bool
+	}{
+		{name: "no scope", given: nil, want: true},
+		{name: "granted scope", given: []string{"orders:read"}, want: true},
+		{name: "granted scopes", given: []string{"orders:write", "orders:read"}, want: true},
+		{name: "one scope missing", given: []string{"orders:read", "billing:read"}, want: false},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.want, principal.HasScopes(tc.given...))
+		})
+	}
+}
+
+func Test_PrincipalFrom(t *testing.T) {
+	t.Parallel()
+
+	principal := &rebar.Principal{Subject: "acme", Type: rebar.PrincipalAPIKey}
+
+	tests := []struct {
+		name          string
+		mock          func(*gin.Context)
+		wantPrincipal *rebar.Principal
+		isItOk        bool
+	}{
+		{
+			name:          "context does not have a principal",
+			mock:          func(ctx *gin.Context) {},
+			wantPrincipal: nil,
+			isItOk:        false,
+		},
+		{
+			name: "context has a principal but it is not a rebar principal",
+			mock: func(ctx *gin.Context) {
+				ctx.Set(rebar.PrincipalKey, "acme")
+			},
+			wantPrincipal: nil,
+			isItOk:        false,
+		},
+		{
+			name: "happy path and principal is set",
+			mock: func(ctx *gin.Context) {
+				rebar.SetPrincipal(ctx, principal)
+			},
+			wantPrincipal: principal,
+			isItOk:        true,
+		},
+		{
+			name: "principal in the request context only",
+			mock: func(ctx *gin.Context) {
+				ctx.Request = ctx.Request.WithContext(rebar.ContextWithPrincipal(ctx.Request.Context(), principal))
+			},
+			wantPrincipal: principal,
+			isItOk:        true,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			resp := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(resp)
+			ctx.Request = httptest.NewRequest("GET", "/", nil)
+			tc.mock(ctx)
+
+			gotPrincipal, ok := rebar.PrincipalFrom(ctx)
+
+			require.Equal(t, tc.isItOk, ok)
+			assert.Equal(t, tc.wantPrincipal, gotPrincipal)
+		})
+	}
+}
+
+func Test_PrincipalFromContext(t *testing.T) {
+	t.Parallel()
+
+	_, ok := rebar.PrincipalFromContext(context.Background())
+	assert.False(t, ok)
+
+	principal := &rebar.Principal{Subject: "acme"}
+	got, ok := rebar.PrincipalFromContext(rebar.ContextWithPrincipal(context.Background(), principal))
+	require.True(t, ok)
+	assert.Same(t, principal, got)
+}
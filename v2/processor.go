@@ -2,8 +2,11 @@ package rebar
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"strings"
 	"sync"
+	"time"
 )
 
 // Processor interface defines the necessary functions to start and gracefully stop
@@ -13,38 +16,466 @@ type Processor interface {
 	Stop(wg *sync.WaitGroup) (err error)
 }
 
+// LifecycleProcessor is the context driven successor of Processor. Stop receives a
+// context that carries the processor's shutdown deadline: the remaining global
+// ProcessorShutdownBudget, or the processor's own StopTimeout when it is shorter.
+// Stop should return as soon as the processor is fully stopped, or when the
+// context is done.
+type LifecycleProcessor interface {
+	Start(ctx context.Context) (err error)
+	Stop(ctx context.Context) (err error)
+}
+
+// AdaptProcessor wraps a Processor so it can be used where a LifecycleProcessor is
+// expected. The adapter waits for the processor to call wg.Done(), or for the
+// context to be done, whichever comes first.
+func AdaptProcessor(p Processor) LifecycleProcessor {
+	return processorAdapter{p}
+}
+
+type processorAdapter struct {
+	Processor
+}
+
+func (a processorAdapter) Stop(ctx context.Context) error {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	err := a.Processor.Stop(&wg)
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		if err != nil {
+			return err
+		}
+		return ctx.Err()
+	}
+}
+
+// ProcessorTimeoutError is reported by StopProcessorsWithContext for every processor
+// that did not stop before its deadline.
+type ProcessorTimeoutError struct {
+	Name string
+}
+
+func (e *ProcessorTimeoutError) Error() string {
+	return fmt.Sprintf("processor %s did not stop before its deadline", e.Name)
+}
+
+// Is makes errors.Is(err, context.DeadlineExceeded) true for timeout errors
+func (e *ProcessorTimeoutError) Is(target error) bool {
+	return target == context.DeadlineExceeded
+}
+
+// ProcessorAbandonedError is reported by StopProcessorsWithContext for every processor
+// left running because a processor depending on it did not stop before its deadline.
+type ProcessorAbandonedError struct {
+	Name string
+	// Dependent is the processor depending on it that may still be running
+	Dependent string
+}
+
+func (e *ProcessorAbandonedError) Error() string {
+	return fmt.Sprintf("processor %s not stopped: %s depends on it and did not stop before its deadline", e.Name, e.Dependent)
+}
+
+// Is makes errors.Is(err, context.DeadlineExceeded) true for abandoned processors,
+// as they're left running because of a deadline
+func (e *ProcessorAbandonedError) Is(target error) bool {
+	return target == context.DeadlineExceeded
+}
+
+var (
+	// ErrProcessorCycle is returned by StartProcessors when the declared processor
+	// dependencies form a cycle. No processor is started in that case.
+	ErrProcessorCycle = errors.New("processor dependency cycle")
+	// ErrUnknownProcessorDependency is returned by StartProcessors when a processor
+	// depends on a name that has not been attached. No processor is started in that case.
+	ErrUnknownProcessorDependency = errors.New("unknown processor dependency")
+	// ErrDuplicateProcessorName is returned by StartProcessors when two processors
+	// are attached with the same name. No processor is started in that case.
+	ErrDuplicateProcessorName = errors.New("duplicate processor name")
+)
+
+// ProcessorOption customizes how a processor is attached with AddProcessor
+type ProcessorOption func(*processorEntry)
+
+// WithName gives the processor a name that other processors can depend on and
+// that is used when reporting errors. Processors without a name are named after
+// their type.
+func WithName(name string) ProcessorOption {
+	return func(e *processorEntry) {
+		e.name = name
+		e.named = true
+	}
+}
+
+// StopTimeout gives the processor its own shutdown deadline. The processor never
+// gets more time than what is left of the global ProcessorShutdownBudget.
+func StopTimeout(d time.Duration) ProcessorOption {
+	return func(e *processorEntry) {
+		e.stopTimeout = d
+	}
+}
+
+// DependsOn declares that the processor needs the named processors to be started
+// before it, and stopped after it.
+func DependsOn(names ...string) ProcessorOption {
+	return func(e *processorEntry) {
+		e.dependsOn = append(e.dependsOn, names...)
+	}
+}
+
+type processorEntry struct {
+	name        string
+	named       bool
+	dependsOn   []string
+	stopTimeout time.Duration
+	supervision Supervision
+	processor   LifecycleProcessor
+	started     bool
+
+	// run state, guarded by mu
+	mu         sync.Mutex
+	run        int
+	cancelRun  context.CancelFunc
+	restarting bool
+	restarts   []time.Time
+}
+
 // AddProcessor allows you to hang any additional sub processes off of the web server
 // It must conform to the processor interface defined above.
 // Rebar will attempt to start and gracefully stop any attached process using the Start and Stop functions
-func (r *Rebar) AddProcessor(p Processor) {
-	r.processors = append(r.processors, p)
+// Processors are started in dependency order (see DependsOn) and stopped in reverse.
+func (r *Rebar) AddProcessor(p Processor, opts ...ProcessorOption) {
+	r.addProcessor(p, AdaptProcessor(p), opts)
+}
+
+// AddLifecycleProcessor attaches a LifecycleProcessor. It accepts the same options
+// as AddProcessor.
+func (r *Rebar) AddLifecycleProcessor(p LifecycleProcessor, opts ...ProcessorOption) {
+	r.addProcessor(p, p, opts)
+}
+
+func (r *Rebar) addProcessor(original interface{}, p LifecycleProcessor, opts []ProcessorOption) {
+	e := &processorEntry{processor: p}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if !e.named {
+		e.name = fmt.Sprintf("%T#%d", original, len(r.processors))
+	}
+	r.processors = append(r.processors, e)
 }
 
 // StopProcessors stops the attached processors using the Stop() method from the interface.
 // It also builds a list of errors and logs them out so you can do something about those errors.
+// It is kept for compatibility with the original Processor interface: processors are
+// stopped with StopProcessorsWithContext within the ProcessorShutdownBudget, and wg
+// is released once they all stopped or missed their deadline.
 func (r *Rebar) StopProcessors(wg *sync.WaitGroup) (errs []error) {
-	for _, p := range r.processors {
-		wg.Add(1)
-		err := p.Stop(wg)
-		if err != nil {
-			log.Printf("[rebar] ERROR: unable to stop processor: %s", err)
-			errs = append(errs, err)
+	wg.Add(1)
+	defer wg.Done()
+
+	ctx, cancel := r.processorShutdownContext()
+	defer cancel()
+	return r.StopProcessorsWithContext(ctx)
+}
+
+// StopProcessorsWithContext stops the attached processors in reverse dependency order
+// and blocks until they are all stopped or missed their deadline. A processor is only
+// asked to stop once every processor depending on it has stopped. The deadline of
+// ctx is the global shutdown budget shared by all processors, and processors attached
+// with StopTimeout get a shorter deadline of their own. Every processor that missed
+// its deadline is reported with a *ProcessorTimeoutError carrying its name. As it may
+// still be running, its dependencies are left running too, and reported with a
+// *ProcessorAbandonedError.
+func (r *Rebar) StopProcessorsWithContext(ctx context.Context) (errs []error) {
+	levels, err := r.processorLevels()
+	if err != nil {
+		// the dependency graph is invalid, so nothing was started by StartProcessors
+		return nil
+	}
+	// no more restarts from here on
+	r.supervisor.stop(ctx)
+
+	// stillRunning maps the processors that may still be running to the first of
+	// them depending on it
+	var mu sync.Mutex
+	stillRunning := map[string]string{}
+	keepRunning := func(e *processorEntry) {
+		for _, dep := range e.dependsOn {
+			if _, ok := stillRunning[dep]; !ok {
+				stillRunning[dep] = e.name
+			}
 		}
 	}
+	for i := len(levels) - 1; i >= 0; i-- {
+		var levelWG sync.WaitGroup
+		for _, e := range levels[i] {
+			// the processors of a level don't depend on each other, so the ones stopping
+			// already can't change whether e is left running
+			mu.Lock()
+			dependent, abandoned := stillRunning[e.name]
+			if abandoned {
+				// its dependencies are left running as well
+				keepRunning(e)
+			}
+			mu.Unlock()
+			if abandoned {
+				if e.started {
+					err := &ProcessorAbandonedError{Name: e.name, Dependent: dependent}
+					r.emit(Event{
+						Type:      EventProcessorStopFailed,
+						Message:   "processor left running",
+						Processor: e.name,
+						Err:       err,
+					})
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+				}
+				continue
+			}
+			if !e.started {
+				continue
+			}
+			levelWG.Add(1)
+			go func(e *processorEntry) {
+				defer levelWG.Done()
+				defer e.cancelRunContext()
+				start := time.Now()
+				if err := stopProcessor(ctx, e); err != nil {
+					r.emit(Event{
+						Type:      EventProcessorStopFailed,
+						Message:   "unable to stop processor",
+						Processor: e.name,
+						Err:       err,
+						Duration:  time.Since(start),
+					})
+					mu.Lock()
+					errs = append(errs, err)
+					var timeout *ProcessorTimeoutError
+					if errors.As(err, &timeout) {
+						keepRunning(e)
+					}
+					mu.Unlock()
+					return
+				}
+				r.emit(Event{
+					Type:      EventProcessorStopped,
+					Message:   "processor stopped",
+					Processor: e.name,
+					Duration:  time.Since(start),
+				})
+			}(e)
+		}
+		// wait for this level to be fully stopped before stopping its dependencies
+		levelWG.Wait()
+	}
 	return
 }
 
+// stopProcessor calls Stop in its own goroutine so that a processor ignoring its
+// context can still be reported once its deadline is reached.
+func stopProcessor(ctx context.Context, e *processorEntry) error {
+	if e.stopTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.stopTimeout)
+		defer cancel()
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- e.processor.Stop(ctx)
+	}()
+	select {
+	case err := <-result:
+		if errors.Is(err, context.DeadlineExceeded) {
+			return &ProcessorTimeoutError{Name: e.name}
+		}
+		return err
+	case <-ctx.Done():
+		return &ProcessorTimeoutError{Name: e.name}
+	}
+}
+
+func (e *processorEntry) cancelRunContext() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.cancelRun != nil {
+		e.cancelRun()
+	}
+}
+
+// stopStartedProcessors stops the started processors within ProcessorShutdownBudget
+func (r *Rebar) stopStartedProcessors() {
+	ctx, cancel := r.processorShutdownContext()
+	defer cancel()
+	r.StopProcessorsWithContext(ctx)
+}
+
+func (r *Rebar) processorShutdownContext() (context.Context, context.CancelFunc) {
+	if r.ProcessorShutdownBudget > 0 {
+		return context.WithTimeout(context.Background(), r.ProcessorShutdownBudget)
+	}
+	return context.WithCancel(context.Background())
+}
+
 // StartProcessors starts the attached processors and builds
 // a list of any errors from starting said processors.
 // So you can review and then, you know, do something about them.
+// Every processor is started with its own context, canceled once the processor is
+// stopped, that it can give to ReportExit when its background work exits.
+// Processors are started in dependency order. A processor whose dependency failed
+// to start is not started. When the dependency graph is invalid (a cycle, an unknown
+// dependency or a duplicate name) no processor is started and the returned error
+// wraps ErrProcessorCycle, ErrUnknownProcessorDependency or ErrDuplicateProcessorName.
 func (r *Rebar) StartProcessors() (errs []error) {
-	ctx := context.Background()
-	for _, p := range r.processors {
-		err := p.Start(ctx)
-		if err != nil {
-			log.Printf("[rebar] ERROR: unable to start processor: %s", err)
-			errs = append(errs, err)
+	levels, err := r.processorLevels()
+	if err != nil {
+		r.emit(Event{Type: EventProcessorStartFailed, Message: "unable to start processors", Err: err})
+		return []error{err}
+	}
+
+	failed := map[string]bool{}
+	for _, level := range levels {
+		for _, e := range level {
+			if dep := firstFailed(e.dependsOn, failed); dep != "" {
+				err := fmt.Errorf("processor %s not started: dependency %s failed to start", e.name, dep)
+				r.emit(Event{
+					Type:      EventProcessorStartFailed,
+					Message:   "processor not started",
+					Processor: e.name,
+					Err:       err,
+				})
+				errs = append(errs, err)
+				failed[e.name] = true
+				continue
+			}
+			start := time.Now()
+			if err := r.startEntry(e); err != nil {
+				// it's not stopped, as it didn't start
+				e.cancelRunContext()
+				r.emit(Event{
+					Type:      EventProcessorStartFailed,
+					Message:   "unable to start processor",
+					Processor: e.name,
+					Err:       err,
+					Duration:  time.Since(start),
+				})
+				errs = append(errs, err)
+				failed[e.name] = true
+				continue
+			}
+			e.started = true
+			r.emit(Event{
+				Type:      EventProcessorStarted,
+				Message:   "processor started",
+				Processor: e.name,
+				Duration:  time.Since(start),
+			})
 		}
 	}
 	return
 }
+
+func isProcessorGraphError(err error) bool {
+	return errors.Is(err, ErrProcessorCycle) ||
+		errors.Is(err, ErrUnknownProcessorDependency) ||
+		errors.Is(err, ErrDuplicateProcessorName)
+}
+
+func firstFailed(names []string, failed map[string]bool) string {
+	for _, name := range names {
+		if failed[name] {
+			return name
+		}
+	}
+	return ""
+}
+
+// processorLevels sorts the attached processors topologically. Every processor in a
+// level only depends on processors in earlier levels, and processors keep the order
+// in which they were attached within a level.
+func (r *Rebar) processorLevels() ([][]*processorEntry, error) {
+	byName := make(map[string]*processorEntry, len(r.processors))
+	for _, e := range r.processors {
+		if _, exists := byName[e.name]; exists {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateProcessorName, e.name)
+		}
+		byName[e.name] = e
+	}
+	for _, e := range r.processors {
+		for _, dep := range e.dependsOn {
+			if _, exists := byName[dep]; !exists {
+				return nil, fmt.Errorf("%w: %s depends on %s", ErrUnknownProcessorDependency, e.name, dep)
+			}
+		}
+	}
+
+	var levels [][]*processorEntry
+	placed := make(map[string]bool, len(r.processors))
+	for len(placed) < len(r.processors) {
+		var level []*processorEntry
+		for _, e := range r.processors {
+			if !placed[e.name] && allPlaced(e.dependsOn, placed) {
+				level = append(level, e)
+			}
+		}
+		if len(level) == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrProcessorCycle, findCycle(r.processors, byName, placed))
+		}
+		for _, e := range level {
+			placed[e.name] = true
+		}
+		levels = append(levels, level)
+	}
+	return levels, nil
+}
+
+func allPlaced(names []string, placed map[string]bool) bool {
+	for _, name := range names {
+		if !placed[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// findCycle walks the dependencies of the processors that could not be placed and
+// returns the first cycle found, formatted as "a -> b -> a".
+func findCycle(entries []*processorEntry, byName map[string]*processorEntry, placed map[string]bool) string {
+	for _, start := range entries {
+		if placed[start.name] {
+			continue
+		}
+		path := []string{start.name}
+		seen := map[string]int{start.name: 0}
+		for current := start; ; {
+			var next *processorEntry
+			for _, dep := range current.dependsOn {
+				if !placed[dep] {
+					next = byName[dep]
+					break
+				}
+			}
+			if next == nil {
+				break
+			}
+			if i, ok := seen[next.name]; ok {
+				return strings.Join(append(path[i:], next.name), " -> ")
+			}
+			seen[next.name] = len(path)
+			path = append(path, next.name)
+			current = next
+		}
+	}
+	return ""
+}
@@ -1,6 +1,7 @@
 package rebar_test
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"testing"
@@ -8,6 +9,7 @@ import (
 
 	"github.com/masonhubco/rebar/v2"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_Processors(t *testing.T) {
@@ -19,6 +21,7 @@ func Test_Processors(t *testing.T) {
 		mockProcessor mockProcessor
 		wantStartErrs []error
 		wantStopErrs  []error
+		wantStops     int
 	}{
 		{
 			name:         "good start and good stop",
@@ -29,9 +32,11 @@ func Test_Processors(t *testing.T) {
 			},
 			wantStartErrs: []error{},
 			wantStopErrs:  []error{},
+			wantStops:     1,
 		},
 		{
-			name: "bad start and bad stop",
+			// a processor that failed to start is not stopped
+			name: "bad start",
 			givenOptions: rebar.Options{
 				ShutDownWait: 1 * time.Second,
 			},
@@ -40,7 +45,8 @@ func Test_Processors(t *testing.T) {
 				stopFn:  func() error { return errors.New("why doesn't anything work") },
 			},
 			wantStartErrs: []error{errors.New("totally bad thing that happened")},
-			wantStopErrs:  []error{errors.New("why doesn't anything work")},
+			wantStopErrs:  []error{},
+			wantStops:     0,
 		},
 	}
 
@@ -59,7 +65,313 @@ func Test_Processors(t *testing.T) {
 			wg.Wait()
 			assert.ElementsMatch(t, tc.wantStopErrs, errs)
 			assert.Equal(t, 1, tc.mockProcessor.starts)
-			assert.Equal(t, 1, tc.mockProcessor.stops)
+			assert.Equal(t, tc.wantStops, tc.mockProcessor.stops)
+		})
+	}
+}
+
+type orderedProcessor struct {
+	name     string
+	mu       *sync.Mutex
+	events   *[]string
+	startErr error
+	// stopDelay makes Stop release the wait group asynchronously
+	stopDelay time.Duration
+}
+
+func (p *orderedProcessor) record(event string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	*p.events = append(*p.events, event+" "+p.name)
+}
+
+func (p *orderedProcessor) Start(ctx context.Context) error {
+	p.record("start")
+	return p.startErr
+}
+
+func (p *orderedProcessor) Stop(wg *sync.WaitGroup) error {
+	p.record("stopping")
+	go func() {
+		time.Sleep(p.stopDelay)
+		p.record("stopped")
+		wg.Done()
+	}()
+	return nil
+}
+
+func Test_Processors_DependencyOrder(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var events []string
+	newProcessor := func(name string, stopDelay time.Duration) *orderedProcessor {
+		return &orderedProcessor{name: name, mu: &mu, events: &events, stopDelay: stopDelay}
+	}
+
+	r := rebar.New(rebar.Options{})
+	// attached out of order on purpose
+	r.AddProcessor(newProcessor("consumer", 50*time.Millisecond),
+		rebar.WithName("consumer"), rebar.DependsOn("migrator", "cache"))
+	r.AddProcessor(newProcessor("cache", 0),
+		rebar.WithName("cache"), rebar.DependsOn("migrator"))
+	r.AddProcessor(newProcessor("migrator", 0),
+		rebar.WithName("migrator"))
+
+	errs := r.StartProcessors()
+	require.Empty(t, errs)
+
+	var wg sync.WaitGroup
+	errs = r.StopProcessors(&wg)
+	wg.Wait()
+	require.Empty(t, errs)
+
+	assert.Equal(t, []string{
+		"start migrator",
+		"start cache",
+		"start consumer",
+		"stopping consumer",
+		"stopped consumer",
+		"stopping cache",
+		"stopped cache",
+		"stopping migrator",
+		"stopped migrator",
+	}, events)
+}
+
+func Test_Processors_InvalidGraph(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		attach  func(r *rebar.Rebar, p func() rebar.Processor)
+		wantErr error
+		wantMsg string
+	}{
+		{
+			name: "cycle",
+			attach: func(r *rebar.Rebar, p func() rebar.Processor) {
+				r.AddProcessor(p(), rebar.WithName("a"), rebar.DependsOn("b"))
+				r.AddProcessor(p(), rebar.WithName("b"), rebar.DependsOn("c"))
+				r.AddProcessor(p(), rebar.WithName("c"), rebar.DependsOn("a"))
+			},
+			wantErr: rebar.ErrProcessorCycle,
+			wantMsg: "processor dependency cycle: a -> b -> c -> a",
+		},
+		{
+			name: "unknown dependency",
+			attach: func(r *rebar.Rebar, p func() rebar.Processor) {
+				r.AddProcessor(p(), rebar.WithName("a"), rebar.DependsOn("nope"))
+			},
+			wantErr: rebar.ErrUnknownProcessorDependency,
+			wantMsg: "unknown processor dependency: a depends on nope",
+		},
+		{
+			name: "duplicate name",
+			attach: func(r *rebar.Rebar, p func() rebar.Processor) {
+				r.AddProcessor(p(), rebar.WithName("a"))
+				r.AddProcessor(p(), rebar.WithName("a"))
+			},
+			wantErr: rebar.ErrDuplicateProcessorName,
+			wantMsg: "duplicate processor name: a",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var started int
+			r := rebar.New(rebar.Options{})
+			r.Server.Addr = "127.0.0.1:0"
+			tc.attach(r, func() rebar.Processor {
+				return &mockProcessor{
+					startFn: func() error { started++; return nil },
+					stopFn:  func() error { return nil },
+				}
+			})
+
+			errs := r.StartProcessors()
+			require.Len(t, errs, 1)
+			assert.ErrorIs(t, errs[0], tc.wantErr)
+			assert.EqualError(t, errs[0], tc.wantMsg)
+			assert.Zero(t, started)
+
+			ctx, stop := context.WithCancel(context.Background())
+			stop()
+			assert.ErrorIs(t, r.RunWithContext(ctx, stop), tc.wantErr)
 		})
 	}
 }
+
+func Test_Processors_DependencyFailed(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var events []string
+	r := rebar.New(rebar.Options{})
+	r.AddProcessor(&orderedProcessor{name: "migrator", mu: &mu, events: &events,
+		startErr: errors.New("migration failed")}, rebar.WithName("migrator"))
+	r.AddProcessor(&orderedProcessor{name: "consumer", mu: &mu, events: &events},
+		rebar.WithName("consumer"), rebar.DependsOn("migrator"))
+
+	errs := r.StartProcessors()
+	require.Len(t, errs, 2)
+	assert.EqualError(t, errs[0], "migration failed")
+	assert.EqualError(t, errs[1], "processor consumer not started: dependency migrator failed to start")
+
+	var wg sync.WaitGroup
+	r.StopProcessors(&wg)
+	wg.Wait()
+
+	// neither the migrator nor the consumer started, so none is stopped
+	assert.Equal(t, []string{"start migrator"}, events)
+}
+
+type lifecycleProcessor struct {
+	stopFn func(ctx context.Context) error
+}
+
+func (p *lifecycleProcessor) Start(ctx context.Context) error { return nil }
+
+func (p *lifecycleProcessor) Stop(ctx context.Context) error { return p.stopFn(ctx) }
+
+func Test_Processors_ShutdownBudget(t *testing.T) {
+	t.Parallel()
+
+	block := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	ignoreContext := func(ctx context.Context) error {
+		time.Sleep(time.Hour)
+		return nil
+	}
+
+	r := rebar.New(rebar.Options{})
+	r.AddLifecycleProcessor(&lifecycleProcessor{stopFn: func(context.Context) error { return nil }},
+		rebar.WithName("quick"))
+	r.AddLifecycleProcessor(&lifecycleProcessor{stopFn: block},
+		rebar.WithName("stuck"), rebar.StopTimeout(20*time.Millisecond))
+	r.AddLifecycleProcessor(&lifecycleProcessor{stopFn: ignoreContext},
+		rebar.WithName("deaf"))
+	r.AddProcessor(&orderedProcessor{name: "legacy", mu: &sync.Mutex{}, events: &[]string{},
+		stopDelay: time.Hour}, rebar.WithName("legacy"))
+	require.Empty(t, r.StartProcessors())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	errs := r.StopProcessorsWithContext(ctx)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+
+	var names []string
+	for _, err := range errs {
+		var timeoutErr *rebar.ProcessorTimeoutError
+		require.True(t, errors.As(err, &timeoutErr))
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		names = append(names, timeoutErr.Name)
+	}
+	assert.ElementsMatch(t, []string{"stuck", "deaf", "legacy"}, names)
+}
+
+func Test_Processors_DependentMissedDeadline(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var events []string
+	r := rebar.New(rebar.Options{})
+	r.AddProcessor(&orderedProcessor{name: "database", mu: &mu, events: &events},
+		rebar.WithName("database"))
+	r.AddProcessor(&orderedProcessor{name: "cache", mu: &mu, events: &events},
+		rebar.WithName("cache"), rebar.DependsOn("database"))
+	r.AddProcessor(&orderedProcessor{name: "consumer", mu: &mu, events: &events, stopDelay: time.Hour},
+		rebar.WithName("consumer"), rebar.DependsOn("cache"), rebar.StopTimeout(20*time.Millisecond))
+	r.AddProcessor(&orderedProcessor{name: "api", mu: &mu, events: &events},
+		rebar.WithName("api"), rebar.DependsOn("database"))
+	require.Empty(t, r.StartProcessors())
+
+	errs := r.StopProcessorsWithContext(context.Background())
+
+	// the consumer may still be using the cache and the database, so they're left
+	// running, while the api was stopped
+	require.Len(t, errs, 3)
+	var timeoutErr *rebar.ProcessorTimeoutError
+	require.True(t, errors.As(errs[0], &timeoutErr))
+	assert.Equal(t, "consumer", timeoutErr.Name)
+	for i, name := range []string{"cache", "database"} {
+		var abandoned *rebar.ProcessorAbandonedError
+		require.True(t, errors.As(errs[i+1], &abandoned))
+		assert.Equal(t, name, abandoned.Name)
+		assert.ErrorIs(t, errs[i+1], context.DeadlineExceeded)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	assert.NotContains(t, events, "stopping cache")
+	assert.NotContains(t, events, "stopping database")
+	assert.Contains(t, events, "stopped api")
+}
+
+func Test_AdaptProcessor(t *testing.T) {
+	t.Parallel()
+
+	t.Run("waits for wg.Done()", func(t *testing.T) {
+		t.Parallel()
+
+		p := &orderedProcessor{name: "legacy", mu: &sync.Mutex{}, events: &[]string{},
+			stopDelay: 10 * time.Millisecond}
+		err := rebar.AdaptProcessor(p).Stop(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"stopping legacy", "stopped legacy"}, *p.events)
+	})
+
+	t.Run("returns stop error", func(t *testing.T) {
+		t.Parallel()
+
+		p := &mockProcessor{stopFn: func() error { return errors.New("why doesn't anything work") }}
+		err := rebar.AdaptProcessor(p).Stop(context.Background())
+		assert.EqualError(t, err, "why doesn't anything work")
+	})
+
+	t.Run("gives up when context is done", func(t *testing.T) {
+		t.Parallel()
+
+		p := &orderedProcessor{name: "legacy", mu: &sync.Mutex{}, events: &[]string{},
+			stopDelay: time.Hour}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		err := rebar.AdaptProcessor(p).Stop(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func Test_Rebar_StopOnProcessorStartFailure_StopsStarted(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var events []string
+	r := rebar.New(rebar.Options{Port: freePort(t), ShutDownWait: time.Second, StopOnProcessorStartFailure: true})
+	r.AddProcessor(&orderedProcessor{name: "migrator", mu: &mu, events: &events},
+		rebar.WithName("migrator"))
+	r.AddProcessor(&orderedProcessor{name: "cache", mu: &mu, events: &events, stopDelay: 20 * time.Millisecond},
+		rebar.WithName("cache"), rebar.DependsOn("migrator"))
+	r.AddProcessor(&orderedProcessor{name: "consumer", mu: &mu, events: &events, startErr: errors.New("broker unreachable")},
+		rebar.WithName("consumer"), rebar.DependsOn("cache"))
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	require.Error(t, r.RunWithContext(ctx, stop))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{
+		"start migrator",
+		"start cache",
+		"start consumer",
+		"stopping cache",
+		"stopped cache",
+		"stopping migrator",
+		"stopped migrator",
+	}, events)
+}
@@ -4,26 +4,47 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
 // Rebar is the MasonHub Base App
 type Rebar struct {
 	Environment                 string
+	Mode                        string
 	ShutdownWait                time.Duration
+	ProcessorShutdownBudget     time.Duration
+	DrainDelay                  time.Duration
 	StopOnProcessorStartFailure bool
 	Router                      *gin.Engine
 	Server                      *http.Server
+	Listeners                   []string
+	GracefulUpgrade             bool
+	UpgradeTimeout              time.Duration
+	Admin                       *gin.Engine
+	AdminServer                 *http.Server
+	Health                      *HealthRegistry
+	Logger                      Logger
+	OnEvent                     EventHook
 	ctx                         context.Context
-	processors                  []Processor
+	tlsOptions                  *TLSOptions
+	processors                  []*processorEntry
+	supervisor                  *supervisor
+	listenersMu                 sync.RWMutex
+	listeners                   []net.Listener
+	phaseMu                     sync.RWMutex
+	phase                       Phase
+	served                      uint64
+	logLevel                    *logLevelControl
 }
 
 // New creates a new Rebar instance. It does not start it up yet....nope, just creates a new Rebar app
@@ -33,83 +54,370 @@ type Rebar struct {
 // - Environment: development
 // - Port: 3000
 // - ShutdownWait: 30 seconds
+// - ProcessorShutdownBudget: same as ShutdownWait
 // - WriteTimeout: 15 seconds
 // - ReadTimeout: 15 seconds
 // - IdleTimeout: 60 seconds
+// - Health endpoints: /healthz, /readyz and /startupz on the admin listener, if any
+// - Version endpoint: /version on the admin listener, if any
 func New(opts Options) *Rebar {
 	opts = opts.ValuesOrDefaults()
-	gin.SetMode(opts.Mode())
 
 	router := gin.New()
-	return &Rebar{
+	r := &Rebar{
 		Environment:                 opts.Environment,
+		Mode:                        opts.Mode(),
 		Router:                      router,
 		StopOnProcessorStartFailure: opts.StopOnProcessorStartFailure,
 		ShutdownWait:                opts.ShutDownWait,
+		ProcessorShutdownBudget:     opts.ProcessorShutdownBudget,
+		DrainDelay:                  opts.DrainDelay,
+		Listeners:                   opts.Listeners,
+		GracefulUpgrade:             opts.GracefulUpgrade,
+		UpgradeTimeout:              opts.UpgradeTimeout,
+		tlsOptions:                  opts.TLS,
+		Health:                      NewHealthRegistry(),
+		Logger:                      opts.Logger,
+		OnEvent:                     opts.OnEvent,
+		supervisor:                  newSupervisor(),
+		phase:                       PhaseStarting,
 		Server: &http.Server{
 			Addr:           fmt.Sprintf("0.0.0.0:%s", opts.Port),
 			WriteTimeout:   opts.WriteTimeout,
 			ReadTimeout:    opts.ReadTimeout,
 			IdleTimeout:    opts.IdleTimeout,
-			Handler:        router,
 			MaxHeaderBytes: 1 << 20,
 		},
 	}
+	r.Server.Handler = r.countRequests(router)
+	if opts.LogLevel != nil {
+		r.logLevel = newLogLevelControl(*opts.LogLevel, r.emit)
+	}
+	if opts.AdminPort != "" {
+		// operational routes live on their own engine, so they never go through
+		// the middleware chain of the public router
+		r.Admin = gin.New()
+		r.AdminServer = newAdminServer(opts, r.Admin)
+		r.registerAdminEndpoints(r.Admin, opts)
+	} else if opts.Health.OnRouter {
+		r.registerHealthEndpoints(router, opts.Health)
+	}
+	return r
+}
+
+// IsDebugging reports whether the app runs in gin's debug mode, which is the case
+// in the development environment
+func (r *Rebar) IsDebugging() bool {
+	return r.Mode == gin.DebugMode
+}
+
+// NewValidated is like New, but fails when the options are invalid, or when the
+// standard logger can't be built. The returned error is an *OptionsError listing
+// every problem found, see Options.Validate.
+func NewValidated(opts Options) (*Rebar, error) {
+	var errs []error
+	if opts.Logger == nil {
+		if opts.LogLevel == nil {
+			level := zap.NewAtomicLevelAt(zap.InfoLevel)
+			opts.LogLevel = &level
+		}
+		logger, err := NewStandardLoggerAt(*opts.LogLevel)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to build the standard Logger: %w", err))
+		} else {
+			opts.Logger = logger
+		}
+	}
+	var invalid *OptionsError
+	if err := opts.Validate(); errors.As(err, &invalid) {
+		errs = append(errs, invalid.Errs...)
+	}
+	if len(errs) > 0 {
+		return nil, &OptionsError{Errs: errs}
+	}
+	return New(opts), nil
 }
 
 // Serve starts the rebar server and your app.
 // func (r *Rebar) Serve(quit <-chan os.Signal) error {
+// Supervised processors that exceed their restarts cancel ctx through stop.
 func (r *Rebar) RunWithContext(ctx context.Context, stop context.CancelFunc) error {
+	return r.run(ctx, stop, nil)
+}
+
+// RunWithListeners is like RunWithContext, but serves on listeners opened by the
+// caller instead of Port or Listeners. They're closed when the server shuts down.
+func (r *Rebar) RunWithListeners(ctx context.Context, stop context.CancelFunc, listeners ...net.Listener) error {
+	if len(listeners) == 0 {
+		return errors.New("[rebar] ERROR: no listener to serve on")
+	}
+	return r.run(ctx, stop, listeners)
+}
+
+func (r *Rebar) run(ctx context.Context, stop context.CancelFunc, given []net.Listener) error {
+	r.supervisor.setEscalate(stop)
+	r.setPhase(PhaseStarting)
+	defer r.setPhase(PhaseStopped)
+
+	if r.tlsOptions != nil {
+		reloader, err := NewCertReloader(*r.tlsOptions)
+		if err != nil {
+			return fmt.Errorf("[rebar] ERROR: %w", err)
+		}
+		reloader.emit = r.emit
+		r.Server.TLSConfig = reloader.TLSConfig()
+		go reloader.Watch(ctx)
+	}
+
+	listeners, adminListener, err := r.listen(given)
+	if err != nil {
+		return fmt.Errorf("[rebar] ERROR: %w", err)
+	}
+
+	if r.AdminServer != nil {
+		// the admin server starts first, so that startup probes can be answered
+		// while processors are starting, and it's shut down last
+		go r.serveAdmin(adminListener, stop)
+		defer r.shutdownAdmin()
+	}
+
 	if errs := r.StartProcessors(); len(errs) > 0 {
+		for _, err := range errs {
+			if isProcessorGraphError(err) {
+				// the graph is refused as a whole, so no processor was started
+				closeListeners(listeners)
+				return fmt.Errorf("[rebar] ERROR: rebar refused to start attached processors: %w", err)
+			}
+		}
 		if r.StopOnProcessorStartFailure {
+			// the processors that did start are stopped in reverse dependency order,
+			// so that none outlives what it depends on
+			r.stopStartedProcessors()
+			closeListeners(listeners)
 			return errors.New("[rebar] ERROR: rebar failed to start one or more attached processors (and the StopOnProcessorStartFailure setting is true)")
 		}
+		// the app runs without them, but it's not ready to receive traffic
+		failure := processorsStartError(errs)
+		r.Health.Register("processors", func(context.Context) error { return failure }, HealthCheckOptions{})
+	}
+
+	if r.IsDebugging() {
+		r.logRoutes()
 	}
 
 	// Run our server in a goroutine so that it doesn't block.
-	go func() {
-		if err := r.Server.ListenAndServe(); err != nil {
-			log.Println("[rebar]", err)
-			if !errors.Is(err, http.ErrServerClosed) {
-				stop()
-			}
-		}
-	}()
+	// decided once, as serving sets up HTTP/2 which fills Server.TLSConfig in
+	useTLS := r.Server.TLSConfig != nil
+	for _, l := range listeners {
+		go r.serve(l, useTLS, stop)
+	}
+	if r.logLevel != nil {
+		r.watchLogLevel(ctx)
+	}
+	r.setPhase(PhaseRunning)
+	if err := notifyUpgradeReady(); err != nil {
+		r.emit(Event{Type: EventUpgrade, Message: "unable to notify the previous process", Err: err})
+	}
+	if r.GracefulUpgrade {
+		go r.watchUpgrades(ctx, stop, listeners, adminListener)
+	}
 
 	// Block until we receive our signal.
 	<-ctx.Done()
-	log.Println("[rebar] shutting down server...")
+	r.drain()
+	r.setPhase(PhaseStopping)
 
-	var wg sync.WaitGroup
-	if errs := r.StopProcessors(&wg); len(errs) > 0 {
-		log.Println("[rebar] ERROR: rebar failed to gracefully shutdown one or more attached processors")
-	}
-	wg.Wait()
+	r.stopStartedProcessors()
 
 	// Create a deadline to wait for.
 	ctx, cancel := context.WithTimeout(context.Background(), r.ShutdownWait)
 	defer cancel()
 	// Doesn't block if no connections, but will otherwise wait
 	// until the timeout deadline.
-	if err := r.Server.Shutdown(ctx); err != nil {
-		return err
+	return r.Server.Shutdown(ctx)
+}
+
+// listen opens the listeners described by the Listeners specs, or a TCP listener on
+// Server.Addr when there are none, and the admin listener if any. Listeners handed
+// over by a previous process are used instead when there are some. Given listeners
+// replace all of the server listeners. Nothing is left open when any of them fails.
+func (r *Rebar) listen(given []net.Listener) ([]net.Listener, net.Listener, error) {
+	listeners, admin := given, net.Listener(nil)
+	opened := given != nil
+	if !opened {
+		var err error
+		listeners, admin, opened, err = inheritedListeners()
+		if err != nil {
+			return nil, nil, err
+		}
+		if opened {
+			r.emit(Event{
+				Type:    EventUpgrade,
+				Message: fmt.Sprintf("serving on %d listeners handed over by the previous process", len(listeners)),
+			})
+		}
+	}
+	if !opened && len(r.Listeners) == 0 {
+		l, err := net.Listen("tcp", r.Server.Addr)
+		if err != nil {
+			return nil, nil, err
+		}
+		listeners = append(listeners, l)
 	}
+	for _, spec := range r.Listeners {
+		if opened {
+			break
+		}
+		l, err := Listen(spec)
+		if err != nil {
+			closeListeners(listeners)
+			return nil, nil, err
+		}
+		listeners = append(listeners, l...)
+	}
+	if r.AdminServer != nil && admin == nil {
+		var err error
+		admin, err = net.Listen("tcp", r.AdminServer.Addr)
+		if err != nil {
+			closeListeners(listeners)
+			return nil, nil, fmt.Errorf("admin server: %w", err)
+		}
+	}
+
+	r.listenersMu.Lock()
+	defer r.listenersMu.Unlock()
+	r.listeners = listeners
+	return listeners, admin, nil
+}
+
+func closeListeners(listeners []net.Listener) {
+	for _, l := range listeners {
+		l.Close()
+	}
+}
+
+// Addrs returns the addresses the server listens on, once RunWithContext opened
+// its listeners
+func (r *Rebar) Addrs() []net.Addr {
+	r.listenersMu.RLock()
+	defer r.listenersMu.RUnlock()
+	addrs := make([]net.Addr, 0, len(r.listeners))
+	for _, l := range r.listeners {
+		addrs = append(addrs, l.Addr())
+	}
+	return addrs
+}
+
+func (r *Rebar) serve(l net.Listener, useTLS bool, stop context.CancelFunc) {
+	var err error
+	if useTLS {
+		// certificates are provided by the TLS config
+		err = r.Server.ServeTLS(l, "", "")
+	} else {
+		err = r.Server.Serve(l)
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		r.emit(Event{Type: EventServerError, Message: "server stopped serving", Err: err})
+		stop()
+	}
+}
+
+func (r *Rebar) serveAdmin(l net.Listener, stop context.CancelFunc) {
+	if err := r.AdminServer.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		r.emit(Event{Type: EventServerError, Message: "admin server stopped serving", Err: err})
+		stop()
+	}
+}
 
-	log.Println("[rebar] server exiting")
-	return nil
+// logRoutes lists the routes of the app, which gin only does in its global debug mode
+func (r *Rebar) logRoutes() {
+	if r.Logger == nil {
+		return
+	}
+	for _, route := range r.Router.Routes() {
+		r.Logger.Info("route registered",
+			zap.String("method", route.Method),
+			zap.String("path", route.Path),
+			zap.String("handler", route.Handler),
+		)
+	}
+}
+
+// drain keeps serving requests for DrainDelay while reporting not ready, giving load
+// balancers time to stop routing requests to this instance before it shuts down. A
+// SIGINT or SIGTERM received meanwhile, like a second one after the signal stopping
+// the app, cuts the drain short.
+func (r *Rebar) drain() {
+	if r.DrainDelay <= 0 {
+		return
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	timer := time.NewTimer(r.DrainDelay)
+	defer timer.Stop()
+
+	r.setPhase(PhaseDraining)
+	start := time.Now()
+	before := atomic.LoadUint64(&r.served)
+	select {
+	case <-timer.C:
+	case s := <-sig:
+		r.emit(Event{Type: EventSignalReceived, Message: "system signal received, drain cut short", Signal: s})
+	}
+	r.emit(Event{
+		Type:     EventDrainCompleted,
+		Message:  "drain completed",
+		Duration: time.Since(start),
+		Requests: atomic.LoadUint64(&r.served) - before,
+	})
+}
+
+// countRequests counts the requests served by handler, to report on draining
+func (r *Rebar) countRequests(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		handler.ServeHTTP(w, req)
+		atomic.AddUint64(&r.served, 1)
+	})
+}
+
+func (r *Rebar) shutdownAdmin() {
+	ctx, cancel := context.WithTimeout(context.Background(), r.ShutdownWait)
+	defer cancel()
+	if err := r.AdminServer.Shutdown(ctx); err != nil {
+		r.emit(Event{Type: EventServerError, Message: "unable to shutdown admin server", Err: err})
+	}
 }
 
 func (r *Rebar) Run() error {
-	return r.RunWithContext(ContextWithCancel())
+	ctx, stop := context.WithCancel(context.Background())
+	cancelOnSignal(stop, func(s os.Signal) {
+		r.emit(Event{Type: EventSignalReceived, Message: "system signal received", Signal: s})
+	})
+	return r.RunWithContext(ctx, stop)
 }
 
+// ContextWithCancel returns a context canceled on SIGINT or SIGTERM. The signal is
+// logged with the standard logger, Run logs it through Options.Logger instead.
 func ContextWithCancel() (context.Context, context.CancelFunc) {
 	ctx, stop := context.WithCancel(context.Background())
 	CancelOnSignal(stop)
 	return ctx, stop
 }
 
+// CancelOnSignal calls stop on SIGINT or SIGTERM. The signal is logged with the
+// standard logger.
 func CancelOnSignal(stop context.CancelFunc) {
+	cancelOnSignal(stop, func(s os.Signal) {
+		logger, err := NewStandardLogger()
+		if err != nil {
+			return
+		}
+		logEvent(logger, Event{Type: EventSignalReceived, Message: "system signal received", Signal: s})
+	})
+}
+
+func cancelOnSignal(stop context.CancelFunc, received func(os.Signal)) {
 	// wait for interrupt signal to gracefully shutdown the server with a timeout
 	sig := make(chan os.Signal, 1)
 	// kill (no param) default send syscall.SIGTERM
@@ -118,7 +426,7 @@ func CancelOnSignal(stop context.CancelFunc) {
 	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		s := <-sig
-		log.Printf("[rebar] system signal received: %+v", s)
+		received(s)
 		stop()
 	}()
 }
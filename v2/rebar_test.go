@@ -3,15 +3,22 @@ package rebar_test
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"os"
 	"sync"
 	"syscall"
 	"testing"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/masonhubco/rebar/v2"
+	"github.com/masonhubco/rebar/v2/rebartest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
 )
 
 type mockProcessor struct {
@@ -79,6 +86,7 @@ func Test_Rebar_RunWithContext(t *testing.T) {
 			t.Parallel()
 
 			r := rebar.New(tc.givenOptions)
+			r.Server.Addr = "127.0.0.1:0"
 			if tc.mockProcessor != nil {
 				r.AddProcessor(tc.mockProcessor)
 			}
@@ -105,6 +113,8 @@ func Test_Rebar_New(t *testing.T) {
 		wantEnvironment   string
 		wantServerAddr    string
 		wantShutdownWait  time.Duration
+		wantStopBudget    time.Duration
+		wantUpgrade       time.Duration
 		wantWriteTimeout  time.Duration
 		wantReadTimeout   time.Duration
 		wantIdleTimeout   time.Duration
@@ -116,6 +126,8 @@ func Test_Rebar_New(t *testing.T) {
 			wantEnvironment:   "development",
 			wantServerAddr:    "0.0.0.0:3000",
 			wantShutdownWait:  30 * time.Second,
+			wantStopBudget:    30 * time.Second,
+			wantUpgrade:       time.Minute,
 			wantWriteTimeout:  15 * time.Second,
 			wantReadTimeout:   15 * time.Second,
 			wantIdleTimeout:   60 * time.Second,
@@ -131,10 +143,13 @@ func Test_Rebar_New(t *testing.T) {
 				IdleTimeout:                 120 * time.Second,
 				ShutDownWait:                60 * time.Second,
 				StopOnProcessorStartFailure: true,
+				UpgradeTimeout:              10 * time.Second,
 			},
 			wantEnvironment:   "test",
 			wantServerAddr:    "0.0.0.0:3310",
 			wantShutdownWait:  60 * time.Second,
+			wantStopBudget:    60 * time.Second,
+			wantUpgrade:       10 * time.Second,
 			wantWriteTimeout:  35 * time.Second,
 			wantReadTimeout:   30 * time.Second,
 			wantIdleTimeout:   120 * time.Second,
@@ -151,6 +166,8 @@ func Test_Rebar_New(t *testing.T) {
 			assert.Equal(t, tc.wantEnvironment, r.Environment)
 			assert.Equal(t, tc.wantServerAddr, r.Server.Addr)
 			assert.Equal(t, tc.wantShutdownWait, r.ShutdownWait)
+			assert.Equal(t, tc.wantStopBudget, r.ProcessorShutdownBudget)
+			assert.Equal(t, tc.wantUpgrade, r.UpgradeTimeout)
 			assert.Equal(t, tc.wantWriteTimeout, r.Server.WriteTimeout)
 			assert.Equal(t, tc.wantReadTimeout, r.Server.ReadTimeout)
 			assert.Equal(t, tc.wantIdleTimeout, r.Server.IdleTimeout)
@@ -160,8 +177,72 @@ func Test_Rebar_New(t *testing.T) {
 	}
 }
 
+func Test_NewValidated(t *testing.T) {
+	t.Parallel()
+
+	r, err := rebar.NewValidated(rebar.Options{Environment: rebar.Test, Port: "3310"})
+	require.NoError(t, err)
+	assert.Equal(t, "0.0.0.0:3310", r.Server.Addr)
+	assert.NotNil(t, r.Logger)
+
+	r, err = rebar.NewValidated(rebar.Options{Environment: "prod", Port: "-1", IdleTimeout: -time.Second})
+	assert.Nil(t, r)
+	var invalid *rebar.OptionsError
+	require.True(t, errors.As(err, &invalid))
+	assert.Len(t, invalid.Errs, 3)
+}
+
+func Test_Rebar_Mode(t *testing.T) {
+	t.Parallel()
+
+	ginMode := gin.Mode()
+	run := func(environment string) *rebartest.App {
+		app := rebartest.New(t, rebartest.Options{Options: rebar.Options{Environment: environment}, InMemory: true})
+		app.Router.GET("/env", func(c *gin.Context) {
+			c.String(http.StatusOK, environment)
+		})
+		return app.Start()
+	}
+	development := run(rebar.Development)
+	production := run(rebar.Production)
+
+	// both apps run side by side, each in its own mode
+	assert.Equal(t, gin.DebugMode, development.Mode)
+	assert.True(t, development.IsDebugging())
+	assert.Equal(t, gin.ReleaseMode, production.Mode)
+	assert.False(t, production.IsDebugging())
+	// and Gin's global mode is left alone
+	assert.Equal(t, ginMode, gin.Mode())
+	for _, app := range []*rebartest.App{development, production} {
+		resp, err := app.Client.Get("/env")
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, app.Environment, string(body))
+	}
+
+	// routes are only listed by the development app
+	assert.Equal(t, 1, development.Logs.FilterMessage("route registered").FilterField(zap.String("path", "/env")).Len())
+	assert.Zero(t, production.Logs.FilterMessage("route registered").Len())
+}
+
+// Test_Rebar_GinModeUntouched is not parallel, as it changes gin's global mode
+func Test_Rebar_GinModeUntouched(t *testing.T) {
+	defer gin.SetMode(gin.Mode())
+
+	for _, mode := range []string{gin.DebugMode, gin.ReleaseMode, gin.TestMode} {
+		gin.SetMode(mode)
+		for _, environment := range []string{rebar.Development, rebar.Test, rebar.Production} {
+			app := rebar.New(rebar.Options{Environment: environment, Logger: zap.NewNop()})
+			assert.Equal(t, mode, gin.Mode(), environment)
+			assert.Equal(t, environment == rebar.Development, app.IsDebugging(), environment)
+		}
+	}
+}
+
 func Test_Rebar_Run(t *testing.T) {
 	r := rebar.New(rebar.Options{})
+	r.Server.Addr = "127.0.0.1:0"
 	go func() {
 		// wait for 100 millisecond and then send an interrupt signal
 		// to the current process, and it should trigger rebar's Run()
@@ -174,3 +255,105 @@ func Test_Rebar_Run(t *testing.T) {
 	}()
 	r.Run()
 }
+
+// Test_Rebar_Drain_SecondSignal is not parallel, as it signals the process
+func Test_Rebar_Drain_SecondSignal(t *testing.T) {
+	var mu sync.Mutex
+	var drained []rebar.Event
+	r := rebar.New(rebar.Options{Port: freePort(t), DrainDelay: time.Minute, ShutDownWait: time.Second,
+		OnEvent: func(e rebar.Event) {
+			if e.Type == rebar.EventDrainCompleted {
+				mu.Lock()
+				defer mu.Unlock()
+				drained = append(drained, e)
+			}
+		}})
+	done := make(chan error, 1)
+	go func() {
+		done <- r.Run()
+	}()
+	require.Eventually(t, func() bool { return r.Phase() == rebar.PhaseRunning },
+		2*time.Second, 10*time.Millisecond)
+
+	p, err := os.FindProcess(syscall.Getpid())
+	require.NoError(t, err)
+	require.NoError(t, p.Signal(os.Interrupt))
+	require.Eventually(t, func() bool { return r.Phase() == rebar.PhaseDraining },
+		time.Second, time.Millisecond)
+	require.NoError(t, p.Signal(os.Interrupt))
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the second signal didn't cut the drain short")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, drained, 1)
+	assert.Less(t, int64(drained[0].Duration), int64(time.Minute))
+}
+
+func Test_Rebar_Drain(t *testing.T) {
+	t.Parallel()
+
+	port := freePort(t)
+	r := rebar.New(rebar.Options{Port: port, DrainDelay: 300 * time.Millisecond, ShutDownWait: time.Second,
+		Health: rebar.HealthOptions{OnRouter: true}})
+	r.Server.Addr = "127.0.0.1:" + port
+	assert.Equal(t, 300*time.Millisecond, r.DrainDelay)
+	r.Router.GET("/ping", func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	})
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	get := func(path string) int {
+		resp, err := client.Get(fmt.Sprintf("http://127.0.0.1:%s%s", port, path))
+		if err != nil {
+			return 0
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- r.RunWithContext(ctx, stop)
+	}()
+	require.Eventually(t, func() bool { return get("/readyz") == http.StatusOK },
+		2*time.Second, 10*time.Millisecond)
+
+	stop()
+	shutdownStart := time.Now()
+	require.Eventually(t, func() bool { return r.Phase() == rebar.PhaseDraining },
+		time.Second, time.Millisecond)
+	// not ready anymore, but still serving
+	assert.Equal(t, http.StatusServiceUnavailable, get("/readyz"))
+	assert.Equal(t, http.StatusOK, get("/ping"))
+
+	require.NoError(t, <-done)
+	assert.GreaterOrEqual(t, int64(time.Since(shutdownStart)), int64(300*time.Millisecond))
+	assert.Equal(t, 0, get("/ping"))
+}
+
+func Test_Rebar_ListenError(t *testing.T) {
+	t.Parallel()
+
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer busy.Close()
+
+	started := &mockProcessor{}
+	r := rebar.New(rebar.Options{DrainDelay: time.Minute, ShutDownWait: time.Second})
+	r.Server.Addr = busy.Addr().String()
+	r.AddProcessor(started)
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	// the error is returned at once, without starting processors nor draining
+	err = r.RunWithContext(ctx, stop)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "address already in use")
+	assert.Zero(t, started.starts)
+	assert.Equal(t, rebar.PhaseStopped, r.Phase())
+}
@@ -0,0 +1,60 @@
+package rebartest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+)
+
+// memoryListener is a listener whose connections are in-memory pipes, dialed by the
+// client of the app
+type memoryListener struct {
+	conns     chan net.Conn
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newMemoryListener() *memoryListener {
+	return &memoryListener{
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+}
+
+func (l *memoryListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *memoryListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *memoryListener) Addr() net.Addr {
+	return memoryAddr{}
+}
+
+// DialContext connects to the listener, for http.Transport
+func (l *memoryListener) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	server, client := net.Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.closed:
+		return nil, errors.New("rebartest: connection refused, the app is stopped")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type memoryAddr struct{}
+
+func (memoryAddr) Network() string { return "memory" }
+
+func (memoryAddr) String() string { return "rebartest" }
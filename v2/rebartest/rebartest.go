@@ -0,0 +1,251 @@
+// Package rebartest runs a rebar app in-process for integration tests. The app is
+// served on an ephemeral port, or fully in-memory, and stopped when the test ends.
+//
+//	app := rebartest.New(t, rebartest.Options{SystemToken: "token"})
+//	app.Router.Use(middleware.BasicJWT("token"))
+//	app.Router.GET("/ping", ping)
+//	app.Start()
+//
+//	resp, err := app.Client.Get("/ping")
+package rebartest
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/masonhubco/rebar/v2"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// Options configures a test app
+type Options struct {
+	// Options are the options of the app. Environment defaults to test, and Logger
+	// to a logger capturing every entry in App.Logs. Port and Listeners are ignored.
+	rebar.Options
+	// SystemToken is optional. When it's set, the client sends it as a bearer token
+	// with every request.
+	SystemToken string
+	// InMemory serves the app without any network listener. The client connects to
+	// the server through in-memory pipes.
+	InMemory bool
+	// ReadyTimeout defaults to 5 seconds. It's how long Start waits for the app to
+	// be ready.
+	ReadyTimeout time.Duration
+}
+
+func (o Options) valuesOrDefaults() Options {
+	if o.Environment == "" {
+		o.Environment = rebar.Test
+	}
+	if o.ReadyTimeout == 0 {
+		o.ReadyTimeout = 5 * time.Second
+	}
+	return o
+}
+
+// App is a rebar app under test
+type App struct {
+	*rebar.Rebar
+	// Logs holds every entry written by the app logger, when Options.Logger is not set
+	Logs *observer.ObservedLogs
+	// Client sends requests to the app, once it's started
+	Client *Client
+
+	t       testing.TB
+	opts    Options
+	started bool
+
+	mu         sync.Mutex
+	running    map[string]bool
+	stopErrors map[string]error
+}
+
+// New creates the app, for routes and processors to be added before it's started.
+func New(t testing.TB, opts Options) *App {
+	t.Helper()
+	opts = opts.valuesOrDefaults()
+	a := &App{
+		t:          t,
+		opts:       opts,
+		running:    map[string]bool{},
+		stopErrors: map[string]error{},
+	}
+	if opts.Logger == nil {
+		// everything is captured unless the test changes the level
+		if opts.LogLevel == nil {
+			level := zap.NewAtomicLevelAt(zapcore.DebugLevel)
+			opts.LogLevel = &level
+		}
+		var core zapcore.Core
+		core, a.Logs = observer.New(opts.LogLevel)
+		opts.Logger = zap.New(core)
+	}
+	onEvent := opts.OnEvent
+	opts.OnEvent = func(e rebar.Event) {
+		a.track(e)
+		if onEvent != nil {
+			onEvent(e)
+		}
+	}
+	a.Rebar = rebar.New(opts.Options)
+	return a
+}
+
+// Start runs the app and waits until it's ready: all processors are started and
+// every readiness check passes. The test fails when the app doesn't get ready
+// within Options.ReadyTimeout. The app is stopped when the test ends.
+func (a *App) Start() *App {
+	a.t.Helper()
+	if a.started {
+		a.t.Fatal("rebartest: app already started")
+	}
+	a.started = true
+
+	var listener net.Listener
+	transport := &http.Transport{}
+	baseURL := "http://rebartest"
+	if a.opts.InMemory {
+		memory := newMemoryListener()
+		listener = memory
+		transport.DialContext = memory.DialContext
+	} else {
+		var err error
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			a.t.Fatalf("rebartest: unable to listen: %s", err)
+		}
+		baseURL = "http://" + listener.Addr().String()
+	}
+	if a.opts.TLS != nil {
+		baseURL = strings.Replace(baseURL, "http://", "https://", 1)
+		// test certificates are rarely signed by a trusted CA
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} // nolint:gosec
+	}
+	a.Client = &Client{
+		Client:      &http.Client{Transport: transport},
+		BaseURL:     baseURL,
+		SystemToken: a.opts.SystemToken,
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- a.RunWithListeners(ctx, stop, listener)
+	}()
+	a.t.Cleanup(func() {
+		a.stop(stop, done)
+		transport.CloseIdleConnections()
+	})
+
+	deadline := time.Now().Add(a.opts.ReadyTimeout)
+	for !a.ready(ctx) {
+		select {
+		case err := <-done:
+			done <- err
+			a.t.Fatalf("rebartest: app stopped before being ready: %v", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			a.t.Fatalf("rebartest: app not ready after %s, in phase %s", a.opts.ReadyTimeout, a.Phase())
+		}
+	}
+	return a
+}
+
+func (a *App) ready(ctx context.Context) bool {
+	if a.Phase() != rebar.PhaseRunning {
+		return false
+	}
+	_, healthy := a.Health.Run(ctx, false)
+	return healthy
+}
+
+// stop shuts the app down and fails the test when processors were not stopped
+func (a *App) stop(stop context.CancelFunc, done chan error) {
+	stop()
+	timeout := a.DrainDelay + a.ProcessorShutdownBudget + a.ShutdownWait + time.Second
+	select {
+	case err := <-done:
+		if err != nil {
+			a.t.Errorf("rebartest: app shutdown failed: %s", err)
+		}
+	case <-time.After(timeout):
+		a.t.Errorf("rebartest: app still running %s after shutdown began", timeout)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for name := range a.running {
+		if err, failed := a.stopErrors[name]; failed {
+			a.t.Errorf("rebartest: processor %s leaked, it failed to stop: %s", name, err)
+		} else {
+			a.t.Errorf("rebartest: processor %s leaked, it was not stopped", name)
+		}
+	}
+}
+
+// track keeps the processors that are running, to report the ones left running
+func (a *App) track(e rebar.Event) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch e.Type {
+	case rebar.EventProcessorStarted:
+		a.running[e.Processor] = true
+		delete(a.stopErrors, e.Processor)
+	case rebar.EventProcessorStopped:
+		delete(a.running, e.Processor)
+	case rebar.EventProcessorStopFailed:
+		a.stopErrors[e.Processor] = e.Err
+	}
+}
+
+// Client is an HTTP client sending requests to the app under test
+type Client struct {
+	*http.Client
+	// BaseURL is prepended to the paths of requests
+	BaseURL string
+	// SystemToken is sent as a bearer token when it's set
+	SystemToken string
+}
+
+// NewRequest creates a request for path, authenticated with the system token
+func (c *Client) NewRequest(method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, c.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.SystemToken != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.SystemToken))
+	}
+	return req, nil
+}
+
+// Get sends a GET request for path
+func (c *Client) Get(path string) (*http.Response, error) {
+	req, err := c.NewRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+// Post sends a POST request for path, with body of contentType
+func (c *Client) Post(path, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := c.NewRequest(http.MethodPost, path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return c.Do(req)
+}
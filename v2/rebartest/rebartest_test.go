@@ -0,0 +1,131 @@
+package rebartest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/masonhubco/rebar/v2"
+	"github.com/masonhubco/rebar/v2/middleware"
+	"github.com/masonhubco/rebar/v2/rebartest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func Test_App(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		inMemory bool
+	}{
+		{name: "ephemeral port", inMemory: false},
+		{name: "in-memory", inMemory: true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			app := rebartest.New(t, rebartest.Options{SystemToken: "secret", InMemory: tc.inMemory})
+			app.Router.Use(middleware.BasicJWT("secret"))
+			app.Router.GET("/ping", func(c *gin.Context) {
+				c.String(http.StatusOK, "pong")
+			})
+			app.Router.POST("/echo", func(c *gin.Context) {
+				body, _ := io.ReadAll(c.Request.Body)
+				c.String(http.StatusOK, "%s %s", c.ContentType(), body)
+			})
+			app.Start()
+			assert.Equal(t, rebar.PhaseRunning, app.Phase())
+			assert.Equal(t, tc.inMemory, app.Client.BaseURL == "http://rebartest")
+
+			resp, err := app.Client.Get("/ping")
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, "pong", string(body))
+
+			resp, err = app.Client.Post("/echo", "text/plain", strings.NewReader("hello"))
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, _ = io.ReadAll(resp.Body)
+			assert.Equal(t, "text/plain hello", string(body))
+
+			// the rebar lifecycle is captured
+			assert.NotZero(t, app.Logs.FilterField(zap.String("event", string(rebar.EventPhaseChanged))).Len())
+		})
+	}
+}
+
+func Test_App_WaitsForReadiness(t *testing.T) {
+	t.Parallel()
+
+	app := rebartest.New(t, rebartest.Options{InMemory: true})
+	var mu sync.Mutex
+	checks := 0
+	app.Health.Register("warming", func(context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		checks++
+		if checks < 3 {
+			return errors.New("warming up")
+		}
+		return nil
+	}, rebar.HealthCheckOptions{CacheTTL: -1})
+	app.Start()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 3, checks)
+}
+
+type processor struct {
+	stopErr error
+}
+
+func (p *processor) Start(ctx context.Context) error { return nil }
+
+func (p *processor) Stop(ctx context.Context) error { return p.stopErr }
+
+// recordingT records the failures of cleanup functions, to check the harness
+// reports leaked processors
+type recordingT struct {
+	testing.TB
+	cleanups []func()
+	errors   []string
+}
+
+func (t *recordingT) Cleanup(fn func()) { t.cleanups = append(t.cleanups, fn) }
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func (t *recordingT) cleanup() {
+	for i := len(t.cleanups) - 1; i >= 0; i-- {
+		t.cleanups[i]()
+	}
+}
+
+func Test_App_ReportsLeakedProcessors(t *testing.T) {
+	t.Parallel()
+
+	rt := &recordingT{TB: t}
+	app := rebartest.New(rt, rebartest.Options{InMemory: true})
+	app.AddLifecycleProcessor(&processor{}, rebar.WithName("clean"))
+	app.AddLifecycleProcessor(&processor{stopErr: errors.New("stuck")}, rebar.WithName("leaky"))
+	app.Start()
+	rt.cleanup()
+
+	assert.Equal(t, []string{"rebartest: processor leaky leaked, it failed to stop: stuck"}, rt.errors)
+}
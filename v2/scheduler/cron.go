@@ -0,0 +1,236 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule gives the times a job runs at
+type Schedule interface {
+	// Next returns the first run time strictly after t, or the zero time when
+	// there is none.
+	Next(t time.Time) time.Time
+}
+
+// Every returns a schedule running every interval, which must be positive
+func Every(interval time.Duration) Schedule {
+	return every(interval)
+}
+
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// cronSchedule is a parsed cron expression, each field being a bit set of the
+// allowed values
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny are true when the field starts with *, like */2, as a
+	// restricted day of month and day of week match either one of them otherwise,
+	// like in Vixie cron
+	domAny, dowAny bool
+	location       *time.Location
+}
+
+type cronField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = cronField{name: "minute", min: 0, max: 59}
+	hourField   = cronField{name: "hour", min: 0, max: 23}
+	domField    = cronField{name: "day of month", min: 1, max: 31}
+	monthField  = cronField{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 7 is also Sunday
+	dowField = cronField{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Cron parses a standard cron expression: minute, hour, day of month, month and day
+// of week, with *, ranges (1-5), steps (*/15) and lists (1,15). Months and days of
+// week can be named (JAN, MON). The descriptors @yearly, @monthly, @weekly, @daily,
+// @hourly and @every <duration> are supported too. Times are in UTC, unless the
+// expression starts with CRON_TZ=<location>, like CRON_TZ=Europe/Paris 0 9 * * MON-FRI.
+func Cron(expr string) (Schedule, error) {
+	spec := strings.TrimSpace(expr)
+	location := time.UTC
+	if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+		i := strings.IndexAny(spec, " \t")
+		if i < 0 {
+			return nil, fmt.Errorf("cron %q: missing fields after the time zone", expr)
+		}
+		name := spec[strings.Index(spec, "=")+1 : i]
+		var err error
+		if location, err = time.LoadLocation(name); err != nil {
+			return nil, fmt.Errorf("cron %q: %w", expr, err)
+		}
+		spec = strings.TrimSpace(spec[i:])
+	}
+
+	if strings.HasPrefix(spec, "@every ") {
+		interval, err := time.ParseDuration(strings.TrimSpace(spec[len("@every "):]))
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("cron %q: invalid interval", expr)
+		}
+		return Every(interval), nil
+	}
+	if descriptor, ok := descriptors[spec]; ok {
+		spec = descriptor
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron %q: expected 5 fields, got %d", expr, len(fields))
+	}
+	s := &cronSchedule{
+		location: location,
+		domAny:   strings.HasPrefix(fields[2], "*") || fields[2] == "?",
+		dowAny:   strings.HasPrefix(fields[4], "*") || fields[4] == "?",
+	}
+	var err error
+	for i, target := range []struct {
+		field cronField
+		bits  *uint64
+	}{
+		{minuteField, &s.minute},
+		{hourField, &s.hour},
+		{domField, &s.dom},
+		{monthField, &s.month},
+		{dowField, &s.dow},
+	} {
+		if *target.bits, err = target.field.parse(fields[i]); err != nil {
+			return nil, fmt.Errorf("cron %q: %w", expr, err)
+		}
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+// MustCron is like Cron but panics when the expression is invalid
+func MustCron(expr string) Schedule {
+	s, err := Cron(expr)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func (f cronField) parse(field string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rangePart = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %s field %q", f.name, part)
+			}
+		}
+
+		var low, high int
+		switch {
+		case rangePart == "*" || rangePart == "?":
+			low, high = f.min, f.max
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if low, err = f.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			if high, err = f.value(bounds[1]); err != nil {
+				return 0, err
+			}
+		default:
+			var err error
+			if low, err = f.value(rangePart); err != nil {
+				return 0, err
+			}
+			high = low
+			if step > 1 {
+				// 5/15 is 5-max/15
+				high = f.max
+			}
+		}
+		if low > high {
+			return 0, fmt.Errorf("invalid range in %s field %q", f.name, part)
+		}
+		for v := low; v <= high; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s %q, expected %d to %d", f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Next finds the next matching minute, skipping whole months, days and hours that
+// don't match
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	original := t.Location()
+	t = t.In(s.location).Truncate(time.Minute).Add(time.Minute)
+	// the expression may never match, like February 30
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.location)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.location)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			// adding minutes rather than calling time.Date, which can go back an hour
+			// when the next one is skipped for daylight saving time
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t.In(original)
+	}
+	return time.Time{}
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
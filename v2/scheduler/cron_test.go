@@ -0,0 +1,179 @@
+package scheduler_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/masonhubco/rebar/v2/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Cron_Next(t *testing.T) {
+	t.Parallel()
+
+	// a Wednesday
+	from := time.Date(2024, time.January, 10, 10, 30, 15, 0, time.UTC)
+	tests := []struct {
+		name string
+		expr string
+		want []time.Time
+	}{
+		{
+			name: "every minute",
+			expr: "* * * * *",
+			want: []time.Time{
+				time.Date(2024, time.January, 10, 10, 31, 0, 0, time.UTC),
+				time.Date(2024, time.January, 10, 10, 32, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "steps",
+			expr: "*/20 * * * *",
+			want: []time.Time{
+				time.Date(2024, time.January, 10, 10, 40, 0, 0, time.UTC),
+				time.Date(2024, time.January, 10, 11, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "lists and ranges",
+			expr: "0 9,17 * * MON-FRI",
+			want: []time.Time{
+				time.Date(2024, time.January, 10, 17, 0, 0, 0, time.UTC),
+				time.Date(2024, time.January, 11, 9, 0, 0, 0, time.UTC),
+				time.Date(2024, time.January, 11, 17, 0, 0, 0, time.UTC),
+				time.Date(2024, time.January, 12, 9, 0, 0, 0, time.UTC),
+				time.Date(2024, time.January, 12, 17, 0, 0, 0, time.UTC),
+				time.Date(2024, time.January, 15, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "sunday as 7",
+			expr: "0 0 * * 7",
+			want: []time.Time{time.Date(2024, time.January, 14, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name: "day of month or day of week",
+			expr: "0 0 1 * FRI",
+			want: []time.Time{
+				time.Date(2024, time.January, 12, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, time.January, 19, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, time.January, 26, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "step of day of month and day of week",
+			expr: "0 0 */1 * FRI",
+			want: []time.Time{
+				time.Date(2024, time.January, 12, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, time.January, 19, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "day of month and step of day of week",
+			expr: "0 0 1 * */2",
+			want: []time.Time{
+				time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "range of day of month or day of week",
+			expr: "0 0 1-31 * FRI",
+			want: []time.Time{
+				time.Date(2024, time.January, 11, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, time.January, 12, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "leap day",
+			expr: "0 12 29 feb *",
+			want: []time.Time{
+				time.Date(2024, time.February, 29, 12, 0, 0, 0, time.UTC),
+				time.Date(2028, time.February, 29, 12, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "descriptor",
+			expr: "@monthly",
+			want: []time.Time{time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name: "every",
+			expr: "@every 90s",
+			want: []time.Time{
+				time.Date(2024, time.January, 10, 10, 31, 45, 0, time.UTC),
+				time.Date(2024, time.January, 10, 10, 33, 15, 0, time.UTC),
+			},
+		},
+		{
+			name: "time zone",
+			expr: "CRON_TZ=America/New_York 0 9 * * *",
+			want: []time.Time{
+				time.Date(2024, time.January, 10, 14, 0, 0, 0, time.UTC),
+				time.Date(2024, time.January, 11, 14, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "never",
+			expr: "0 0 30 2 *",
+			want: []time.Time{{}},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			schedule, err := scheduler.Cron(tc.expr)
+			require.NoError(t, err)
+			next := from
+			for _, want := range tc.want {
+				next = schedule.Next(next)
+				assert.True(t, want.Equal(next), "want %s, got %s", want, next)
+			}
+		})
+	}
+}
+
+func Test_Cron_DaylightSaving(t *testing.T) {
+	t.Parallel()
+
+	schedule := scheduler.MustCron("CRON_TZ=America/New_York 30 2 * * *")
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	// 2:30 doesn't exist on March 10th 2024, clocks jump from 2:00 to 3:00
+	next := schedule.Next(time.Date(2024, time.March, 9, 12, 0, 0, 0, newYork))
+	assert.Equal(t, time.Date(2024, time.March, 11, 2, 30, 0, 0, newYork), next.In(newYork))
+}
+
+func Test_Cron_Invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{expr: "* * * *", wantErr: `cron "* * * *": expected 5 fields, got 4`},
+		{expr: "60 * * * *", wantErr: `cron "60 * * * *": invalid minute "60", expected 0 to 59`},
+		{expr: "* * * * MON-SUNDAY", wantErr: `cron "* * * * MON-SUNDAY": invalid day of week "SUNDAY", expected 0 to 7`},
+		{expr: "*/0 * * * *", wantErr: `cron "*/0 * * * *": invalid step in minute field "*/0"`},
+		{expr: "5-1 * * * *", wantErr: `cron "5-1 * * * *": invalid range in minute field "5-1"`},
+		{expr: "@every soon", wantErr: `cron "@every soon": invalid interval`},
+		{expr: "CRON_TZ=Mars/Olympus 0 0 * * *", wantErr: `cron "CRON_TZ=Mars/Olympus 0 0 * * *": unknown time zone Mars/Olympus`},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.expr, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := scheduler.Cron(tc.expr)
+			assert.EqualError(t, err, tc.wantErr)
+		})
+	}
+	assert.Panics(t, func() { scheduler.MustCron("invalid") })
+}
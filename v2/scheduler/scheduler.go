@@ -0,0 +1,201 @@
+// Package scheduler runs jobs on cron schedules or fixed intervals, as a rebar
+// processor.
+//
+//	s := scheduler.New(scheduler.Options{Logger: logger})
+//	s.Add("cleanup", scheduler.MustCron("CRON_TZ=America/New_York 0 3 * * *"), cleanup,
+//		scheduler.JobOptions{Timeout: 10 * time.Minute})
+//	s.Add("refresh", scheduler.Every(time.Minute), refresh,
+//		scheduler.JobOptions{Jitter: 10 * time.Second})
+//	app.AddLifecycleProcessor(s, rebar.WithName("scheduler"))
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/masonhubco/rebar/v2"
+	"go.uber.org/zap"
+)
+
+// Job is the work run on schedule. ctx is canceled when the run times out, or when
+// the scheduler gives up waiting for it to stop.
+type Job func(ctx context.Context) error
+
+// JobOptions configures a scheduled job
+type JobOptions struct {
+	// Timeout is optional. The context of a run is canceled once it's reached.
+	Timeout time.Duration
+	// Jitter is optional. Each run is delayed by a random duration up to Jitter, so
+	// that instances sharing a schedule don't all run at once.
+	Jitter time.Duration
+}
+
+// Options configures a Scheduler
+type Options struct {
+	// Logger defaults to the standard logger. Every run is logged with the job name
+	// and duration.
+	Logger rebar.Logger
+}
+
+var (
+	// ErrDuplicateJob is returned when adding a job whose name is already used
+	ErrDuplicateJob = errors.New("scheduler: duplicate job name")
+	// ErrInvalidInterval is returned when adding a job running Every interval that's
+	// not positive
+	ErrInvalidInterval = errors.New("scheduler: interval must be positive")
+)
+
+// Scheduler is a rebar.LifecycleProcessor running jobs on their schedule. A job never
+// overlaps itself: runs missed while it's still running are skipped.
+type Scheduler struct {
+	logger rebar.Logger
+
+	mu      sync.Mutex
+	jobs    []*job
+	started bool
+	quit    chan struct{}
+	// runCtx is the parent context of runs, canceled when Stop stops waiting
+	runCtx    context.Context
+	cancelRun context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+type job struct {
+	name     string
+	schedule Schedule
+	run      Job
+	opts     JobOptions
+}
+
+// New creates a scheduler without any job
+func New(opts Options) *Scheduler {
+	logger := opts.Logger
+	if logger == nil {
+		logger, _ = rebar.NewStandardLogger()
+	}
+	return &Scheduler{logger: logger}
+}
+
+// Add registers a job under a unique name. Jobs added once the scheduler is started
+// are scheduled right away.
+func (s *Scheduler) Add(name string, schedule Schedule, run Job, opts JobOptions) error {
+	if interval, ok := schedule.(every); ok && interval <= 0 {
+		return fmt.Errorf("%w: %s every %s", ErrInvalidInterval, name, time.Duration(interval))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.jobs {
+		if j.name == name {
+			return fmt.Errorf("%w: %s", ErrDuplicateJob, name)
+		}
+	}
+	j := &job{name: name, schedule: schedule, run: run, opts: opts}
+	s.jobs = append(s.jobs, j)
+	if s.started {
+		s.wg.Add(1)
+		go s.loop(j, s.quit)
+	}
+	return nil
+}
+
+// Start schedules the registered jobs
+func (s *Scheduler) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return errors.New("scheduler: already started")
+	}
+	s.started = true
+	s.quit = make(chan struct{})
+	s.runCtx, s.cancelRun = context.WithCancel(context.Background())
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(j, s.quit)
+	}
+	return nil
+}
+
+// Stop stops scheduling runs and waits for the runs in flight to finish. When ctx is
+// done first, their context is canceled and ctx's error is returned.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.started {
+		s.mu.Unlock()
+		return nil
+	}
+	s.started = false
+	close(s.quit)
+	cancelRun := s.cancelRun
+	s.mu.Unlock()
+	defer cancelRun()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("scheduler: runs still in flight: %w", ctx.Err())
+	}
+}
+
+// loop runs a job on its schedule until quit is closed
+func (s *Scheduler) loop(j *job, quit chan struct{}) {
+	defer s.wg.Done()
+	s.mu.Lock()
+	runCtx := s.runCtx
+	s.mu.Unlock()
+
+	next := j.schedule.Next(time.Now())
+	for !next.IsZero() {
+		delay := time.Until(next)
+		if j.opts.Jitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(j.opts.Jitter)))
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-quit:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.runJob(runCtx, j)
+		// runs missed while the job was running are skipped
+		next = j.schedule.Next(time.Now())
+	}
+	s.logger.Warn("job has no more runs scheduled", zap.String("job", j.name))
+}
+
+// runJob runs the job once, recovering from panics
+func (s *Scheduler) runJob(ctx context.Context, j *job) {
+	if j.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, j.opts.Timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	logger := s.logger.With(zap.String("job", j.name))
+
+	err := func() (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = fmt.Errorf("panic: %v", p)
+				logger.Error("job panicked and recovered", zap.Any("panic", p), zap.Stack("stack"))
+			}
+		}()
+		return j.run(ctx)
+	}()
+	if err != nil {
+		logger.Error("job failed", zap.Error(err), zap.Duration("duration", time.Since(start)))
+		return
+	}
+	logger.Debug("job succeeded", zap.Duration("duration", time.Since(start)))
+}
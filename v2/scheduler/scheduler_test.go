@@ -0,0 +1,202 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/masonhubco/rebar/v2/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func newScheduler(t *testing.T) (*scheduler.Scheduler, *observer.ObservedLogs) {
+	t.Helper()
+	core, logs := observer.New(zapcore.DebugLevel)
+	s := scheduler.New(scheduler.Options{Logger: zap.New(core)})
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = s.Stop(ctx)
+	})
+	return s, logs
+}
+
+func Test_Scheduler_Runs(t *testing.T) {
+	t.Parallel()
+
+	s, logs := newScheduler(t)
+	var runs int32
+	require.NoError(t, s.Add("tick", scheduler.Every(10*time.Millisecond), func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}, scheduler.JobOptions{}))
+	require.NoError(t, s.Start(context.Background()))
+
+	// jobs added once started are scheduled too
+	var lateRuns int32
+	require.NoError(t, s.Add("late", scheduler.Every(10*time.Millisecond), func(ctx context.Context) error {
+		atomic.AddInt32(&lateRuns, 1)
+		return errors.New("boom")
+	}, scheduler.JobOptions{Jitter: 5 * time.Millisecond}))
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&runs) >= 3 && atomic.LoadInt32(&lateRuns) >= 3
+	}, time.Second, 5*time.Millisecond)
+	require.NoError(t, s.Stop(context.Background()))
+
+	succeeded := logs.FilterMessage("job succeeded").FilterField(zap.String("job", "tick"))
+	assert.GreaterOrEqual(t, succeeded.Len(), 3)
+	failed := logs.FilterMessage("job failed").FilterField(zap.String("job", "late"))
+	require.GreaterOrEqual(t, failed.Len(), 3)
+	assert.Equal(t, "boom", failed.All()[0].ContextMap()["error"])
+
+	// no run after Stop
+	stopped := atomic.LoadInt32(&runs)
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, stopped, atomic.LoadInt32(&runs))
+}
+
+func Test_Scheduler_NoOverlap(t *testing.T) {
+	t.Parallel()
+
+	s, _ := newScheduler(t)
+	var running, maxRunning, runs int32
+	require.NoError(t, s.Add("slow", scheduler.Every(time.Millisecond), func(ctx context.Context) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		atomic.AddInt32(&runs, 1)
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	}, scheduler.JobOptions{}))
+	require.NoError(t, s.Start(context.Background()))
+
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&runs) >= 3 }, time.Second, 5*time.Millisecond)
+	require.NoError(t, s.Stop(context.Background()))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&maxRunning))
+}
+
+func Test_Scheduler_Timeout(t *testing.T) {
+	t.Parallel()
+
+	s, logs := newScheduler(t)
+	require.NoError(t, s.Add("stuck", scheduler.Every(time.Millisecond), func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, scheduler.JobOptions{Timeout: 10 * time.Millisecond}))
+	require.NoError(t, s.Start(context.Background()))
+
+	assert.Eventually(t, func() bool {
+		return logs.FilterMessage("job failed").Len() > 0
+	}, time.Second, 5*time.Millisecond)
+	entry := logs.FilterMessage("job failed").All()[0]
+	assert.Equal(t, "context deadline exceeded", entry.ContextMap()["error"])
+	assert.GreaterOrEqual(t, entry.ContextMap()["duration"], 10*time.Millisecond)
+}
+
+func Test_Scheduler_Panic(t *testing.T) {
+	t.Parallel()
+
+	s, logs := newScheduler(t)
+	var runs int32
+	require.NoError(t, s.Add("panicky", scheduler.Every(time.Millisecond), func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		panic("nil map")
+	}, scheduler.JobOptions{}))
+	require.NoError(t, s.Start(context.Background()))
+
+	// the job keeps being scheduled after panicking
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&runs) >= 2 }, time.Second, 5*time.Millisecond)
+	require.NoError(t, s.Stop(context.Background()))
+
+	panics := logs.FilterMessage("job panicked and recovered").All()
+	require.NotEmpty(t, panics)
+	fields := panics[0].ContextMap()
+	assert.Equal(t, "panicky", fields["job"])
+	assert.Equal(t, "nil map", fields["panic"])
+	assert.Contains(t, fields["stack"], "scheduler_test.Test_Scheduler_Panic")
+	assert.Equal(t, "panic: nil map", logs.FilterMessage("job failed").All()[0].ContextMap()["error"])
+}
+
+func Test_Scheduler_Stop(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		runFor   time.Duration
+		stopWait time.Duration
+		wantErr  error
+	}{
+		{name: "waits for runs in flight", runFor: 20 * time.Millisecond, stopWait: time.Second},
+		{name: "gives up on runs in flight", runFor: time.Minute, stopWait: 20 * time.Millisecond, wantErr: context.DeadlineExceeded},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s, _ := newScheduler(t)
+			started := make(chan struct{})
+			var once sync.Once
+			var finished, canceled int32
+			require.NoError(t, s.Add("job", scheduler.Every(time.Millisecond), func(ctx context.Context) error {
+				once.Do(func() { close(started) })
+				select {
+				case <-time.After(tc.runFor):
+					atomic.StoreInt32(&finished, 1)
+				case <-ctx.Done():
+					atomic.StoreInt32(&canceled, 1)
+				}
+				return nil
+			}, scheduler.JobOptions{}))
+			require.NoError(t, s.Start(context.Background()))
+			<-started
+
+			ctx, cancel := context.WithTimeout(context.Background(), tc.stopWait)
+			defer cancel()
+			err := s.Stop(ctx)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				// the run is told to give up
+				assert.Eventually(t, func() bool { return atomic.LoadInt32(&canceled) == 1 }, time.Second, time.Millisecond)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, int32(1), atomic.LoadInt32(&finished))
+		})
+	}
+}
+
+func Test_Scheduler_Add(t *testing.T) {
+	t.Parallel()
+
+	s, _ := newScheduler(t)
+	noop := func(ctx context.Context) error { return nil }
+	require.NoError(t, s.Add("job", scheduler.Every(time.Hour), noop, scheduler.JobOptions{}))
+	err := s.Add("job", scheduler.Every(time.Hour), noop, scheduler.JobOptions{})
+	assert.ErrorIs(t, err, scheduler.ErrDuplicateJob)
+	assert.EqualError(t, err, "scheduler: duplicate job name: job")
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		err = s.Add("busy", scheduler.Every(interval), noop, scheduler.JobOptions{})
+		assert.ErrorIs(t, err, scheduler.ErrInvalidInterval)
+	}
+	assert.EqualError(t, s.Add("busy", scheduler.Every(0), noop, scheduler.JobOptions{}),
+		"scheduler: interval must be positive: busy every 0s")
+
+	require.NoError(t, s.Start(context.Background()))
+	assert.EqualError(t, s.Start(context.Background()), "scheduler: already started")
+}
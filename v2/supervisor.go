@@ -0,0 +1,283 @@
+package rebar
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// RestartPolicy tells rebar what to do when a processor reports that it exited after
+// Start returned.
+type RestartPolicy int
+
+const (
+	// RestartNever only logs the exit. It's the policy of processors attached without
+	// Supervise.
+	RestartNever RestartPolicy = iota
+	// RestartOnFailure restarts the processor when it exited with an error.
+	RestartOnFailure
+	// RestartAlways restarts the processor whenever it exited, even without an error.
+	RestartAlways
+)
+
+func (p RestartPolicy) String() string {
+	switch p {
+	case RestartOnFailure:
+		return "on-failure"
+	case RestartAlways:
+		return "always"
+	}
+	return "never"
+}
+
+// Supervision configures how a supervised processor is restarted.
+type Supervision struct {
+	// Policy decides whether an exited processor is restarted.
+	Policy RestartPolicy
+	// InitialBackoff defaults to 1 second. It's the delay before the first restart,
+	// and it doubles after every restart within Window.
+	InitialBackoff time.Duration
+	// MaxBackoff defaults to 1 minute. It caps the delay between two restarts.
+	MaxBackoff time.Duration
+	// Jitter defaults to 0.2. The restart delay is randomly spread by this fraction
+	// so that replicas don't restart in lockstep. A negative value, like NoJitter,
+	// disables it.
+	Jitter float64
+	// MaxRestarts defaults to 5. When the processor needs more restarts than this
+	// within Window, rebar gives up and cancels the app context.
+	MaxRestarts int
+	// Window defaults to 1 minute.
+	Window time.Duration
+}
+
+// NoJitter disables the jitter of restart delays
+const NoJitter = -1
+
+func (s Supervision) valuesOrDefaults() Supervision {
+	if s.InitialBackoff == 0 {
+		s.InitialBackoff = time.Second
+	}
+	if s.MaxBackoff == 0 {
+		s.MaxBackoff = time.Minute
+	}
+	if s.Jitter == 0 {
+		s.Jitter = 0.2
+	} else if s.Jitter < 0 {
+		s.Jitter = 0
+	}
+	if s.MaxRestarts == 0 {
+		s.MaxRestarts = 5
+	}
+	if s.Window == 0 {
+		s.Window = time.Minute
+	}
+	return s
+}
+
+// backoff returns the delay before the n-th restart within the window, n starting at 0
+func (s Supervision) backoff(n int) time.Duration {
+	d := float64(s.InitialBackoff) * math.Pow(2, float64(n))
+	if d > float64(s.MaxBackoff) {
+		d = float64(s.MaxBackoff)
+	}
+	d += d * s.Jitter * (2*rand.Float64() - 1)
+	return time.Duration(d)
+}
+
+// Supervise puts the processor under supervision. A supervised processor reports
+// that its background work exited with ReportExit, and rebar restarts it according
+// to the policy with exponential backoff. When it needs more than MaxRestarts
+// restarts within Window, rebar cancels the app context given to RunWithContext.
+func Supervise(s Supervision) ProcessorOption {
+	return func(e *processorEntry) {
+		e.supervision = s.valuesOrDefaults()
+	}
+}
+
+type exitReporterKey struct{}
+
+type exitReporter struct {
+	r   *Rebar
+	e   *processorEntry
+	run int
+}
+
+// ReportExit tells rebar that the background work of a processor exited, with a nil
+// err for a clean exit. ctx must be the context given to the processor's Start.
+// It's a no-op when the processor was not started by rebar.
+func ReportExit(ctx context.Context, err error) {
+	if reporter, ok := ctx.Value(exitReporterKey{}).(exitReporter); ok {
+		reporter.r.supervisor.handleExit(reporter, err)
+	}
+}
+
+// supervisor keeps track of processor exits and restarts
+type supervisor struct {
+	mu       sync.Mutex
+	stopping bool
+	shutdown chan struct{}
+	restarts sync.WaitGroup
+	escalate context.CancelFunc
+}
+
+func newSupervisor() *supervisor {
+	return &supervisor{shutdown: make(chan struct{})}
+}
+
+func (s *supervisor) setEscalate(escalate context.CancelFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.escalate = escalate
+}
+
+// stop prevents any further restart and waits for restarts in progress to complete
+func (s *supervisor) stop(ctx context.Context) {
+	s.mu.Lock()
+	if !s.stopping {
+		s.stopping = true
+		close(s.shutdown)
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.restarts.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// startEntry starts a new run of the processor with a context carrying its exit reporter
+func (r *Rebar) startEntry(e *processorEntry) error {
+	e.mu.Lock()
+	e.run++
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancelRun = cancel
+	ctx = context.WithValue(ctx, exitReporterKey{}, exitReporter{r: r, e: e, run: e.run})
+	e.mu.Unlock()
+
+	return e.processor.Start(ctx)
+}
+
+// exitDecision is what to do about an exit. It's decided while holding the locks,
+// and carried out once they're released, so that event hooks and the escalation
+// can use the processors.
+type exitDecision struct {
+	events   []Event
+	escalate context.CancelFunc
+	restart  bool
+	delay    time.Duration
+}
+
+func (s *supervisor) handleExit(reporter exitReporter, err error) {
+	d := s.decideExit(reporter, err)
+	r := reporter.r
+	if d.restart {
+		// the restart is counted already, so it must be running for a hook stopping
+		// the processors to return, but it waits for the events to be emitted first
+		ready := make(chan struct{})
+		go r.restart(reporter.e, d.delay, ready)
+		defer close(ready)
+	}
+	for _, e := range d.events {
+		r.emit(e)
+	}
+	if d.escalate != nil {
+		d.escalate()
+	}
+}
+
+func (s *supervisor) decideExit(reporter exitReporter, err error) (d exitDecision) {
+	e := reporter.e
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if s.stopping || reporter.run != e.run || e.restarting {
+		// exits during shutdown and from previous runs are expected
+		return
+	}
+	d.events = append(d.events, Event{Type: EventProcessorExited, Message: "processor exited", Processor: e.name, Err: err})
+
+	policy := e.supervision.Policy
+	if policy == RestartNever || (policy == RestartOnFailure && err == nil) {
+		return
+	}
+
+	now := time.Now()
+	recent := e.restarts[:0]
+	for _, at := range e.restarts {
+		if now.Sub(at) < e.supervision.Window {
+			recent = append(recent, at)
+		}
+	}
+	e.restarts = recent
+	if len(e.restarts) >= e.supervision.MaxRestarts {
+		d.events = append(d.events, Event{
+			Type:      EventProcessorRestarting,
+			Message:   "processor not restarted, shutting down",
+			Processor: e.name,
+			Err:       fmt.Errorf("exceeded %d restarts within %s", e.supervision.MaxRestarts, e.supervision.Window),
+		})
+		d.escalate = s.escalate
+		return
+	}
+
+	d.delay = e.supervision.backoff(len(e.restarts))
+	d.restart = true
+	e.restarts = append(e.restarts, now)
+	e.restarting = true
+	// added while holding the lock, so that stop waits for the restart
+	s.restarts.Add(1)
+	return
+}
+
+func (r *Rebar) restart(e *processorEntry, delay time.Duration, ready <-chan struct{}) {
+	defer r.supervisor.restarts.Done()
+
+	select {
+	case <-ready:
+	case <-r.supervisor.shutdown:
+		return
+	}
+
+	r.emit(Event{Type: EventProcessorRestarting, Message: "restarting processor", Processor: e.name, Duration: delay})
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-r.supervisor.shutdown:
+		return
+	}
+
+	stopCtx, cancelStop := r.processorShutdownContext()
+	if err := stopProcessor(stopCtx, e); err != nil {
+		r.emit(Event{Type: EventProcessorStopFailed, Message: "unable to stop exited processor", Processor: e.name, Err: err})
+	}
+	cancelStop()
+
+	e.cancelRunContext()
+
+	select {
+	case <-r.supervisor.shutdown:
+		return
+	default:
+	}
+
+	err := r.startEntry(e)
+	e.mu.Lock()
+	e.restarting = false
+	run := e.run
+	e.mu.Unlock()
+	if err != nil {
+		r.emit(Event{Type: EventProcessorStartFailed, Message: "unable to restart processor", Processor: e.name, Err: err})
+		r.supervisor.handleExit(exitReporter{r: r, e: e, run: run}, err)
+	}
+}
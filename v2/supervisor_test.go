@@ -0,0 +1,192 @@
+package rebar_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/masonhubco/rebar/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exitingProcessor reports an exit from its background goroutine right after
+// being started, as long as exitFn returns true for the run
+type exitingProcessor struct {
+	starts int32
+	stops  int32
+	exitFn func(run int32) (exit bool, err error)
+}
+
+func (p *exitingProcessor) Start(ctx context.Context) error {
+	run := atomic.AddInt32(&p.starts, 1)
+	go func() {
+		if exit, err := p.exitFn(run); exit {
+			rebar.ReportExit(ctx, err)
+		}
+	}()
+	return nil
+}
+
+func (p *exitingProcessor) Stop(ctx context.Context) error {
+	atomic.AddInt32(&p.stops, 1)
+	return nil
+}
+
+func (p *exitingProcessor) Starts() int32 {
+	return atomic.LoadInt32(&p.starts)
+}
+
+func Test_Supervise(t *testing.T) {
+	t.Parallel()
+
+	failOnce := func(run int32) (bool, error) {
+		return run == 1, errors.New("connection lost")
+	}
+	exitOnce := func(run int32) (bool, error) {
+		return run == 1, nil
+	}
+
+	tests := []struct {
+		name       string
+		policy     rebar.RestartPolicy
+		exitFn     func(run int32) (bool, error)
+		wantStarts int32
+	}{
+		{name: "never restarts on failure", policy: rebar.RestartNever, exitFn: failOnce, wantStarts: 1},
+		{name: "on-failure restarts on failure", policy: rebar.RestartOnFailure, exitFn: failOnce, wantStarts: 2},
+		{name: "on-failure ignores clean exit", policy: rebar.RestartOnFailure, exitFn: exitOnce, wantStarts: 1},
+		{name: "always restarts on clean exit", policy: rebar.RestartAlways, exitFn: exitOnce, wantStarts: 2},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			p := &exitingProcessor{exitFn: tc.exitFn}
+			r := rebar.New(rebar.Options{})
+			r.AddLifecycleProcessor(p, rebar.Supervise(rebar.Supervision{
+				Policy:         tc.policy,
+				InitialBackoff: time.Millisecond,
+			}))
+			require.Empty(t, r.StartProcessors())
+
+			time.Sleep(100 * time.Millisecond)
+			assert.Equal(t, tc.wantStarts, p.Starts())
+			// the exited run is stopped before being restarted
+			assert.Equal(t, tc.wantStarts-1, atomic.LoadInt32(&p.stops))
+
+			var wg sync.WaitGroup
+			assert.Empty(t, r.StopProcessors(&wg))
+			wg.Wait()
+		})
+	}
+}
+
+func Test_Supervise_Escalates(t *testing.T) {
+	t.Parallel()
+
+	p := &exitingProcessor{exitFn: func(run int32) (bool, error) {
+		return true, errors.New("always broken")
+	}}
+	r := rebar.New(rebar.Options{ShutDownWait: time.Second})
+	r.AddLifecycleProcessor(p, rebar.Supervise(rebar.Supervision{
+		Policy:         rebar.RestartOnFailure,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+		MaxRestarts:    3,
+	}))
+	r.Server.Addr = "127.0.0.1:0"
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	done := make(chan error, 1)
+	go func() {
+		done <- r.RunWithContext(ctx, stop)
+	}()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("app context was not canceled after too many restarts")
+	}
+	// first run and 3 restarts
+	assert.Equal(t, int32(4), p.Starts())
+}
+
+func Test_ReportExit_NotStartedByRebar(t *testing.T) {
+	t.Parallel()
+
+	assert.NotPanics(t, func() {
+		rebar.ReportExit(context.Background(), errors.New("nobody listens"))
+	})
+}
+
+func Test_RestartPolicy_String(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "never", rebar.RestartNever.String())
+	assert.Equal(t, "on-failure", rebar.RestartOnFailure.String())
+	assert.Equal(t, "always", rebar.RestartAlways.String())
+}
+
+func Test_Supervise_HookUsingProcessors(t *testing.T) {
+	t.Parallel()
+
+	var r *rebar.Rebar
+	stopped := make(chan struct{})
+	r = rebar.New(rebar.Options{OnEvent: func(e rebar.Event) {
+		if e.Type == rebar.EventProcessorExited {
+			// a hook stopping the processors doesn't deadlock the supervisor
+			r.StopProcessorsWithContext(context.Background())
+			close(stopped)
+		}
+	}})
+	p := &exitingProcessor{exitFn: func(run int32) (bool, error) {
+		return run == 1, errors.New("connection lost")
+	}}
+	r.AddLifecycleProcessor(p, rebar.Supervise(rebar.Supervision{Policy: rebar.RestartOnFailure}))
+	require.Empty(t, r.StartProcessors())
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the event hook deadlocked")
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&p.stops))
+	assert.Equal(t, int32(1), p.Starts())
+}
+
+func Test_Supervise_NoJitter(t *testing.T) {
+	t.Parallel()
+
+	delays := make(chan time.Duration, 1)
+	r := rebar.New(rebar.Options{OnEvent: func(e rebar.Event) {
+		if e.Type == rebar.EventProcessorRestarting {
+			delays <- e.Duration
+		}
+	}})
+	p := &exitingProcessor{exitFn: func(run int32) (bool, error) {
+		return run == 1, errors.New("connection lost")
+	}}
+	r.AddLifecycleProcessor(p, rebar.Supervise(rebar.Supervision{
+		Policy:         rebar.RestartOnFailure,
+		InitialBackoff: 3 * time.Millisecond,
+		Jitter:         rebar.NoJitter,
+	}))
+	require.Empty(t, r.StartProcessors())
+
+	select {
+	case delay := <-delays:
+		assert.Equal(t, 3*time.Millisecond, delay)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the processor was not restarted")
+	}
+	require.Eventually(t, func() bool { return p.Starts() == 2 }, time.Second, time.Millisecond)
+	assert.Empty(t, r.StopProcessorsWithContext(context.Background()))
+}
@@ -0,0 +1,253 @@
+package rebar
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Cipher policies for TLSOptions.CipherPolicy
+const (
+	// TLSPolicyIntermediate accepts TLS 1.2 with forward secret AEAD cipher suites, and TLS 1.3
+	TLSPolicyIntermediate = "intermediate"
+	// TLSPolicyModern only accepts TLS 1.3
+	TLSPolicyModern = "modern"
+)
+
+// TLSOptions configures TLS serving. Certificates are reloaded from disk without a
+// restart, when the files change or when the process receives SIGHUP.
+type TLSOptions struct {
+	// CertFile and KeyFile are the paths of the PEM encoded certificate and key.
+	CertFile string
+	KeyFile  string
+	// CertDir is an alternative to CertFile and KeyFile, for certificates mounted
+	// from a kubernetes TLS secret. It must contain tls.crt and tls.key.
+	CertDir string
+	// MinVersion defaults to TLS 1.2, or TLS 1.3 with the modern policy.
+	MinVersion uint16
+	// CipherPolicy defaults to intermediate. See TLSPolicyIntermediate and TLSPolicyModern.
+	CipherPolicy string
+	// CipherSuites overrides the cipher suites of the policy for TLS 1.2 connections.
+	CipherSuites []uint16
+	// ClientCAFile is optional. When it's set, clients must present a certificate
+	// signed by one of its CAs, unless ClientAuth says otherwise.
+	ClientCAFile string
+	// ClientAuth defaults to tls.RequireAndVerifyClientCert when ClientCAFile is set.
+	ClientAuth tls.ClientAuthType
+	// ReloadInterval defaults to 10 seconds. It's how often the files are checked
+	// for changes.
+	ReloadInterval time.Duration
+}
+
+func (o TLSOptions) valuesOrDefaults() TLSOptions {
+	if o.CertDir != "" {
+		if o.CertFile == "" {
+			o.CertFile = filepath.Join(o.CertDir, "tls.crt")
+		}
+		if o.KeyFile == "" {
+			o.KeyFile = filepath.Join(o.CertDir, "tls.key")
+		}
+	}
+	if o.CipherPolicy == "" {
+		o.CipherPolicy = TLSPolicyIntermediate
+	}
+	if o.MinVersion == 0 {
+		o.MinVersion = tls.VersionTLS12
+		if o.CipherPolicy == TLSPolicyModern {
+			o.MinVersion = tls.VersionTLS13
+		}
+	}
+	if o.CipherSuites == nil && o.CipherPolicy == TLSPolicyIntermediate {
+		o.CipherSuites = []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+		}
+	}
+	if o.ClientCAFile != "" && o.ClientAuth == tls.NoClientCert {
+		o.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if o.ReloadInterval == 0 {
+		o.ReloadInterval = 10 * time.Second
+	}
+	return o
+}
+
+// CertReloader serves the certificate and client CAs most recently loaded from disk
+type CertReloader struct {
+	opts TLSOptions
+
+	// emit reports reload events, through the app logger when it's served by rebar
+	emit func(Event)
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	clientCA *x509.CertPool
+	files    tlsFiles
+}
+
+// tlsFiles are the contents of the files a certificate is loaded from
+type tlsFiles struct {
+	cert, key, clientCA []byte
+}
+
+func (f tlsFiles) equal(other tlsFiles) bool {
+	return bytes.Equal(f.cert, other.cert) && bytes.Equal(f.key, other.key) &&
+		bytes.Equal(f.clientCA, other.clientCA)
+}
+
+// NewCertReloader loads the certificate, and the client CAs if any. It fails when
+// they can't be loaded.
+func NewCertReloader(opts TLSOptions) (*CertReloader, error) {
+	opts = opts.valuesOrDefaults()
+	if opts.CertFile == "" || opts.KeyFile == "" {
+		return nil, errors.New("tls: CertFile and KeyFile, or CertDir, are required")
+	}
+	c := &CertReloader{opts: opts}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload loads the files again. The previous certificate is kept when they can't
+// be loaded. Each file is read once, so that the certificate always matches the
+// contents it's compared with on the next reload.
+func (c *CertReloader) Reload() error {
+	files, err := c.readFiles()
+	if err != nil {
+		return err
+	}
+	c.mu.RLock()
+	unchanged := files.equal(c.files)
+	c.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	cert, err := tls.X509KeyPair(files.cert, files.key)
+	if err != nil {
+		return fmt.Errorf("tls: unable to load key pair: %w", err)
+	}
+	var clientCA *x509.CertPool
+	if c.opts.ClientCAFile != "" {
+		clientCA = x509.NewCertPool()
+		if !clientCA.AppendCertsFromPEM(files.clientCA) {
+			return fmt.Errorf("tls: no certificate found in client CA file %s", c.opts.ClientCAFile)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert = &cert
+	c.clientCA = clientCA
+	c.files = files
+	return nil
+}
+
+// readFiles reads the files, to detect changes and load them. Comparing contents
+// rather than modification times also works with the symlink swaps of kubernetes
+// secrets.
+func (c *CertReloader) readFiles() (tlsFiles, error) {
+	var files tlsFiles
+	for _, file := range []struct {
+		name    string
+		content *[]byte
+	}{
+		{c.opts.CertFile, &files.cert},
+		{c.opts.KeyFile, &files.key},
+		{c.opts.ClientCAFile, &files.clientCA},
+	} {
+		if file.name == "" {
+			continue
+		}
+		content, err := os.ReadFile(file.name)
+		if err != nil {
+			return tlsFiles{}, fmt.Errorf("tls: %w", err)
+		}
+		*file.content = content
+	}
+	return files, nil
+}
+
+// TLSConfig returns a config that always serves the most recently loaded certificate
+func (c *CertReloader) TLSConfig() *tls.Config {
+	base := &tls.Config{
+		MinVersion:   c.opts.MinVersion,
+		CipherSuites: c.opts.CipherSuites,
+		ClientAuth:   c.opts.ClientAuth,
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+	return &tls.Config{
+		MinVersion: base.MinVersion,
+		// http.Server.ServeTLS only accepts a config without Certificates when it
+		// has GetCertificate, although the certificate comes from GetConfigForClient
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			c.mu.RLock()
+			defer c.mu.RUnlock()
+			return c.cert, nil
+		},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			c.mu.RLock()
+			defer c.mu.RUnlock()
+			config := base.Clone()
+			config.Certificates = []tls.Certificate{*c.cert}
+			config.ClientCAs = c.clientCA
+			return config, nil
+		},
+	}
+}
+
+func (c *CertReloader) report(e Event) {
+	if c.emit != nil {
+		c.emit(e)
+		return
+	}
+	if logger, err := NewStandardLogger(); err == nil {
+		logEvent(logger, e)
+	}
+}
+
+// Watch reloads the files when they change and when the process receives SIGHUP,
+// until ctx is done.
+func (c *CertReloader) Watch(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(c.opts.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		var sig os.Signal
+		select {
+		case <-ctx.Done():
+			return
+		case sig = <-hup:
+		case <-ticker.C:
+		}
+		err := c.Reload()
+		switch {
+		case err != nil:
+			c.report(Event{
+				Type:    EventTLSReloaded,
+				Message: "unable to reload TLS certificate, keeping the previous one",
+				Signal:  sig,
+				Err:     err,
+			})
+		case sig != nil:
+			c.report(Event{Type: EventTLSReloaded, Message: "TLS certificate reloaded", Signal: sig})
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package rebar_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/masonhubco/rebar/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newTestCert creates a certificate for 127.0.0.1, signed by parent or self-signed
+// when parent is nil
+func newTestCert(t *testing.T, serial int64, isCA bool, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: fmt.Sprintf("rebar test %d", serial)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func (c *testCert) write(t *testing.T, dir string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tls.crt"), c.certPEM, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tls.key"), c.keyPEM, 0600))
+}
+
+func servedSerial(t *testing.T, reloader *rebar.CertReloader) int64 {
+	t.Helper()
+	config, err := reloader.TLSConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	require.Len(t, config.Certificates, 1)
+	// ServeTLS needs the outer config to have a certificate too
+	cert, err := reloader.TLSConfig().GetCertificate(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	assert.Equal(t, config.Certificates[0].Certificate, cert.Certificate)
+	leaf, err := x509.ParseCertificate(config.Certificates[0].Certificate[0])
+	require.NoError(t, err)
+	return leaf.SerialNumber.Int64()
+}
+
+func Test_NewCertReloader(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	newTestCert(t, 1, false, nil).write(t, dir)
+
+	tests := []struct {
+		name           string
+		given          rebar.TLSOptions
+		wantErr        string
+		wantMinVersion uint16
+		wantClientAuth tls.ClientAuthType
+	}{
+		{
+			name:    "no certificate",
+			given:   rebar.TLSOptions{},
+			wantErr: "tls: CertFile and KeyFile, or CertDir, are required",
+		},
+		{
+			name:    "missing files",
+			given:   rebar.TLSOptions{CertDir: filepath.Join(dir, "nope")},
+			wantErr: "tls: open " + filepath.Join(dir, "nope", "tls.crt") + ": no such file or directory",
+		},
+		{
+			name:    "bad client CA",
+			given:   rebar.TLSOptions{CertDir: dir, ClientCAFile: filepath.Join(dir, "tls.key")},
+			wantErr: "tls: no certificate found in client CA file " + filepath.Join(dir, "tls.key"),
+		},
+		{
+			name:           "cert dir with defaults",
+			given:          rebar.TLSOptions{CertDir: dir},
+			wantMinVersion: tls.VersionTLS12,
+			wantClientAuth: tls.NoClientCert,
+		},
+		{
+			name: "cert files with modern policy and client CA",
+			given: rebar.TLSOptions{
+				CertFile:     filepath.Join(dir, "tls.crt"),
+				KeyFile:      filepath.Join(dir, "tls.key"),
+				ClientCAFile: filepath.Join(dir, "tls.crt"),
+				CipherPolicy: rebar.TLSPolicyModern,
+			},
+			wantMinVersion: tls.VersionTLS13,
+			wantClientAuth: tls.RequireAndVerifyClientCert,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			reloader, err := rebar.NewCertReloader(tc.given)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			config, err := reloader.TLSConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantMinVersion, config.MinVersion)
+			assert.Equal(t, tc.wantClientAuth, config.ClientAuth)
+		})
+	}
+}
+
+func Test_CertReloader_Reload(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	newTestCert(t, 1, false, nil).write(t, dir)
+	reloader, err := rebar.NewCertReloader(rebar.TLSOptions{CertDir: dir})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), servedSerial(t, reloader))
+
+	newTestCert(t, 2, false, nil).write(t, dir)
+	require.NoError(t, reloader.Reload())
+	assert.Equal(t, int64(2), servedSerial(t, reloader))
+
+	// a broken rotation keeps the previous certificate
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tls.key"), []byte("garbage"), 0600))
+	assert.Error(t, reloader.Reload())
+	assert.Equal(t, int64(2), servedSerial(t, reloader))
+
+	// a rotation caught halfway is picked up once it's complete
+	next := newTestCert(t, 3, false, nil)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tls.crt"), next.certPEM, 0600))
+	assert.Error(t, reloader.Reload())
+	assert.Equal(t, int64(2), servedSerial(t, reloader))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tls.key"), next.keyPEM, 0600))
+	require.NoError(t, reloader.Reload())
+	assert.Equal(t, int64(3), servedSerial(t, reloader))
+}
+
+func Test_CertReloader_Watch(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	newTestCert(t, 1, false, nil).write(t, dir)
+	reloader, err := rebar.NewCertReloader(rebar.TLSOptions{CertDir: dir, ReloadInterval: 10 * time.Millisecond})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.Watch(ctx)
+
+	newTestCert(t, 2, false, nil).write(t, dir)
+	assert.Eventually(t, func() bool { return servedSerial(t, reloader) == 2 },
+		time.Second, 10*time.Millisecond)
+}
+
+func Test_Rebar_RunWithTLS(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	ca := newTestCert(t, 1, true, nil)
+	newTestCert(t, 2, false, ca).write(t, dir)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ca.crt"), ca.certPEM, 0600))
+	clientCert := newTestCert(t, 3, false, ca)
+
+	port := freePort(t)
+	r := rebar.New(rebar.Options{
+		Port:         port,
+		ShutDownWait: time.Second,
+		TLS:          &rebar.TLSOptions{CertDir: dir, ClientCAFile: filepath.Join(dir, "ca.crt")},
+		Health:       rebar.HealthOptions{OnRouter: true},
+	})
+	r.Server.Addr = "127.0.0.1:" + port
+
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- r.RunWithContext(ctx, stop)
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	newClient := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{
+			DisableKeepAlives: true,
+			TLSClientConfig:   &tls.Config{RootCAs: roots, Certificates: certs},
+		}}
+	}
+	keyPair, err := tls.X509KeyPair(clientCert.certPEM, clientCert.keyPEM)
+	require.NoError(t, err)
+	url := fmt.Sprintf("https://127.0.0.1:%s/healthz", port)
+
+	require.Eventually(t, func() bool {
+		resp, err := newClient(keyPair).Get(url)
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// no client certificate
+	_, err = newClient().Get(url)
+	assert.Error(t, err)
+
+	stop()
+	require.NoError(t, <-done)
+}
+
+func Test_Rebar_RunWithTLS_BadCertificate(t *testing.T) {
+	t.Parallel()
+
+	r := rebar.New(rebar.Options{TLS: &rebar.TLSOptions{CertDir: t.TempDir()}})
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	err := r.RunWithContext(ctx, stop)
+	assert.Error(t, err)
+}
@@ -0,0 +1,76 @@
+package rebar
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// Environment variables set by a process handing its listeners over to the new binary
+// it started. See Options.GracefulUpgrade.
+const (
+	// UpgradeListenersEnv is the number of server listeners inherited from file
+	// descriptor 3 onwards
+	UpgradeListenersEnv = "REBAR_UPGRADE_LISTENERS"
+	// UpgradeAdminEnv is set to 1 when the admin listener is inherited, right after
+	// the server listeners
+	UpgradeAdminEnv = "REBAR_UPGRADE_ADMIN"
+	// UpgradeReadyEnv is the file descriptor the new process writes to once it's
+	// running, for the previous process to start shutting down
+	UpgradeReadyEnv = "REBAR_UPGRADE_READY_FD"
+)
+
+const upgradeFirstFD = 3
+
+// inheritedListeners returns the listeners handed over by the previous process, if any.
+// The environment variables are cleared, so that they're not passed on to children.
+func inheritedListeners() (listeners []net.Listener, admin net.Listener, inherited bool, err error) {
+	count := os.Getenv(UpgradeListenersEnv)
+	if count == "" {
+		return nil, nil, false, nil
+	}
+	withAdmin := os.Getenv(UpgradeAdminEnv) == "1"
+	os.Unsetenv(UpgradeListenersEnv)
+	os.Unsetenv(UpgradeAdminEnv)
+
+	n, err := strconv.Atoi(count)
+	if err != nil {
+		return nil, nil, true, fmt.Errorf("invalid %s: %w", UpgradeListenersEnv, err)
+	}
+	for i := 0; i < n; i++ {
+		fd := upgradeFirstFD + i
+		l, err := fileListener(os.NewFile(uintptr(fd), "upgrade:"+strconv.Itoa(fd)))
+		if err != nil {
+			closeListeners(listeners)
+			return nil, nil, true, fmt.Errorf("inherit listener %d: %w", fd, err)
+		}
+		listeners = append(listeners, l)
+	}
+	if withAdmin {
+		fd := upgradeFirstFD + n
+		admin, err = fileListener(os.NewFile(uintptr(fd), "upgrade:admin"))
+		if err != nil {
+			closeListeners(listeners)
+			return nil, nil, true, fmt.Errorf("inherit admin listener %d: %w", fd, err)
+		}
+	}
+	return listeners, admin, true, nil
+}
+
+// notifyUpgradeReady tells the previous process, if any, that this process is running
+func notifyUpgradeReady() error {
+	fd := os.Getenv(UpgradeReadyEnv)
+	if fd == "" {
+		return nil
+	}
+	os.Unsetenv(UpgradeReadyEnv)
+	n, err := strconv.Atoi(fd)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", UpgradeReadyEnv, err)
+	}
+	f := os.NewFile(uintptr(n), "upgrade:ready")
+	defer f.Close()
+	_, err = f.Write([]byte("ready\n"))
+	return err
+}
@@ -0,0 +1,130 @@
+//go:build !windows
+// +build !windows
+
+package rebar
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// watchUpgrades upgrades the binary when the process receives SIGUSR2, and stops the
+// app once the new process is running
+func (r *Rebar) watchUpgrades(ctx context.Context, stop context.CancelFunc, listeners []net.Listener, admin net.Listener) {
+	usr2 := make(chan os.Signal, 1)
+	signal.Notify(usr2, syscall.SIGUSR2)
+	defer signal.Stop(usr2)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s := <-usr2:
+			r.emit(Event{Type: EventSignalReceived, Message: "starting the new process", Signal: s})
+		}
+		start := time.Now()
+		pid, err := r.upgrade(listeners, admin)
+		if err != nil {
+			r.emit(Event{Type: EventUpgrade, Message: "upgrade abandoned", Err: err, Duration: time.Since(start)})
+			continue
+		}
+		r.emit(Event{
+			Type:     EventUpgrade,
+			Message:  fmt.Sprintf("new process %d is running, shutting down", pid),
+			Duration: time.Since(start),
+		})
+		stop()
+		return
+	}
+}
+
+// upgrade starts the executable again with the listeners, and waits for the new
+// process to be running
+func (r *Rebar) upgrade(listeners []net.Listener, admin net.Listener) (int, error) {
+	all := listeners
+	if admin != nil {
+		all = append(all[:len(all):len(all)], admin)
+	}
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, l := range all {
+		filer, ok := l.(interface{ File() (*os.File, error) })
+		if !ok {
+			return 0, fmt.Errorf("listener %s can't be handed over", l.Addr())
+		}
+		f, err := filer.File()
+		if err != nil {
+			return 0, err
+		}
+		files = append(files, f)
+	}
+
+	ready, readyW, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	defer ready.Close()
+	executable, err := os.Executable()
+	if err != nil {
+		readyW.Close()
+		return 0, err
+	}
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = append(files[:len(files):len(files)], readyW)
+	cmd.Env = append(os.Environ(),
+		UpgradeListenersEnv+"="+strconv.Itoa(len(listeners)),
+		UpgradeReadyEnv+"="+strconv.Itoa(upgradeFirstFD+len(files)),
+	)
+	if admin != nil {
+		cmd.Env = append(cmd.Env, UpgradeAdminEnv+"=1")
+	}
+	err = cmd.Start()
+	// only the new process writes to the pipe, so that reading it stops if it dies
+	readyW.Close()
+	if err != nil {
+		return 0, err
+	}
+	// reaps the new process if it dies, which the pipe reports
+	go cmd.Wait()
+
+	result := make(chan error, 1)
+	go func() {
+		if _, err := bufio.NewReader(ready).ReadString('\n'); err != nil {
+			result <- errors.New("the new process exited before running")
+			return
+		}
+		result <- nil
+	}()
+	select {
+	case err = <-result:
+	case <-time.After(r.UpgradeTimeout):
+		err = fmt.Errorf("the new process was not running after %s", r.UpgradeTimeout)
+		cmd.Process.Kill()
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	for _, l := range all {
+		if unix, ok := l.(interface{ SetUnlinkOnClose(bool) }); ok {
+			// the socket file now belongs to the new process
+			unix.SetUnlinkOnClose(false)
+		}
+	}
+	return cmd.Process.Pid, nil
+}
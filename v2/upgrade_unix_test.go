@@ -0,0 +1,80 @@
+//go:build !windows
+// +build !windows
+
+package rebar_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/masonhubco/rebar/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test_Rebar_InheritedListeners runs itself in a subprocess that inherits a server
+// and an admin listener, the way a process started by a graceful upgrade does
+func Test_Rebar_InheritedListeners(t *testing.T) {
+	if os.Getenv("REBAR_TEST_UPGRADE") == "1" {
+		app := rebar.New(rebar.Options{Environment: rebar.Test, AdminPort: "1"})
+		ctx, stop := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- app.RunWithContext(ctx, stop) }()
+		for app.Phase() != rebar.PhaseRunning {
+			time.Sleep(10 * time.Millisecond)
+		}
+		addrs := app.Addrs()
+		_, upgrading := os.LookupEnv(rebar.UpgradeListenersEnv)
+		stop()
+		if err := <-done; err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Print(len(addrs), " ", addrs[0], " ", upgrading)
+		os.Exit(0)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	server, err := l.(*net.TCPListener).File()
+	require.NoError(t, err)
+	defer server.Close()
+	al, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer al.Close()
+	admin, err := al.(*net.TCPListener).File()
+	require.NoError(t, err)
+	defer admin.Close()
+	ready, readyW, err := os.Pipe()
+	require.NoError(t, err)
+	defer ready.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^Test_Rebar_InheritedListeners$")
+	cmd.Env = append(os.Environ(),
+		"REBAR_TEST_UPGRADE=1",
+		// gin's debug output would mix with the output checked
+		gin.EnvGinMode+"="+gin.ReleaseMode,
+		rebar.UpgradeListenersEnv+"=1",
+		rebar.UpgradeAdminEnv+"=1",
+		rebar.UpgradeReadyEnv+"="+strconv.Itoa(5),
+	)
+	cmd.ExtraFiles = []*os.File{server, admin, readyW}
+	out, err := cmd.Output()
+	readyW.Close()
+	require.NoError(t, err, string(out))
+
+	// the ports handed over are used, not the configured ones
+	assert.Equal(t, fmt.Sprintf("1 %s false", l.Addr()), string(out))
+	notified, err := io.ReadAll(ready)
+	require.NoError(t, err)
+	assert.Equal(t, "ready\n", string(notified))
+}
@@ -0,0 +1,12 @@
+package rebar
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// watchUpgrades only logs that graceful upgrades are not supported on Windows
+func (r *Rebar) watchUpgrades(ctx context.Context, stop context.CancelFunc, listeners []net.Listener, admin net.Listener) {
+	r.emit(Event{Type: EventUpgrade, Message: "graceful upgrades are disabled", Err: errors.New("not supported on Windows")})
+}